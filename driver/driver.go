@@ -2,7 +2,9 @@ package driver
 
 import (
 	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/cirocosta/golvm/lib"
 	"github.com/pkg/errors"
@@ -19,7 +21,16 @@ type Driver struct {
 	dirManager  *DirManager
 	logger      zerolog.Logger
 	vgWhiteList map[string]bool
-	mountsFile  string
+	caps        *lib.Capabilities
+
+	unmountPolicy lib.UnmountPolicy
+	fsckPolicy    lib.FsckPolicy
+	freezeTimeout time.Duration
+	populateRoot  string
+
+	// creating holds the volumes whose creation goes on
+	// without the lock (see unlocked).
+	creating map[string]bool
 
 	sync.Mutex
 }
@@ -41,21 +52,36 @@ type DriverConfig struct {
 	// no specific volumegroup is specified.
 	VgWhitelistFile string
 
-	// MountsFile corresponds to the file describing
-	// the mounts of the system. Usually this file
-	// is '/proc/mounts' but the file can be anywhere.
-	MountsFile string
+	// Capabilities describes the features supported by
+	// the tools installed in the system. When specified,
+	// creation options are checked against it.
+	Capabilities *lib.Capabilities
+
+	// UnmountPolicy determines whether busy filesystems
+	// get lazily detached or forcibly unmounted. Defaults
+	// to failing the unmount.
+	UnmountPolicy string
+
+	// FsckPolicy determines whether filesystems get checked
+	// before being mounted (never, auto or always) unless
+	// the volume specified its own. Defaults to never.
+	FsckPolicy string
+
+	// FreezeTimeout bounds how long the filesystem of the
+	// origin of a snapshot stays frozen while the snapshot
+	// is taken. Defaults to lib.DefaultFreezeTimeout.
+	FreezeTimeout time.Duration
+
+	// PopulateRoot is the directory that holds the content
+	// (directories or tarballs) that new volumes can be
+	// populated with. Populating is disabled if empty.
+	PopulateRoot string
 }
 
 // NewDriver instantiates a new Driver from a DriverConfig.
 func NewDriver(cfg DriverConfig) (d Driver, err error) {
 	var whitelist map[string]bool
 
-	if cfg.MountsFile == "" {
-		err = errors.Errorf("MountsFile must be specified")
-		return
-	}
-
 	if cfg.Lvm == nil {
 		err = errors.Errorf("Lvm must be specified")
 		return
@@ -94,7 +120,26 @@ func NewDriver(cfg DriverConfig) (d Driver, err error) {
 	d.lvm = cfg.Lvm
 	d.dirManager = cfg.DirManager
 	d.vgWhiteList = whitelist
-	d.mountsFile = cfg.MountsFile
+	d.caps = cfg.Capabilities
+
+	d.unmountPolicy, err = lib.ParseUnmountPolicy(cfg.UnmountPolicy)
+	if err != nil {
+		return
+	}
+
+	d.fsckPolicy, err = lib.ParseFsckPolicy(cfg.FsckPolicy)
+	if err != nil {
+		return
+	}
+
+	d.freezeTimeout = cfg.FreezeTimeout
+	if d.freezeTimeout == 0 {
+		d.freezeTimeout = lib.DefaultFreezeTimeout
+	}
+
+	d.populateRoot = cfg.PopulateRoot
+	d.creating = map[string]bool{}
+
 	d.logger.Info().Msg("driver initialized")
 
 	return
@@ -114,18 +159,64 @@ func NewDriver(cfg DriverConfig) (d Driver, err error) {
 //				best one from the pool of whitelisted
 //				volumegroups.
 //	-	fstype:		type of filesystem to use in
-//				the volume (ext4 or xfs)
-func (d Driver) Create(req *v.CreateRequest) (err error) {
+//				the volume (ext4, xfs, btrfs or none
+//				to leave it raw)
+//	-	type:		raid type of the volume (raid1,
+//				raid5 or raid10)
+//	-	stripes:	number of stripes
+//	-	stripesize:	size of each stripe
+//	-	mirrors:	number of mirrors (raid1 and raid10)
+//	-	pvs:		comma-separated list of physical
+//				volumes to allocate from
+//	-	avoid:		volume whose physical volumes must
+//				not be used by the new volume
+//	-	mountopts:	comma-separated list of options to
+//				mount the volume with (e.g., noatime,
+//				nodev, discard or data=ordered)
+//	-	mkfs.*:		tuning options of the filesystem
+//				creation (mkfs.label, mkfs.inode-ratio,
+//				mkfs.reserved, mkfs.lazy-init and
+//				mkfs.block-size)
+//	-	fsck:		whether to check the filesystem
+//				before mounting it (never, auto or
+//				always), overriding the driver's policy
+//	-	uuid:		what to do with the filesystem uuid of
+//				snapshots, shared with their origin:
+//				auto (nouuid for xfs and regenerate
+//				for ext4), keep, nouuid or regenerate
+//	-	freezetimeout:	how long the filesystem of the origin
+//				of a snapshot can stay frozen while
+//				the snapshot is taken (0 disables
+//				freezing)
+//	-	from:		volume to clone: thin volumes are
+//				cloned with a thin snapshot while
+//				thick ones are copied block by block
+//				into the new volume
+//	-	sparse:		whether to skip copying the blocks of
+//				zeros when cloning a thick volume into
+//				a thin one (true or false)
+//	-	populate:	directory or tarball (under the
+//				driver's populate root) to fill the
+//				filesystem of the new volume with
+func (d *Driver) Create(req *v.CreateRequest) (err error) {
 	var (
-		size        string
-		thinpool    string
-		snapshot    string
-		keyfile     string
-		volumegroup string
-		fstype      string
-		validVgs    []*lib.VolumeGroup
-		vgs         []*lib.VolumeGroup
-		vg          *lib.VolumeGroup
+		validVgs   []*lib.VolumeGroup
+		inv        *lib.Inventory
+		vg         *lib.VolumeGroup
+		avoided    *lib.LogicalVolume
+		avoid      string
+		required   uint64
+		needed     lib.ByteSize
+		cfg        lib.LvCreationConfig
+		mountOpts  lib.MountOptions
+		formatOpts lib.FormatOptions
+		formatter  lib.Formatter
+		origin     *lib.LogicalVolume
+		source     *lib.LogicalVolume
+		from       string
+		populate   string
+		sparse     bool
+		freeze     = d.freezeTimeout
 	)
 
 	d.logger.Debug().
@@ -136,34 +227,239 @@ func (d Driver) Create(req *v.CreateRequest) (err error) {
 	d.Lock()
 	defer d.Unlock()
 
-	size, _ = req.Options["size"]
-	thinpool, _ = req.Options["thinpool"]
-	snapshot, _ = req.Options["snapshot"]
-	keyfile, _ = req.Options["keyfile"]
-	volumegroup, _ = req.Options["volumegroup"]
-	fstype, _ = req.Options["fstype"]
+	err = d.checkNotCreating(req.Name)
+	if err != nil {
+		return
+	}
+
+	cfg.Name = req.Name
+	cfg.Size, _ = req.Options["size"]
+	cfg.ThinPool, _ = req.Options["thinpool"]
+	cfg.Snapshot, _ = req.Options["snapshot"]
+	cfg.KeyFile, _ = req.Options["keyfile"]
+	cfg.VolumeGroup, _ = req.Options["volumegroup"]
+	cfg.FsType, _ = req.Options["fstype"]
+	avoid, _ = req.Options["avoid"]
+	from, _ = req.Options["from"]
+	populate, _ = req.Options["populate"]
+
+	err = parseLayoutOptions(req.Options, &cfg)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"invalid layout options")
+		return
+	}
+
+	mountOpts, err = lib.ParseMountOptions(cfg.FsType, req.Options["mountopts"])
+	if err != nil {
+		err = errors.Wrapf(err,
+			"invalid mount options")
+		return
+	}
+
+	cfg.FsType = mountOpts.FsType
+	formatter, err = lib.GetFormatter(cfg.FsType)
+	if err != nil {
+		return
+	}
+
+	formatOpts = lib.FormatOptionsFromMap(req.Options, lib.MkfsOptionPrefix)
+	err = formatter.Validate(formatOpts)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"invalid format options")
+		return
+	}
 
-	if volumegroup == "" {
-		vgs, err = d.lvm.ListVolumeGroups()
+	if len(formatOpts) > 0 && (cfg.Snapshot != "" || from != "") {
+		err = errors.Errorf(
+			"format options can't be used with snapshots or clones")
+		return
+	}
+
+	if populate != "" {
+		if cfg.Snapshot != "" || from != "" || cfg.KeyFile != "" {
+			err = errors.Errorf(
+				"populate can't be used with snapshots, clones or encrypted volumes")
+			return
+		}
+
+		if cfg.FsType == lib.FsTypeNone {
+			err = errors.Errorf(
+				"populate requires a filesystem")
+			return
+		}
+
+		populate, err = lib.ResolvePopulateSource(d.populateRoot, populate)
 		if err != nil {
 			err = errors.Wrapf(err,
-				"failed to list volume groups")
+				"invalid populate source")
 			return
 		}
+	}
 
-		if len(d.vgWhiteList) > 0 {
-			validVgs = make([]*lib.VolumeGroup, 0)
-			for _, potentialVg := range vgs {
-				_, present := d.vgWhiteList[potentialVg.Name]
-				if present {
-					validVgs = append(validVgs, potentialVg)
-				}
+	if value, found := req.Options["sparse"]; found {
+		sparse, err = strconv.ParseBool(value)
+		if err != nil {
+			err = errors.Errorf(
+				"sparse must be true or false - got %s", value)
+			return
+		}
+	}
+
+	if value, found := req.Options["freezetimeout"]; found {
+		freeze, err = time.ParseDuration(value)
+		if err != nil || freeze < 0 {
+			err = errors.Errorf(
+				"freezetimeout must be a non-negative duration - got %s",
+				value)
+			return
+		}
+	}
+
+	if d.caps != nil {
+		err = d.caps.CheckCreationConfig(cfg)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"unsupported options")
+			return
+		}
+	}
+
+	inv, err = d.lvm.GetFreshInventory()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to retrieve lvm inventory")
+		return
+	}
+
+	if avoid != "" {
+		if len(cfg.PhysicalVolumes) > 0 {
+			err = errors.Errorf(
+				"avoid and pvs options can't be used together")
+			return
+		}
+
+		avoided, err = inv.LogicalVolume(avoid)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"errored searching for volume named %s",
+				avoid)
+			return
+		}
+
+		if avoided == nil {
+			err = errors.Errorf(
+				"volume %s to avoid not found", avoid)
+			return
+		}
+
+		if cfg.VolumeGroup == "" {
+			cfg.VolumeGroup = avoided.VgName
+		}
+
+		if cfg.VolumeGroup != avoided.VgName {
+			err = errors.Errorf(
+				"volume %s to avoid is not in volume group %s",
+				avoid, cfg.VolumeGroup)
+			return
+		}
+	}
+
+	if cfg.Snapshot != "" {
+		origin, err = snapshotOrigin(inv, cfg)
+		if err != nil {
+			return
+		}
+
+		cfg.VolumeGroup = origin.VgName
+		cfg.ThinSnapshot = origin.PoolLv != ""
+	}
+
+	if from != "" {
+		source, err = inv.LogicalVolume(from)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"errored searching for volume %s to clone", from)
+			return
+		}
+
+		if source == nil {
+			err = errors.Errorf(
+				"volume %s to clone not found", from)
+			return
+		}
+
+	}
+
+	copied := origin
+	if source != nil {
+		copied = source
+	}
+
+	cfg.Tags, err = d.creationTags(copied, mountOpts, req.Options)
+	if err != nil {
+		return
+	}
+
+	cfg.Tags = append(cfg.Tags, formatOpts.Tags()...)
+
+	if fsck, found := req.Options["fsck"]; found {
+		var policy lib.FsckPolicy
+
+		policy, err = lib.ParseFsckPolicy(fsck)
+		if err != nil {
+			return
+		}
+
+		cfg.Tags = append(cfg.Tags, lib.FsckPolicyTagPrefix+string(policy))
+	}
+
+	if uuid, found := req.Options["uuid"]; found {
+		var policy lib.UuidPolicy
+
+		policy, err = lib.ParseUuidPolicy(uuid)
+		if err != nil {
+			return
+		}
+
+		cfg.Tags = append(cfg.Tags, lib.UuidPolicyTagPrefix+string(policy))
+	}
+
+	if source != nil {
+		cfg, err = lib.BuildCloneConfig(cfg, source)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"invalid clone of volume %s", from)
+			return
+		}
+	}
+
+	if cfg.Size != "" && cfg.ThinPool == "" {
+		needed, err = lib.ParseByteSize(cfg.Size)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"invalid size %s", cfg.Size)
+			return
+		}
+	}
+
+	if cfg.VolumeGroup == "" {
+		required = lib.RequiredPhysicalVolumes(cfg)
+		validVgs = make([]*lib.VolumeGroup, 0)
+		for _, potentialVg := range inv.VolumeGroups {
+			if len(d.vgWhiteList) > 0 && !d.vgWhiteList[potentialVg.Name] {
+				continue
 			}
-		} else {
-			validVgs = vgs
+
+			if uint64(potentialVg.PvCount) < required {
+				continue
+			}
+
+			validVgs = append(validVgs, potentialVg)
 		}
 
-		vg, err = lib.PickBestVolumeGroup(0, validVgs)
+		vg, err = lib.PickBestVolumeGroup(needed, validVgs)
 		if err != nil {
 			err = errors.Wrapf(err,
 				"failed to pick the best volume group")
@@ -174,30 +470,204 @@ func (d Driver) Create(req *v.CreateRequest) (err error) {
 			err = errors.Errorf(
 				"didn't find suitable vg for specified size")
 			return
-		} else {
-			volumegroup = vg.Name
+		}
+
+		cfg.VolumeGroup = vg.Name
+	} else {
+		vg = inv.VolumeGroup(cfg.VolumeGroup)
+		if vg == nil {
+			err = errors.Errorf(
+				"volume group %s not found",
+				cfg.VolumeGroup)
+			return
 		}
 	}
 
-	err = d.lvm.CreateLv(lib.LvCreationConfig{
-		Name:        req.Name,
-		Size:        size,
-		ThinPool:    thinpool,
-		Snapshot:    snapshot,
-		KeyFile:     keyfile,
-		VolumeGroup: volumegroup,
-		FsType:      fstype,
-	})
+	if avoided != nil {
+		cfg.PhysicalVolumes, err = inv.PhysicalVolumesAvoiding(avoided)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't find the physical volumes of %s",
+				avoid)
+			return
+		}
+
+		if len(cfg.PhysicalVolumes) == 0 {
+			err = errors.Errorf(
+				"no physical volumes left in %s outside of %s",
+				avoided.VgName, avoid)
+			return
+		}
+	}
+
+	err = lib.ValidateLogicalVolumeLayout(cfg, vg, inv.PhysicalVolumes)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"volume group %s can't accomodate the requested layout",
+			vg.Name)
+		return
+	}
+
+	switch {
+	case source != nil:
+		// thick volumes are copied block by block, which
+		// can take minutes.
+		err = d.unlocked(req.Name, func() error {
+			return d.lvm.CloneVolume(cfg, source, lib.CloneOptions{
+				Sparse:        sparse,
+				FreezeTimeout: freeze,
+				Progress: func(copied, total int64) {
+					d.logger.Info().
+						Str("name", req.Name).
+						Str("from", from).
+						Int64("copied", copied).
+						Int64("total", total).
+						Msg("cloning volume")
+				},
+			})
+		})
+	case origin != nil:
+		err = d.lvm.CreateSnapshot(cfg, origin, freeze)
+	default:
+		err = d.lvm.CreateLv(cfg)
+	}
+
 	if err != nil {
 		err = errors.Wrapf(err, "failed to create logical volume")
 		return
 	}
 
+	if populate != "" {
+		err = d.unlocked(req.Name, func() error {
+			return d.populateVolume(cfg, populate)
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// unlocked runs 'fn', which might take long, without holding
+// the driver's lock such that calls about other volumes don't
+// wait for it. Meanwhile, the volume 'name' is marked as being
+// created, which calls about it refuse (see checkNotCreating).
+// The lock must be held when calling it, and is held again
+// when it returns.
+func (d *Driver) unlocked(name string, fn func() error) (err error) {
+	d.creating[name] = true
+	d.Unlock()
+
+	defer func() {
+		d.Lock()
+		delete(d.creating, name)
+	}()
+
+	err = fn()
+	return
+}
+
+// checkNotCreating errors if the volume 'name' is still being
+// created (see unlocked).
+func (d *Driver) checkNotCreating(name string) (err error) {
+	if d.creating[name] {
+		err = errors.Errorf(
+			"volume %s is still being created", name)
+		return
+	}
+
+	return
+}
+
+// populateVolume fills a volume that was just created with
+// the content at 'source', removing the volume if that fails.
+// As it can take long, it runs without the driver's lock.
+func (d *Driver) populateVolume(cfg lib.LvCreationConfig, source string) (err error) {
+	var vol *lib.LogicalVolume
+
+	vol, err = d.lvm.GetLogicalVolume(cfg.VolumeGroup + "/" + cfg.Name)
+	if err == nil && vol == nil {
+		err = errors.Errorf("volume %s not found after creation", cfg.Name)
+	}
+
+	if err == nil {
+		d.logger.Info().
+			Str("name", cfg.Name).
+			Str("source", source).
+			Msg("populating volume")
+
+		err = d.lvm.PopulateVolume(vol, source)
+	}
+
+	if err == nil {
+		return
+	}
+
+	removeErr := d.lvm.RemoveLv(lib.LvRemovalConfig{
+		LvName: cfg.Name,
+		VgName: cfg.VolumeGroup,
+	})
+	if removeErr != nil {
+		d.logger.Error().
+			Err(removeErr).
+			Str("name", cfg.Name).
+			Msg("couldn't remove volume that failed to be populated")
+	}
+
+	return
+}
+
+// snapshotOrigin looks up the origin of a snapshot being
+// created, which lives in the volume group of the snapshot.
+func snapshotOrigin(inv *lib.Inventory, cfg lib.LvCreationConfig) (origin *lib.LogicalVolume, err error) {
+	var originName = cfg.Snapshot
+
+	if cfg.VolumeGroup != "" {
+		originName = cfg.VolumeGroup + "/" + cfg.Snapshot
+	}
+
+	origin, err = inv.LogicalVolume(originName)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"errored searching for snapshot origin %s",
+			originName)
+		return
+	}
+
+	if origin == nil {
+		err = errors.Errorf(
+			"snapshot origin %s not found", originName)
+		return
+	}
+
 	return
 }
 
-func (d Driver) List() (resp *v.ListResponse, err error) {
-	var vols []*lib.LogicalVolume
+// creationTags computes the tags that persist the mount
+// options of a volume being created. Snapshots taken without
+// explicit fstype and mount options keep the ones of their
+// origin as they share its filesystem.
+func (d *Driver) creationTags(origin *lib.LogicalVolume, opts lib.MountOptions, reqOpts map[string]string) (tags []string, err error) {
+	_, hasFsType := reqOpts["fstype"]
+	_, hasMountOpts := reqOpts["mountopts"]
+
+	if origin == nil || hasFsType || hasMountOpts {
+		tags = opts.Tags()
+		return
+	}
+
+	opts, err = lib.VolumeMountOptions(origin)
+	if err != nil {
+		return
+	}
+
+	tags = opts.Tags()
+	return
+}
+
+func (d *Driver) List() (resp *v.ListResponse, err error) {
+	var inv *lib.Inventory
 
 	d.logger.Debug().
 		Msg("starting list")
@@ -208,14 +678,25 @@ func (d Driver) List() (resp *v.ListResponse, err error) {
 	d.logger.Debug().
 		Msg("listing volumes")
 
-	vols, err = d.lvm.ListLogicalVolumes()
+	inv, err = d.lvm.GetInventory()
 	if err != nil {
 		err = errors.Wrapf(err, "couldn't list volumes")
 		return
 	}
 
+	stats := d.lvm.InventoryStats()
+	d.logger.Debug().
+		Uint64("hits", stats.Hits).
+		Uint64("misses", stats.Misses).
+		Msg("inventory cache stats")
+
 	var volumesList = make([]*v.Volume, 0)
-	for _, vol := range vols {
+	for _, vol := range inv.LogicalVolumes() {
+		attr, err := lib.ParseLvAttr(vol.LvAttr)
+		if err == nil && attr.IsThinPool() {
+			continue
+		}
+
 		volumesList = append(volumesList, &v.Volume{
 			Name: vol.LvName,
 		})
@@ -227,10 +708,11 @@ func (d Driver) List() (resp *v.ListResponse, err error) {
 	return
 }
 
-func (d Driver) Get(req *v.GetRequest) (resp *v.GetResponse, err error) {
+func (d *Driver) Get(req *v.GetRequest) (resp *v.GetResponse, err error) {
 	var (
 		mountpoint string
 		vol        *lib.LogicalVolume
+		fsckResult *lib.FsckResult
 	)
 
 	d.logger.Debug().
@@ -240,6 +722,11 @@ func (d Driver) Get(req *v.GetRequest) (resp *v.GetResponse, err error) {
 	d.Lock()
 	defer d.Unlock()
 
+	err = d.checkNotCreating(req.Name)
+	if err != nil {
+		return
+	}
+
 	vol, err = d.lvm.GetLogicalVolume(req.Name)
 	if err != nil {
 		err = errors.Wrapf(err,
@@ -268,10 +755,25 @@ func (d Driver) Get(req *v.GetRequest) (resp *v.GetResponse, err error) {
 		},
 	}
 
+	fsckResult, err = lib.VolumeFsckResult(vol)
+	if err != nil {
+		return
+	}
+
+	if fsckResult != nil {
+		resp.Volume.Status = map[string]interface{}{
+			"fsck": map[string]interface{}{
+				"status":    fsckResult.Status,
+				"exitCode":  fsckResult.ExitCode,
+				"checkedAt": fsckResult.CheckedAt,
+			},
+		}
+	}
+
 	return
 }
 
-func (d Driver) Remove(req *v.RemoveRequest) (err error) {
+func (d *Driver) Remove(req *v.RemoveRequest) (err error) {
 	var (
 		vol             *lib.LogicalVolume
 		mountpointFound bool
@@ -284,6 +786,11 @@ func (d Driver) Remove(req *v.RemoveRequest) (err error) {
 	d.Lock()
 	defer d.Unlock()
 
+	err = d.checkNotCreating(req.Name)
+	if err != nil {
+		return
+	}
+
 	vol, err = d.lvm.GetLogicalVolume(req.Name)
 	if err != nil {
 		err = errors.Wrapf(err,
@@ -298,6 +805,14 @@ func (d Driver) Remove(req *v.RemoveRequest) (err error) {
 		return
 	}
 
+	if group, found := lib.VolumeSnapshotGroup(vol); found {
+		err = errors.Errorf(
+			"volume %s is part of the snapshot group %s, "+
+				"which can only be removed as a whole",
+			req.Name, group)
+		return
+	}
+
 	_, mountpointFound, err = d.dirManager.Get(req.Name)
 	if err != nil {
 		err = errors.Wrapf(err,
@@ -323,7 +838,7 @@ func (d Driver) Remove(req *v.RemoveRequest) (err error) {
 	return
 }
 
-func (d Driver) Path(req *v.PathRequest) (resp *v.PathResponse, err error) {
+func (d *Driver) Path(req *v.PathRequest) (resp *v.PathResponse, err error) {
 	var (
 		mountpoint string
 		vol        *lib.LogicalVolume
@@ -336,6 +851,11 @@ func (d Driver) Path(req *v.PathRequest) (resp *v.PathResponse, err error) {
 	d.Lock()
 	defer d.Unlock()
 
+	err = d.checkNotCreating(req.Name)
+	if err != nil {
+		return
+	}
+
 	vol, err = d.lvm.GetLogicalVolume(req.Name)
 	if err != nil {
 		err = errors.Wrapf(err,
@@ -365,34 +885,17 @@ func (d Driver) Path(req *v.PathRequest) (resp *v.PathResponse, err error) {
 	return
 }
 
-func (d Driver) IsLocationMounted(location string) (isMounted bool, err error) {
-	var infos []*lib.MountInfo
-
-	infos, err = lib.ParseMountsFile(d.mountsFile)
-	if err != nil {
-		err = errors.Wrapf(err,
-			"failed to parse mounts from file %s",
-			d.mountsFile)
-		return
-	}
-
-	for _, info := range infos {
-		if info.Location == location {
-			isMounted = true
-			return
-		}
-	}
-
-	return
-}
-
-func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
+func (d *Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 	var (
 		vol         *lib.LogicalVolume
+		attr        *lib.LvAttr
 		mountpoint  string
 		found       bool
 		isFormatted bool
-		isMounted   bool
+		sig         *lib.FsSignature
+		status      *lib.VolumeMountStatus
+		mountOpts   lib.MountOptions
+		formatOpts  lib.FormatOptions
 	)
 
 	d.logger.Debug().
@@ -403,6 +906,11 @@ func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 	d.Lock()
 	defer d.Unlock()
 
+	err = d.checkNotCreating(req.Name)
+	if err != nil {
+		return
+	}
+
 	vol, err = d.lvm.GetLogicalVolume(req.Name)
 	if err != nil {
 		err = errors.Wrapf(err,
@@ -411,6 +919,35 @@ func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 		return
 	}
 
+	if vol == nil {
+		err = errors.Errorf(
+			"logical volume %s not found in LVM",
+			req.Name)
+		return
+	}
+
+	attr, err = lib.ParseLvAttr(vol.LvAttr)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't parse attributes of volume %s",
+			req.Name)
+		return
+	}
+
+	if attr.IsThinPool() {
+		err = errors.Errorf(
+			"volume %s is a thin pool and can't be mounted",
+			req.Name)
+		return
+	}
+
+	if !attr.IsActive() {
+		err = errors.Errorf(
+			"volume %s is not active (state: %s)",
+			req.Name, attr.State)
+		return
+	}
+
 	mountpoint, found, err = d.dirManager.Get(req.Name)
 	if err != nil {
 		err = errors.Errorf(
@@ -427,19 +964,6 @@ func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 				req.Name)
 			return
 		}
-	} else {
-		isMounted, err = d.IsLocationMounted(mountpoint)
-		if err != nil {
-			err = errors.Wrapf(err, "failed retrieving mount info list")
-			return
-		}
-
-		if isMounted {
-			resp = &v.MountResponse{
-				Mountpoint: mountpoint,
-			}
-			return
-		}
 	}
 
 	if vol.LvDmPath == "" {
@@ -449,7 +973,39 @@ func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 		return
 	}
 
-	isFormatted, err = d.lvm.IsDeviceFormatted(vol.LvDmPath)
+	formatOpts, err = lib.VolumeFormatOptions(vol)
+	if err != nil {
+		return
+	}
+
+	status, err = d.lvm.GetVolumeMountStatus(vol, mountpoint)
+	if err != nil {
+		err = errors.Wrapf(err, "failed retrieving mount status")
+		return
+	}
+
+	if status.MountedAt {
+		resp = &v.MountResponse{
+			Mountpoint: mountpoint,
+		}
+		return
+	}
+
+	if len(status.Foreign) > 0 {
+		err = errors.Errorf(
+			"mountpoint %s of volume %s is taken by device %s",
+			mountpoint, req.Name, status.Foreign[0].Device)
+		return
+	}
+
+	if len(status.Elsewhere) > 0 {
+		err = errors.Errorf(
+			"volume %s is already mounted at %s",
+			req.Name, status.Elsewhere[0].Location)
+		return
+	}
+
+	sig, err = d.lvm.DeviceSignature(vol.LvDmPath)
 	if err != nil {
 		err = errors.Errorf(
 			"couldn't check if device %s is formated",
@@ -457,16 +1013,35 @@ func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 		return
 	}
 
+	mountOpts, err = volumeMountOptions(vol, sig)
+	if err != nil {
+		return
+	}
+
+	isFormatted = sig != nil
+	if isFormatted {
+		err = d.checkFilesystem(vol, sig)
+		if err != nil {
+			return
+		}
+
+		mountOpts, err = d.prepareUuid(vol, mountOpts)
+		if err != nil {
+			return
+		}
+	}
+
 	if !isFormatted {
-		err = d.lvm.FormatDevice(vol.LvDmPath, "ext4")
+		err = d.lvm.FormatDevice(vol.LvDmPath, mountOpts.FsType, formatOpts)
 		if err != nil {
-			err = errors.Errorf(
+			err = errors.Wrapf(err,
 				"couldn't format device %s as %s",
-				vol.LvDmPath, "ext4")
+				vol.LvDmPath, mountOpts.FsType)
+			return
 		}
 	}
 
-	err = d.lvm.Mount(vol.LvDmPath, mountpoint)
+	err = d.lvm.Mount(vol.LvDmPath, mountpoint, mountOpts)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"failed to mount device %s to location %s",
@@ -482,10 +1057,130 @@ func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 	return
 }
 
-func (d Driver) Unmount(req *v.UnmountRequest) (err error) {
+// volumeMountOptions computes the options to mount a volume
+// whose device holds 'sig' (nil if it's blank) with. Volumes
+// not created by golvm mount with the filesystem they hold.
+func volumeMountOptions(vol *lib.LogicalVolume, sig *lib.FsSignature) (opts lib.MountOptions, err error) {
+	opts, err = lib.VolumeMountOptions(vol)
+	if err != nil {
+		return
+	}
+
+	if opts.FsType == lib.FsTypeNone {
+		err = errors.Errorf(
+			"volume %s has no filesystem and can't be mounted",
+			vol.LvName)
+		return
+	}
+
+	opts, err = lib.ProbedMountOptions(vol, opts, sig)
+	return
+}
+
+// checkFilesystem checks the filesystem of a volume that is
+// about to be mounted according to its fsck policy (or the
+// driver's), recording the result in the volume's tags. The
+// checker is picked after the filesystem found in the device
+// ('sig') rather than the one the volume is tagged with.
+// Filesystems with errors that couldn't be corrected are not
+// to be mounted.
+func (d *Driver) checkFilesystem(vol *lib.LogicalVolume, sig *lib.FsSignature) (err error) {
+	var (
+		policy lib.FsckPolicy
+		found  bool
+		result lib.FsckResult
+	)
+
+	policy, found, err = lib.VolumeFsckPolicy(vol)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		policy = d.fsckPolicy
+	}
+
+	result, err = d.lvm.CheckFilesystem(vol.LvDmPath, sig.Type, policy)
+	if err != nil {
+		return
+	}
+
+	if result.Status != lib.FsckSkipped {
+		tagsErr := d.lvm.ReplaceTags(vol, lib.FsckResultTagPrefix, result.Tags())
+		if tagsErr != nil {
+			d.logger.Warn().
+				Err(tagsErr).
+				Str("name", vol.LvName).
+				Msg("couldn't record fsck result")
+		}
+	}
+
+	if !result.Mountable() {
+		err = errors.Errorf(
+			"refusing to mount volume %s: filesystem check %s "+
+				"(exit code %d). Output:\n%s\n",
+			vol.LvName, result.Status, result.ExitCode, result.Output)
+		return
+	}
+
+	return
+}
+
+// prepareUuid deals with the filesystem UUID of volumes that
+// are copies of others (e.g., snapshots) according to their
+// UUID policy: either the mount options get 'nouuid' or the
+// UUID is regenerated, once, before the first mount.
+func (d *Driver) prepareUuid(vol *lib.LogicalVolume, opts lib.MountOptions) (prepared lib.MountOptions, err error) {
+	var policy lib.UuidPolicy
+
+	prepared = opts
+
+	policy, err = lib.VolumeUuidPolicy(vol)
+	if err != nil {
+		return
+	}
+
+	policy, err = lib.ResolveUuidPolicy(policy, opts.FsType, lib.IsVolumeCopy(vol))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"invalid uuid policy for volume %s", vol.LvName)
+		return
+	}
+
+	switch policy {
+	case lib.UuidNouuid:
+		prepared = opts.WithNouuid()
+	case lib.UuidRegenerate:
+		if vol.LvTags.Contains(lib.UuidRegeneratedTag) {
+			return
+		}
+
+		err = d.lvm.RegenerateUuid(vol.LvDmPath, opts.FsType)
+		if err != nil {
+			return
+		}
+
+		err = d.lvm.ReplaceTags(vol, lib.UuidRegeneratedTag,
+			[]string{lib.UuidRegeneratedTag})
+		if err != nil {
+			return
+		}
+
+		d.logger.Info().
+			Str("name", vol.LvName).
+			Str("origin", vol.Origin).
+			Msg("filesystem uuid regenerated")
+	}
+
+	return
+}
+
+func (d *Driver) Unmount(req *v.UnmountRequest) (err error) {
 	var (
+		vol        *lib.LogicalVolume
 		mountpoint string
 		found      bool
+		status     *lib.VolumeMountStatus
 	)
 
 	d.logger.Debug().
@@ -496,6 +1191,11 @@ func (d Driver) Unmount(req *v.UnmountRequest) (err error) {
 	d.Lock()
 	defer d.Unlock()
 
+	err = d.checkNotCreating(req.Name)
+	if err != nil {
+		return
+	}
+
 	mountpoint, found, err = d.dirManager.Get(req.Name)
 	if err != nil {
 		err = errors.Errorf(
@@ -508,7 +1208,32 @@ func (d Driver) Unmount(req *v.UnmountRequest) (err error) {
 		return
 	}
 
-	err = d.lvm.Unmount(mountpoint)
+	vol, err = d.lvm.GetLogicalVolume(req.Name)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"errored searching for volume named %s",
+			req.Name)
+		return
+	}
+
+	if vol != nil && vol.LvDmPath != "" {
+		status, err = d.lvm.GetVolumeMountStatus(vol, mountpoint)
+		if err != nil {
+			err = errors.Wrapf(err, "failed retrieving mount status")
+			return
+		}
+
+		if !status.MountedAt {
+			d.logger.Debug().
+				Str("name", req.Name).
+				Str("mountpoint", mountpoint).
+				Int("foreign-mounts", len(status.Foreign)).
+				Msg("volume not mounted")
+			return
+		}
+	}
+
+	err = d.lvm.Unmount(mountpoint, d.unmountPolicy)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"failed to unmount volume %s from %s",
@@ -519,7 +1244,7 @@ func (d Driver) Unmount(req *v.UnmountRequest) (err error) {
 	return
 }
 
-func (d Driver) Capabilities() (resp *v.CapabilitiesResponse) {
+func (d *Driver) Capabilities() (resp *v.CapabilitiesResponse) {
 	d.logger.Debug().
 		Msg("starting capabilities")
 
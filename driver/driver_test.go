@@ -0,0 +1,110 @@
+package driver
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cirocosta/golvm/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// xfsSuperblock builds the start of an XFS filesystem.
+func xfsSuperblock() []byte {
+	var img = make([]byte, 4096)
+
+	copy(img, "XFSB")
+	return img
+}
+
+func TestVolumeMountOptions(t *testing.T) {
+	xfs, err := lib.ProbeFilesystem(bytes.NewReader(xfsSuperblock()))
+	require.NoError(t, err)
+	require.NotNil(t, xfs)
+
+	var testCases = []struct {
+		desc        string
+		tags        lib.StringList
+		sig         *lib.FsSignature
+		expected    string
+		shouldError bool
+	}{
+		{
+			desc:     "untagged xfs mounts as xfs",
+			sig:      xfs,
+			expected: "xfs",
+		},
+		{
+			desc:     "untagged ext3 mounts as ext3",
+			sig:      &lib.FsSignature{Type: "ext3"},
+			expected: "ext3",
+		},
+		{
+			desc:     "untagged blank device gets the default",
+			expected: lib.DefaultFsType,
+		},
+		{
+			desc:     "tagged",
+			tags:     lib.StringList{"golvm/fstype=xfs"},
+			sig:      xfs,
+			expected: "xfs",
+		},
+		{
+			desc:        "tagged with another filesystem",
+			tags:        lib.StringList{"golvm/fstype=ext4"},
+			sig:         xfs,
+			shouldError: true,
+		},
+		{
+			desc:        "untagged with xfs-only options",
+			tags:        lib.StringList{"golvm/mountopt=inode64"},
+			sig:         xfs,
+			shouldError: true,
+		},
+		{
+			desc:        "untagged luks",
+			sig:         &lib.FsSignature{Type: "crypto_LUKS"},
+			shouldError: true,
+		},
+		{
+			desc:        "no filesystem",
+			tags:        lib.StringList{"golvm/fstype=none"},
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts, err := volumeMountOptions(&lib.LogicalVolume{
+				LvName: "vol",
+				LvTags: tc.tags,
+			}, tc.sig)
+			if tc.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, opts.FsType)
+		})
+	}
+}
+
+func TestDriver_unlocked(t *testing.T) {
+	var d = Driver{creating: map[string]bool{}}
+
+	d.Lock()
+	err := d.unlocked("vol", func() error {
+		// other calls get through meanwhile
+		d.Lock()
+		defer d.Unlock()
+
+		assert.Error(t, d.checkNotCreating("vol"))
+		assert.NoError(t, d.checkNotCreating("other"))
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, d.checkNotCreating("vol"))
+	d.Unlock()
+}
@@ -0,0 +1,54 @@
+package driver
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cirocosta/golvm/lib"
+	"github.com/pkg/errors"
+)
+
+// parseLayoutOptions fills the striping and raid related
+// fields of a creation configuration from the options that
+// came with a docker volume creation request.
+func parseLayoutOptions(opts map[string]string, cfg *lib.LvCreationConfig) (err error) {
+	var value string
+
+	cfg.Type, _ = opts["type"]
+	cfg.StripeSize, _ = opts["stripesize"]
+
+	value, _ = opts["stripes"]
+	if value != "" {
+		cfg.Stripes, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"stripes must be a positive number")
+			return
+		}
+	}
+
+	value, _ = opts["mirrors"]
+	if value != "" {
+		cfg.Mirrors, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"mirrors must be a positive number")
+			return
+		}
+	}
+
+	value, _ = opts["pvs"]
+	if value != "" {
+		for _, pv := range strings.Split(value, ",") {
+			pv = strings.TrimSpace(pv)
+			if pv == "" {
+				continue
+			}
+
+			cfg.PhysicalVolumes = append(cfg.PhysicalVolumes, pv)
+		}
+	}
+
+	err = lib.ValidateLayoutOptions(*cfg)
+	return
+}
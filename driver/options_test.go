@@ -0,0 +1,73 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/cirocosta/golvm/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLayoutOptions(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		opts        map[string]string
+		expected    lib.LvCreationConfig
+		shouldError bool
+	}{
+		{
+			desc:        "no options",
+			opts:        map[string]string{},
+			expected:    lib.LvCreationConfig{},
+			shouldError: false,
+		},
+		{
+			desc: "invalid stripes should fail",
+			opts: map[string]string{
+				"stripes": "two",
+			},
+			shouldError: true,
+		},
+		{
+			desc: "raid10 with pvs",
+			opts: map[string]string{
+				"type":    "raid10",
+				"stripes": "2",
+				"mirrors": "1",
+				"pvs":     "/dev/sdb, /dev/sdc,/dev/sdd,/dev/sde",
+			},
+			expected: lib.LvCreationConfig{
+				Type:    "raid10",
+				Stripes: 2,
+				Mirrors: 1,
+				PhysicalVolumes: []string{
+					"/dev/sdb", "/dev/sdc",
+					"/dev/sdd", "/dev/sde",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			desc: "mirrors without raid should fail",
+			opts: map[string]string{
+				"mirrors": "1",
+			},
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var cfg lib.LvCreationConfig
+
+			err := parseLayoutOptions(tc.opts, &cfg)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, cfg)
+		})
+	}
+}
@@ -0,0 +1,964 @@
+package lib
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// ArchiveKind is the way that the data of a volume is laid out
+// in an archive.
+type ArchiveKind string
+
+const (
+	// ArchiveRaw holds a block image of the volume. Only
+	// the chunks that are not all zeros are stored.
+	ArchiveRaw ArchiveKind = "raw"
+
+	// ArchiveFs holds the files of the filesystem of the
+	// volume.
+	ArchiveFs ArchiveKind = "fs"
+)
+
+const (
+	// ArchiveVersion is the version of the archive format
+	// written by ArchiveWriter.
+	ArchiveVersion = 1
+
+	// ArchiveManifestName is the first entry of an archive,
+	// describing the volume it holds.
+	ArchiveManifestName = "manifest.json"
+
+	// ArchiveChecksumsName is the last entry of an archive,
+	// listing the sha256 of each of the other entries in the
+	// format of sha256sum(1).
+	ArchiveChecksumsName = "SHA256SUMS"
+
+	archiveBlocksDir = "blocks/"
+	archiveFsDir     = "fs/"
+)
+
+// ArchiveManifest describes the volume held by an archive.
+type ArchiveManifest struct {
+	Version int         `json:"version"`
+	Kind    ArchiveKind `json:"kind"`
+	Name    string      `json:"name"`
+	Size    ByteSize    `json:"size"`
+	FsType  string      `json:"fstype"`
+
+	// Tags persisting the settings of the volume (mount
+	// and format options), which the imported volume gets.
+	Tags []string `json:"tags"`
+}
+
+// ParseArchiveKind validates the kind of an archive, defaulting
+// to ArchiveRaw.
+func ParseArchiveKind(kind string) (parsed ArchiveKind, err error) {
+	switch ArchiveKind(kind) {
+	case "", ArchiveRaw:
+		parsed = ArchiveRaw
+	case ArchiveFs:
+		parsed = ArchiveFs
+	default:
+		err = errors.Errorf(
+			"unknown archive kind %s - must be raw or fs", kind)
+	}
+
+	return
+}
+
+// ArchiveTags picks the tags of a volume that an archive of it
+// should carry.
+func ArchiveTags(vol *LogicalVolume) (tags []string) {
+	for _, tag := range vol.LvTags {
+		if strings.HasPrefix(tag, FsTypeTagPrefix) ||
+			strings.HasPrefix(tag, MountOptionTagPrefix) ||
+			strings.HasPrefix(tag, MkfsTagPrefix) ||
+			strings.HasPrefix(tag, FsckPolicyTagPrefix) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return
+}
+
+// ArchiveWriter writes the archive of a volume: a tar stream
+// (optionally gzipped) with the manifest, the data entries and
+// the checksums of the data entries.
+type ArchiveWriter struct {
+	gz        *gzip.Writer
+	tw        *tar.Writer
+	checksums []string
+}
+
+// NewArchiveWriter starts an archive in 'w' by writing its
+// manifest.
+func NewArchiveWriter(w io.Writer, manifest ArchiveManifest, compress bool) (aw *ArchiveWriter, err error) {
+	var content []byte
+
+	aw = new(ArchiveWriter)
+	if compress {
+		aw.gz = gzip.NewWriter(w)
+		w = aw.gz
+	}
+	aw.tw = tar.NewWriter(w)
+
+	manifest.Version = ArchiveVersion
+	content, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't encode archive manifest")
+		return
+	}
+
+	err = aw.writeFile(ArchiveManifestName, content)
+	return
+}
+
+func (aw *ArchiveWriter) writeFile(name string, content []byte) (err error) {
+	err = aw.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(content)),
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't write header of %s", name)
+		return
+	}
+
+	_, err = aw.tw.Write(content)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't write %s", name)
+		return
+	}
+
+	return
+}
+
+// WriteEntry adds a data entry to the archive, reading its
+// contents (if any) from 'r' and recording its checksum.
+func (aw *ArchiveWriter) WriteEntry(hdr *tar.Header, r io.Reader) (err error) {
+	var hash = sha256.New()
+
+	err = aw.tw.WriteHeader(hdr)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't write header of %s", hdr.Name)
+		return
+	}
+
+	if r != nil {
+		_, err = io.Copy(io.MultiWriter(aw.tw, hash), r)
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't write %s", hdr.Name)
+			return
+		}
+	}
+
+	aw.checksums = append(aw.checksums,
+		hex.EncodeToString(hash.Sum(nil))+"  "+hdr.Name)
+	return
+}
+
+// Close finishes the archive by writing the checksums of its
+// data entries. It doesn't close the underlying writer.
+func (aw *ArchiveWriter) Close() (err error) {
+	var content = []byte(strings.Join(aw.checksums, "\n") + "\n")
+
+	err = aw.writeFile(ArchiveChecksumsName, content)
+	if err != nil {
+		return
+	}
+
+	err = aw.tw.Close()
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't finish archive")
+		return
+	}
+
+	if aw.gz != nil {
+		err = aw.gz.Close()
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't finish compression")
+			return
+		}
+	}
+
+	return
+}
+
+// WriteRawImage adds the block image of 'size' bytes read from
+// 'src' to the archive. Chunks that only contain zeros are
+// left out.
+func (aw *ArchiveWriter) WriteRawImage(src io.ReaderAt, size int64) (err error) {
+	var (
+		buf    = make([]byte, cloneChunkSize)
+		zeros  = make([]byte, cloneChunkSize)
+		offset int64
+		n      int
+	)
+
+	for offset < size {
+		chunk := buf
+		if size-offset < int64(len(chunk)) {
+			chunk = chunk[:size-offset]
+		}
+
+		n, err = src.ReadAt(chunk, offset)
+		if err != nil && !(err == io.EOF && n == len(chunk)) {
+			err = errors.Wrapf(err,
+				"failed to read %d bytes at offset %d",
+				len(chunk), offset)
+			return
+		}
+		err = nil
+
+		if !bytes.Equal(chunk, zeros[:len(chunk)]) {
+			err = aw.WriteEntry(&tar.Header{
+				Name:     archiveBlocksDir + strconv.FormatInt(offset, 10),
+				Typeflag: tar.TypeReg,
+				Mode:     0600,
+				Size:     int64(len(chunk)),
+				ModTime:  time.Now(),
+			}, bytes.NewReader(chunk))
+			if err != nil {
+				return
+			}
+		}
+
+		offset += int64(len(chunk))
+	}
+
+	return
+}
+
+// WriteFilesystemTree adds the files under 'root' to the
+// archive.
+func (aw *ArchiveWriter) WriteFilesystemTree(root string) (err error) {
+	err = filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		var (
+			rel  string
+			link string
+			hdr  *tar.Header
+			f    *os.File
+		)
+
+		if err != nil {
+			return err
+		}
+
+		rel, err = filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+
+		// sockets only make sense while their server runs
+		if rel == "." || info.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(file)
+			if err != nil {
+				return err
+			}
+		}
+
+		hdr, err = tar.FileInfoHeader(info, link)
+		if err != nil {
+			return errors.Wrapf(err, "can't archive %s", file)
+		}
+
+		hdr.Name = archiveFsDir + filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if !info.Mode().IsRegular() {
+			return aw.WriteEntry(hdr, nil)
+		}
+
+		f, err = os.Open(file)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't open %s", file)
+		}
+		defer f.Close()
+
+		return aw.WriteEntry(hdr, f)
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to archive filesystem at %s", root)
+		return
+	}
+
+	return
+}
+
+// ArchiveReader reads archives written by ArchiveWriter,
+// verifying the checksums of their data entries.
+type ArchiveReader struct {
+	Manifest ArchiveManifest
+
+	tr        *tar.Reader
+	checksums map[string]string
+	done      bool
+}
+
+// NewArchiveReader reads the manifest of the archive in 'r',
+// which might be gzipped.
+func NewArchiveReader(r io.Reader) (ar *ArchiveReader, err error) {
+	var (
+		hdr     *tar.Header
+		content []byte
+	)
+
+	ar = &ArchiveReader{checksums: map[string]string{}}
+	ar.tr, err = newTarReader(r)
+	if err != nil {
+		return
+	}
+
+	hdr, err = ar.tr.Next()
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read archive manifest")
+		return
+	}
+
+	if hdr.Name != ArchiveManifestName {
+		err = errors.Errorf(
+			"archive must start with %s - found %s",
+			ArchiveManifestName, hdr.Name)
+		return
+	}
+
+	content, err = ioutil.ReadAll(ar.tr)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read archive manifest")
+		return
+	}
+
+	err = json.Unmarshal(content, &ar.Manifest)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed archive manifest")
+		return
+	}
+
+	if ar.Manifest.Version != ArchiveVersion {
+		err = errors.Errorf(
+			"unsupported archive version %d", ar.Manifest.Version)
+		return
+	}
+
+	_, err = ParseArchiveKind(string(ar.Manifest.Kind))
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// newTarReader reads the tar stream in 'r', decompressing it
+// if gzipped.
+func newTarReader(r io.Reader) (tr *tar.Reader, err error) {
+	var (
+		br    = bufio.NewReader(r)
+		magic []byte
+		gz    *gzip.Reader
+	)
+
+	magic, err = br.Peek(2)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read archive")
+		return
+	}
+
+	if magic[0] != 0x1f || magic[1] != 0x8b {
+		tr = tar.NewReader(br)
+		return
+	}
+
+	gz, err = gzip.NewReader(br)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't decompress archive")
+		return
+	}
+
+	tr = tar.NewReader(gz)
+	return
+}
+
+// next moves to the next data entry, returning io.EOF once
+// the checksums are reached and verified. The contents of the
+// entry must be read through the reader returned, which
+// records their checksum.
+func (ar *ArchiveReader) next() (hdr *tar.Header, r io.Reader, err error) {
+	if ar.done {
+		err = io.EOF
+		return
+	}
+
+	hdr, err = ar.tr.Next()
+	if err == io.EOF {
+		err = errors.Errorf(
+			"archive ended without %s", ArchiveChecksumsName)
+		return
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read archive")
+		return
+	}
+
+	if hdr.Name == ArchiveChecksumsName {
+		err = ar.verify()
+		if err != nil {
+			return
+		}
+
+		ar.done = true
+		err = io.EOF
+		return
+	}
+
+	if _, found := ar.checksums[hdr.Name]; found {
+		err = errors.Errorf("entry %s repeated in archive", hdr.Name)
+		return
+	}
+
+	r = &hashingReader{
+		r:    ar.tr,
+		hash: sha256.New(),
+		done: func(sum string) { ar.checksums[hdr.Name] = sum },
+	}
+	return
+}
+
+// verify checks the checksums of the entries read against the
+// ones listed at the end of the archive.
+func (ar *ArchiveReader) verify() (err error) {
+	var (
+		content  []byte
+		expected = map[string]string{}
+		names    []string
+	)
+
+	content, err = ioutil.ReadAll(ar.tr)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read archive checksums")
+		return
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.SplitN(line, "  ", 2)
+		if len(fields) != 2 {
+			err = errors.Errorf("malformed checksum line '%s'", line)
+			return
+		}
+
+		expected[fields[1]] = fields[0]
+	}
+
+	for name := range ar.checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sum, found := expected[name]
+		if !found {
+			err = errors.Errorf("no checksum for entry %s", name)
+			return
+		}
+
+		if sum != ar.checksums[name] {
+			err = errors.Errorf(
+				"checksum mismatch for entry %s - expected %s, got %s",
+				name, sum, ar.checksums[name])
+			return
+		}
+	}
+
+	if len(expected) != len(ar.checksums) {
+		err = errors.Errorf(
+			"archive is missing entries - expected %d, got %d",
+			len(expected), len(ar.checksums))
+		return
+	}
+
+	return
+}
+
+// hashingReader computes the sha256 of what's read through it,
+// reporting it once the underlying reader is exhausted.
+type hashingReader struct {
+	r    io.Reader
+	hash interface {
+		io.Writer
+		Sum([]byte) []byte
+	}
+	done func(sum string)
+}
+
+func (h *hashingReader) Read(p []byte) (n int, err error) {
+	n, err = h.r.Read(p)
+	h.hash.Write(p[:n])
+	if err == io.EOF {
+		h.done(hex.EncodeToString(h.hash.Sum(nil)))
+	}
+
+	return
+}
+
+// drainEntry reads what's left of an entry such that its checksum
+// gets recorded.
+func drainEntry(r io.Reader) (err error) {
+	_, err = io.Copy(ioutil.Discard, r)
+	return
+}
+
+// ReadRawImage writes the block image held by the archive to
+// 'dst'. Chunks that are not in the archive are only written
+// (as zeros) with 'zeroGaps' - otherwise 'dst' must already
+// read as zeros where they belong (e.g., a thin volume).
+func (ar *ArchiveReader) ReadRawImage(dst io.WriterAt, zeroGaps bool) (err error) {
+	var (
+		hdr    *tar.Header
+		r      io.Reader
+		offset int64
+		next   int64
+		buf    []byte
+		size   = int64(ar.Manifest.Size)
+	)
+
+	if ar.Manifest.Kind != ArchiveRaw {
+		err = errors.Errorf(
+			"archive holds a %s archive, not a raw image",
+			ar.Manifest.Kind)
+		return
+	}
+
+	for {
+		hdr, r, err = ar.next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+
+		if err != nil {
+			return
+		}
+
+		if !strings.HasPrefix(hdr.Name, archiveBlocksDir) {
+			err = errors.Errorf(
+				"unexpected entry %s in raw image", hdr.Name)
+			return
+		}
+
+		offset, err = strconv.ParseInt(
+			strings.TrimPrefix(hdr.Name, archiveBlocksDir), 10, 64)
+		if err != nil || offset < next || offset+hdr.Size > size {
+			err = errors.Errorf(
+				"invalid block %s for image of %d bytes",
+				hdr.Name, size)
+			return
+		}
+
+		if zeroGaps {
+			err = writeZeros(dst, next, offset)
+			if err != nil {
+				return
+			}
+		}
+
+		buf, err = ioutil.ReadAll(r)
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't read block %s", hdr.Name)
+			return
+		}
+
+		_, err = dst.WriteAt(buf, offset)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"failed to write %d bytes at offset %d",
+				len(buf), offset)
+			return
+		}
+
+		err = drainEntry(r)
+		if err != nil {
+			return
+		}
+
+		next = offset + int64(len(buf))
+	}
+
+	if zeroGaps {
+		err = writeZeros(dst, next, size)
+	}
+
+	return
+}
+
+// writeZeros fills 'dst' with zeros from 'start' up to 'end'.
+func writeZeros(dst io.WriterAt, start, end int64) (err error) {
+	if start >= end {
+		return
+	}
+
+	var zeros = make([]byte, cloneChunkSize)
+	for offset := start; offset < end; offset += int64(len(zeros)) {
+		chunk := zeros
+		if end-offset < int64(len(chunk)) {
+			chunk = chunk[:end-offset]
+		}
+
+		_, err = dst.WriteAt(chunk, offset)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"failed to write %d zeros at offset %d",
+				len(chunk), offset)
+			return
+		}
+	}
+
+	return
+}
+
+// ReadFilesystemTree extracts the files held by the archive
+// under 'root'.
+func (ar *ArchiveReader) ReadFilesystemTree(root string) (err error) {
+	var (
+		hdr       *tar.Header
+		r         io.Reader
+		extractor *treeExtractor
+	)
+
+	if ar.Manifest.Kind != ArchiveFs {
+		err = errors.Errorf(
+			"archive holds a %s archive, not a filesystem",
+			ar.Manifest.Kind)
+		return
+	}
+
+	extractor, err = newTreeExtractor(root, archiveFsPath)
+	if err != nil {
+		return
+	}
+
+	for {
+		hdr, r, err = ar.next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+
+		if err != nil {
+			return
+		}
+
+		err = extractor.extract(hdr, r)
+		if err != nil {
+			return
+		}
+
+		err = drainEntry(r)
+		if err != nil {
+			return
+		}
+	}
+
+	extractor.finish()
+	return
+}
+
+// extractedDir is a directory extracted by a treeExtractor.
+type extractedDir struct {
+	target  string
+	modTime time.Time
+}
+
+// treeExtractor extracts the entries of a file tree under a
+// root directory, making sure that nothing gets written outside
+// of it - not even through symlinks extracted before.
+type treeExtractor struct {
+	root string
+	dirs []extractedDir
+
+	// path computes where an entry goes under the root.
+	path func(root, name string) (string, error)
+}
+
+func newTreeExtractor(root string, path func(root, name string) (string, error)) (extractor *treeExtractor, err error) {
+	extractor = &treeExtractor{path: path}
+
+	extractor.root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't resolve %s", root)
+		return
+	}
+
+	return
+}
+
+// target computes where the entry 'name' goes, creating the
+// missing parent directories once it's sure that they don't
+// resolve to somewhere outside of the root.
+func (e *treeExtractor) target(name string) (target string, err error) {
+	var existing string
+
+	target, err = e.path(e.root, name)
+	if err != nil || target == e.root {
+		return
+	}
+
+	existing = filepath.Dir(target)
+	for {
+		_, err = os.Lstat(existing)
+		if err == nil {
+			break
+		}
+
+		if !os.IsNotExist(err) {
+			err = errors.Wrapf(err, "couldn't stat %s", existing)
+			return
+		}
+
+		existing = filepath.Dir(existing)
+	}
+
+	existing, err = filepath.EvalSymlinks(existing)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't resolve parent of %s", name)
+		return
+	}
+
+	if existing != e.root &&
+		!strings.HasPrefix(existing, e.root+string(filepath.Separator)) {
+		err = errors.Errorf("entry %s escapes %s through a symlink", name, e.root)
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't create parent of %s", name)
+		return
+	}
+
+	return
+}
+
+// extract creates the file described by 'hdr', replacing what
+// was there (but directories). Hard links point to entries
+// extracted before.
+func (e *treeExtractor) extract(hdr *tar.Header, r io.Reader) (err error) {
+	var (
+		target string
+		linked string
+		info   os.FileInfo
+	)
+
+	target, err = e.target(hdr.Name)
+	if err != nil {
+		return
+	}
+
+	info, err = os.Lstat(target)
+	switch {
+	case os.IsNotExist(err):
+		err = nil
+	case err != nil:
+		err = errors.Wrapf(err, "couldn't stat %s", target)
+		return
+	case info.IsDir() && hdr.Typeflag == tar.TypeDir:
+	case target == e.root:
+		err = errors.Errorf("entry %s would replace the root", hdr.Name)
+		return
+	default:
+		err = os.RemoveAll(target)
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't replace %s", target)
+			return
+		}
+	}
+
+	if hdr.Typeflag == tar.TypeLink {
+		linked, err = e.target(hdr.Linkname)
+		if err == nil {
+			err = os.Link(linked, target)
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't link %s to %s", hdr.Name, hdr.Linkname)
+			return
+		}
+
+		return
+	}
+
+	err = extractEntry(hdr, r, target)
+	if err != nil {
+		return
+	}
+
+	if hdr.Typeflag == tar.TypeDir {
+		e.dirs = append(e.dirs, extractedDir{target, hdr.ModTime})
+	}
+
+	return
+}
+
+// finish sets the times of the directories extracted, which
+// change as their contents are extracted.
+func (e *treeExtractor) finish() {
+	for _, dir := range e.dirs {
+		os.Chtimes(dir.target, dir.modTime, dir.modTime)
+	}
+}
+
+// archiveFsPath computes where the filesystem entry 'name'
+// goes under 'root', refusing to go outside of it.
+func archiveFsPath(root, name string) (target string, err error) {
+	if !strings.HasPrefix(name, archiveFsDir) {
+		err = errors.Errorf("unexpected entry %s in filesystem", name)
+		return
+	}
+
+	var rel = path.Clean("/" + strings.TrimPrefix(name, archiveFsDir))
+	if rel != "/"+strings.TrimSuffix(strings.TrimPrefix(name, archiveFsDir), "/") {
+		err = errors.Errorf("entry %s escapes the filesystem", name)
+		return
+	}
+
+	target = filepath.Join(root, filepath.FromSlash(rel))
+	return
+}
+
+// extractEntry creates the file described by 'hdr' at
+// 'target'.
+func extractEntry(hdr *tar.Header, r io.Reader, target string) (err error) {
+	var (
+		f    *os.File
+		mode = os.FileMode(hdr.Mode).Perm()
+	)
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		err = os.MkdirAll(target, mode)
+	case tar.TypeReg:
+		f, err = os.OpenFile(target,
+			os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		if err != nil {
+			break
+		}
+
+		_, err = io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	case tar.TypeSymlink:
+		err = os.Symlink(hdr.Linkname, target)
+	case tar.TypeChar:
+		err = unix.Mknod(target, unix.S_IFCHR|uint32(mode),
+			int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+	case tar.TypeBlock:
+		err = unix.Mknod(target, unix.S_IFBLK|uint32(mode),
+			int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+	case tar.TypeFifo:
+		err = unix.Mkfifo(target, uint32(mode))
+	default:
+		err = errors.Errorf(
+			"unsupported type %c of entry %s",
+			hdr.Typeflag, hdr.Name)
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't extract %s", hdr.Name)
+		return
+	}
+
+	// ownership and special bits are kept on a best-effort
+	// basis as they require privileges.
+	if hdr.Typeflag == tar.TypeSymlink {
+		os.Lchown(target, hdr.Uid, hdr.Gid)
+	} else {
+		os.Chown(target, hdr.Uid, hdr.Gid)
+		os.Chmod(target, os.FileMode(hdr.Mode)&os.ModePerm|specialBits(hdr.Mode))
+		os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	}
+
+	// xattrs go last as changing the owner drops some (e.g.,
+	// security.capability).
+	err = setXattrs(target, hdr)
+	return
+}
+
+// paxXattrPrefix prefixes the pax records of a tar entry that
+// hold its extended attributes.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// setXattrs sets the extended attributes recorded in 'hdr' on
+// 'target'.
+func setXattrs(target string, hdr *tar.Header) (err error) {
+	for key, value := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, paxXattrPrefix)
+		err = unix.Lsetxattr(target, name, []byte(value), 0)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't set xattr %s of %s", name, hdr.Name)
+			return
+		}
+	}
+
+	return
+}
+
+// specialBits converts the setuid, setgid and sticky bits of a
+// tar mode to their os.FileMode counterparts.
+func specialBits(mode int64) (bits os.FileMode) {
+	if mode&04000 != 0 {
+		bits |= os.ModeSetuid
+	}
+
+	if mode&02000 != 0 {
+		bits |= os.ModeSetgid
+	}
+
+	if mode&01000 != 0 {
+		bits |= os.ModeSticky
+	}
+
+	return
+}
+
+// String describes the manifest in a single line.
+func (m ArchiveManifest) String() string {
+	return fmt.Sprintf("%s archive of %s (%s, %s)",
+		m.Kind, m.Name, m.Size, m.FsType)
+}
@@ -0,0 +1,280 @@
+package lib
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryDevice is an in-memory block device.
+type memoryDevice struct {
+	data    []byte
+	written int
+}
+
+func (d *memoryDevice) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > int64(len(d.data)) {
+		return 0, io.ErrShortWrite
+	}
+
+	d.written += len(p)
+	return copy(d.data[off:], p), nil
+}
+
+func rawImage() []byte {
+	var data = make([]byte, 3*cloneChunkSize+10)
+
+	copy(data[cloneChunkSize+1:], "hello")
+	copy(data[len(data)-5:], "world")
+	return data
+}
+
+func writeRawArchive(t *testing.T, data []byte, compress bool) []byte {
+	var buf bytes.Buffer
+
+	aw, err := NewArchiveWriter(&buf, ArchiveManifest{
+		Kind:   ArchiveRaw,
+		Name:   "vol",
+		Size:   ByteSize(len(data)),
+		FsType: "xfs",
+		Tags:   []string{"golvm/fstype=xfs"},
+	}, compress)
+	require.NoError(t, err)
+	require.NoError(t, aw.WriteRawImage(bytes.NewReader(data), int64(len(data))))
+	require.NoError(t, aw.Close())
+
+	return buf.Bytes()
+}
+
+func TestArchive_rawImage(t *testing.T) {
+	var data = rawImage()
+
+	for _, compress := range []bool{false, true} {
+		archive := writeRawArchive(t, data, compress)
+
+		ar, err := NewArchiveReader(bytes.NewReader(archive))
+		require.NoError(t, err)
+		assert.Equal(t, ArchiveRaw, ar.Manifest.Kind)
+		assert.Equal(t, ByteSize(len(data)), ar.Manifest.Size)
+		assert.Equal(t, "xfs", ar.Manifest.FsType)
+		assert.Equal(t, []string{"golvm/fstype=xfs"}, ar.Manifest.Tags)
+
+		// zero chunks are not archived nor written back
+		device := &memoryDevice{data: make([]byte, len(data))}
+		require.NoError(t, ar.ReadRawImage(device, false))
+		assert.Equal(t, data, device.data)
+		assert.Equal(t, cloneChunkSize+10, device.written)
+	}
+}
+
+func TestArchive_rawImageZeroesGaps(t *testing.T) {
+	var (
+		data    = rawImage()
+		archive = writeRawArchive(t, data, false)
+		device  = &memoryDevice{data: bytes.Repeat([]byte{0xff}, len(data))}
+	)
+
+	ar, err := NewArchiveReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	require.NoError(t, ar.ReadRawImage(device, true))
+	assert.Equal(t, data, device.data)
+}
+
+func TestArchive_detectsCorruption(t *testing.T) {
+	var archive = writeRawArchive(t, rawImage(), false)
+
+	idx := bytes.Index(archive, []byte("hello"))
+	require.True(t, idx > 0)
+	archive[idx] = 'j'
+
+	ar, err := NewArchiveReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+
+	err = ar.ReadRawImage(&memoryDevice{data: make([]byte, ar.Manifest.Size)}, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+}
+
+func TestArchive_detectsTruncation(t *testing.T) {
+	var archive = writeRawArchive(t, rawImage(), false)
+
+	idx := bytes.Index(archive, []byte(ArchiveChecksumsName))
+	require.True(t, idx > 0)
+
+	ar, err := NewArchiveReader(bytes.NewReader(archive[:idx]))
+	require.NoError(t, err)
+
+	err = ar.ReadRawImage(&memoryDevice{data: make([]byte, ar.Manifest.Size)}, false)
+	assert.Error(t, err)
+}
+
+func TestArchive_filesystemTree(t *testing.T) {
+	var buf bytes.Buffer
+
+	src, err := ioutil.TempDir("", "golvm-archive-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "golvm-archive-dst")
+	require.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "dir", "sub"), 0750))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("content"), 0640))
+	require.NoError(t, os.Symlink("dir/file", filepath.Join(src, "link")))
+
+	aw, err := NewArchiveWriter(&buf, ArchiveManifest{
+		Kind:   ArchiveFs,
+		Name:   "vol",
+		Size:   1 << 20,
+		FsType: "ext4",
+	}, true)
+	require.NoError(t, err)
+	require.NoError(t, aw.WriteFilesystemTree(src))
+	require.NoError(t, aw.Close())
+
+	ar, err := NewArchiveReader(&buf)
+	require.NoError(t, err)
+	require.NoError(t, ar.ReadFilesystemTree(dst))
+
+	content, err := ioutil.ReadFile(filepath.Join(dst, "dir", "file"))
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+
+	info, err := os.Stat(filepath.Join(dst, "dir", "file"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	info, err = os.Stat(filepath.Join(dst, "dir", "sub"))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	link, err := os.Readlink(filepath.Join(dst, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "dir/file", link)
+}
+
+func TestArchive_filesystemTreeRefusesSymlinkEscapes(t *testing.T) {
+	var buf bytes.Buffer
+
+	outside, err := ioutil.TempDir("", "golvm-archive-outside")
+	require.NoError(t, err)
+	defer os.RemoveAll(outside)
+
+	dst, err := ioutil.TempDir("", "golvm-archive-dst")
+	require.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	aw, err := NewArchiveWriter(&buf, ArchiveManifest{
+		Kind: ArchiveFs,
+		Name: "vol",
+		Size: 1 << 20,
+	}, false)
+	require.NoError(t, err)
+
+	// a symlink planted by the archive and then written through
+	require.NoError(t, aw.WriteEntry(&tar.Header{
+		Name:     "fs/x",
+		Typeflag: tar.TypeSymlink,
+		Linkname: outside,
+	}, nil))
+	require.NoError(t, aw.WriteEntry(&tar.Header{
+		Name:     "fs/x/passwd",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     5,
+	}, bytes.NewReader([]byte("owned"))))
+	require.NoError(t, aw.Close())
+
+	ar, err := NewArchiveReader(&buf)
+	require.NoError(t, err)
+
+	err = ar.ReadFilesystemTree(dst)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "escapes")
+
+	_, err = os.Lstat(filepath.Join(outside, "passwd"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestArchive_kindMismatch(t *testing.T) {
+	var archive = writeRawArchive(t, rawImage(), false)
+
+	ar, err := NewArchiveReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	assert.Error(t, ar.ReadFilesystemTree("/tmp"))
+}
+
+func TestArchiveFsPath(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		expected    string
+		shouldError bool
+	}{
+		{"fs/dir/", "/root/dir", false},
+		{"fs/dir/file", "/root/dir/file", false},
+		{"fs/../etc/passwd", "", true},
+		{"fs/dir/../../x", "", true},
+		{"blocks/0", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := archiveFsPath("/root", tc.name)
+			if tc.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, target)
+		})
+	}
+}
+
+func TestNewArchiveReader_requiresManifest(t *testing.T) {
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "blocks/0", Mode: 0600}))
+	require.NoError(t, tw.Close())
+
+	_, err := NewArchiveReader(&buf)
+	assert.Error(t, err)
+}
+
+func TestBuildImportConfig(t *testing.T) {
+	var manifest = ArchiveManifest{
+		Kind:   ArchiveRaw,
+		Name:   "vol",
+		Size:   1 << 30,
+		FsType: "xfs",
+		Tags:   []string{"golvm/fstype=xfs", "golvm/group=g1", "golvm/mountopt=noatime"},
+	}
+
+	cfg, err := BuildImportConfig(LvCreationConfig{Name: "new"}, manifest)
+	require.NoError(t, err)
+	assert.Equal(t, LvCreationConfig{
+		Name:   "new",
+		Size:   "1073741824b",
+		FsType: "xfs",
+		Tags:   []string{"golvm/fstype=xfs", "golvm/mountopt=noatime"},
+	}, cfg)
+
+	cfg, err = BuildImportConfig(LvCreationConfig{Name: "new", Size: "2G"}, manifest)
+	require.NoError(t, err)
+	assert.Equal(t, "2G", cfg.Size)
+
+	_, err = BuildImportConfig(LvCreationConfig{Name: "new", Size: "512M"}, manifest)
+	assert.Error(t, err)
+
+	_, err = BuildImportConfig(LvCreationConfig{Name: "new", KeyFile: "/key"}, manifest)
+	assert.Error(t, err)
+}
@@ -7,56 +7,16 @@ import (
 	"github.com/pkg/errors"
 )
 
-func BuildGetDeviceFormatArgs(device string) (args []string, err error) {
-	if device == "" {
-		err = errors.Errorf("a device must be specified")
-		return
-	}
-
-	args = []string{
-		"--noheadings",
-		"--discard",
-		"--output=FSTYPE",
-		device,
-	}
-
-	return
-}
-
-// BuildMakeFsArgs builds a list of arguments to be used
-// on the 'mkfs' command to properly create a filesystem on
-// a device. It supports two types of FS:
-//	-	xfs
-//	-	ext4
-func BuildMakeFsArgs(fsType, device string) (args []string, err error) {
-	if fsType == "" || device == "" {
-		err = errors.Errorf("both fstype and device must be specified")
-		return
-	}
-
-	args = []string{"-t"}
-
-	switch fsType {
-	case "ext4":
-	case "xfs":
-	default:
-		err = errors.Errorf("unsupported fs type %s", fsType)
-		return
-	}
-
-	args = append(args, fsType, device)
-
-	return
-}
-
 // CreateLogicalVolume creates a logical volume using the definition passed.
 // A VolumeGroup my be specified or not.
 // notes.:
 //	-	a snapshot is a volume that is created from
 //		another volume that must already exist.
+//	-	striping, raid types and explicit physical
+//		volumes only apply to regular volumes.
 func BuildLogicalVolumeCretionArgs(cfg LvCreationConfig) (args []string, err error) {
 	var (
-		isThinSnapshot = false // TODO detect this
+		isThinSnapshot = cfg.Snapshot != "" && cfg.ThinSnapshot
 		isSnapshot     = cfg.Snapshot != ""
 		hasSize        = cfg.Size != ""
 		hasKeyFile     = cfg.KeyFile != ""
@@ -71,6 +31,12 @@ func BuildLogicalVolumeCretionArgs(cfg LvCreationConfig) (args []string, err err
 
 	if cfg.VolumeGroup == "" {
 		err = errors.Errorf("VolumeGroup must be specified")
+		return
+	}
+
+	err = ValidateLayoutOptions(cfg)
+	if err != nil {
+		return
 	}
 
 	if hasKeyFile {
@@ -102,9 +68,6 @@ func BuildLogicalVolumeCretionArgs(cfg LvCreationConfig) (args []string, err err
 			err = errors.Errorf("can't have snapshot with keyfile")
 			return
 		}
-
-		// TODO:check if the volumegroup is thinly provisioned
-		//	if is ==> mark as thinsnap
 	}
 
 	if !hasSize && !isThinSnapshot {
@@ -117,9 +80,20 @@ func BuildLogicalVolumeCretionArgs(cfg LvCreationConfig) (args []string, err err
 		return
 	}
 
+	for _, tag := range cfg.Tags {
+		err = ValidateTag(tag)
+		if err != nil {
+			return
+		}
+	}
+
 	args = []string{"--setactivationskip", "n"}
 	args = append(args, "--name", cfg.Name)
 
+	for _, tag := range cfg.Tags {
+		args = append(args, "--addtag", tag)
+	}
+
 	switch {
 	case isSnapshot:
 		args = append(args, "--snapshot")
@@ -134,8 +108,10 @@ func BuildLogicalVolumeCretionArgs(cfg LvCreationConfig) (args []string, err err
 		args = append(args, "--thin")
 		args = append(args, cfg.VolumeGroup+"/"+cfg.ThinPool)
 	default:
+		args = append(args, buildLayoutArgs(cfg)...)
 		args = append(args, "--size", cfg.Size)
 		args = append(args, cfg.VolumeGroup)
+		args = append(args, cfg.PhysicalVolumes...)
 	}
 
 	return
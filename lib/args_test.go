@@ -7,129 +7,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestBuildGetDeviceFormatArgs(t *testing.T) {
-	var testCases = []struct {
-		desc        string
-		device      string
-		expected    []string
-		shouldError bool
-	}{
-		{
-			desc:        "fail with empty device",
-			device:      "",
-			expected:    []string{},
-			shouldError: true,
-		},
-		{
-			desc:   "works with device",
-			device: "/dev/device",
-			expected: []string{
-				"--noheadings",
-				"--discard",
-				"--output=FSTYPE",
-				"/dev/device",
-			},
-			shouldError: false,
-		},
-	}
-
-	var (
-		err  error
-		args []string
-	)
-
-	for _, tc := range testCases {
-		t.Run(tc.desc, func(t *testing.T) {
-			args, err = BuildGetDeviceFormatArgs(tc.device)
-			if tc.shouldError {
-				require.Error(t, err)
-				return
-			}
-
-			require.NoError(t, err)
-			require.Equal(t, len(tc.expected), len(args))
-			for ndx, arg := range args {
-				assert.Equal(t, tc.expected[ndx], arg)
-			}
-		})
-	}
-}
-
-func TestBuildMakeFsArgs(t *testing.T) {
-	var testCases = []struct {
-		desc        string
-		fsType      string
-		device      string
-		expected    []string
-		shouldError bool
-	}{
-		{
-			desc:        "fail with empty fstype",
-			fsType:      "",
-			device:      "",
-			expected:    []string{},
-			shouldError: true,
-		},
-		{
-			desc:        "fail with empty device",
-			fsType:      "ext4",
-			device:      "",
-			expected:    []string{},
-			shouldError: true,
-		},
-		{
-			desc:        "fail with unknown fstype",
-			fsType:      "unknown",
-			device:      "/dev/device",
-			expected:    []string{},
-			shouldError: true,
-		},
-		{
-			desc:   "works with ext4",
-			fsType: "ext4",
-			device: "/dev/device",
-			expected: []string{
-				"-t",
-				"ext4",
-				"/dev/device",
-			},
-			shouldError: false,
-		},
-		{
-			desc:   "works with xfs",
-			fsType: "xfs",
-			device: "/dev/device",
-			expected: []string{
-				"-t",
-				"xfs",
-				"/dev/device",
-			},
-			shouldError: false,
-		},
-	}
-
-	var (
-		err  error
-		args []string
-	)
-
-	for _, tc := range testCases {
-		t.Run(tc.desc, func(t *testing.T) {
-			args, err = BuildMakeFsArgs(tc.fsType, tc.device)
-			if tc.shouldError {
-				require.Error(t, err)
-				return
-			}
-
-			require.NoError(t, err)
-			require.Equal(t, len(tc.expected), len(args))
-			for ndx, arg := range args {
-				assert.Equal(t, tc.expected[ndx], arg)
-			}
-		})
-	}
-}
-
 func TestBuildLogicalVolumeRemovalArgs(t *testing.T) {
 	var testCases = []struct {
 		desc        string
@@ -268,6 +145,150 @@ func TestBuildLogicalVolumeCreationArgs(t *testing.T) {
 			},
 			shouldError: false,
 		},
+		{
+			desc: "thin snap works without size",
+			cfg: &LvCreationConfig{
+				Name:         "name",
+				VolumeGroup:  "volumegroup",
+				Snapshot:     "snapshot",
+				ThinSnapshot: true,
+			},
+			expected: []string{
+				"--setactivationskip", "n",
+				"--name", "name",
+				"--snapshot",
+				"volumegroup/snapshot",
+			},
+			shouldError: false,
+		},
+		{
+			desc: "thin snap fails with size",
+			cfg: &LvCreationConfig{
+				Name:         "name",
+				VolumeGroup:  "volumegroup",
+				Snapshot:     "snapshot",
+				ThinSnapshot: true,
+				Size:         "22M",
+			},
+			expected:    []string{},
+			shouldError: true,
+		},
+		{
+			desc: "striped vol works with stripes and stripesize",
+			cfg: &LvCreationConfig{
+				Name:        "name",
+				VolumeGroup: "volumegroup",
+				Size:        "22M",
+				Stripes:     2,
+				StripeSize:  "64k",
+			},
+			expected: []string{
+				"--setactivationskip", "n",
+				"--name", "name",
+				"--stripes", "2",
+				"--stripesize", "64k",
+				"--size", "22M",
+				"volumegroup",
+			},
+			shouldError: false,
+		},
+		{
+			desc: "raid1 vol defaults to a single mirror",
+			cfg: &LvCreationConfig{
+				Name:        "name",
+				VolumeGroup: "volumegroup",
+				Size:        "22M",
+				Type:        "raid1",
+			},
+			expected: []string{
+				"--setactivationskip", "n",
+				"--name", "name",
+				"--type", "raid1",
+				"--mirrors", "1",
+				"--size", "22M",
+				"volumegroup",
+			},
+			shouldError: false,
+		},
+		{
+			desc: "raid10 vol works with pvs",
+			cfg: &LvCreationConfig{
+				Name:        "name",
+				VolumeGroup: "volumegroup",
+				Size:        "22M",
+				Type:        "raid10",
+				Stripes:     2,
+				Mirrors:     1,
+				PhysicalVolumes: []string{
+					"/dev/sdb", "/dev/sdc",
+					"/dev/sdd", "/dev/sde",
+				},
+			},
+			expected: []string{
+				"--setactivationskip", "n",
+				"--name", "name",
+				"--type", "raid10",
+				"--mirrors", "1",
+				"--stripes", "2",
+				"--size", "22M",
+				"volumegroup",
+				"/dev/sdb", "/dev/sdc",
+				"/dev/sdd", "/dev/sde",
+			},
+			shouldError: false,
+		},
+		{
+			desc: "unknown type should fail",
+			cfg: &LvCreationConfig{
+				Name:        "name",
+				VolumeGroup: "volumegroup",
+				Size:        "22M",
+				Type:        "raid6",
+			},
+			expected:    []string{},
+			shouldError: true,
+		},
+		{
+			desc: "vol works with tags",
+			cfg: &LvCreationConfig{
+				Name:        "name",
+				VolumeGroup: "volumegroup",
+				Size:        "22M",
+				Tags:        []string{"golvm/fstype=xfs", "golvm/mountopt=noatime"},
+			},
+			expected: []string{
+				"--setactivationskip", "n",
+				"--name", "name",
+				"--addtag", "golvm/fstype=xfs",
+				"--addtag", "golvm/mountopt=noatime",
+				"--size", "22M",
+				"volumegroup",
+			},
+			shouldError: false,
+		},
+		{
+			desc: "tag with commas should fail",
+			cfg: &LvCreationConfig{
+				Name:        "name",
+				VolumeGroup: "volumegroup",
+				Size:        "22M",
+				Tags:        []string{"golvm/mountopt=noatime,nodev"},
+			},
+			expected:    []string{},
+			shouldError: true,
+		},
+		{
+			desc: "layout with thinpool should fail",
+			cfg: &LvCreationConfig{
+				Name:        "name",
+				VolumeGroup: "volumegroup",
+				Size:        "22M",
+				ThinPool:    "tp",
+				Stripes:     2,
+			},
+			expected:    []string{},
+			shouldError: true,
+		},
 	}
 
 	var (
@@ -2,174 +2,759 @@ package lib
 
 import (
 	"github.com/pkg/errors"
-	"strings"
+)
+
+// LvVolumeType corresponds to the 1st character of 'lv_attr'.
+type LvVolumeType byte
+
+// LvPermissions corresponds to the 2nd character of 'lv_attr'.
+type LvPermissions byte
+
+// AllocationPolicy corresponds to the 3rd character of 'lv_attr'
+// and to the 5th character of 'vg_attr'.
+type AllocationPolicy byte
+
+// LvFixedMinor corresponds to the 4th character of 'lv_attr'.
+type LvFixedMinor byte
+
+// LvState corresponds to the 5th character of 'lv_attr'.
+type LvState byte
+
+// LvDeviceState corresponds to the 6th character of 'lv_attr'.
+type LvDeviceState byte
+
+// LvTargetType corresponds to the 7th character of 'lv_attr'.
+type LvTargetType byte
+
+// LvZeroing corresponds to the 8th character of 'lv_attr'.
+type LvZeroing byte
+
+// LvHealth corresponds to the 9th character of 'lv_attr'.
+type LvHealth byte
+
+// LvSkipActivation corresponds to the 10th character of 'lv_attr'.
+type LvSkipActivation byte
+
+// VgPermissions corresponds to the 1st character of 'vg_attr'.
+type VgPermissions byte
+
+// VgResizeable corresponds to the 2nd character of 'vg_attr'.
+type VgResizeable byte
+
+// VgExported corresponds to the 3rd character of 'vg_attr'.
+type VgExported byte
+
+// VgPartial corresponds to the 4th character of 'vg_attr'.
+type VgPartial byte
+
+// VgClustered corresponds to the 6th character of 'vg_attr'.
+type VgClustered byte
+
+// PvAllocation corresponds to the 1st character of 'pv_attr'.
+type PvAllocation byte
+
+// PvExported corresponds to the 2nd character of 'pv_attr'.
+type PvExported byte
+
+// PvMissing corresponds to the 3rd character of 'pv_attr'.
+type PvMissing byte
+
+// AttrUnset is the character that lvm uses in any attribute
+// position that has nothing to report.
+const AttrUnset = '-'
+
+const (
+	LvVolumeTypeNone               LvVolumeType = AttrUnset
+	LvVolumeTypeCache              LvVolumeType = 'C'
+	LvVolumeTypeMirrored           LvVolumeType = 'm'
+	LvVolumeTypeMirroredNotSynced  LvVolumeType = 'M'
+	LvVolumeTypeOrigin             LvVolumeType = 'o'
+	LvVolumeTypeOriginMerging      LvVolumeType = 'O'
+	LvVolumeTypeRaid               LvVolumeType = 'r'
+	LvVolumeTypeRaidNotSynced      LvVolumeType = 'R'
+	LvVolumeTypeSnapshot           LvVolumeType = 's'
+	LvVolumeTypeSnapshotMerging    LvVolumeType = 'S'
+	LvVolumeTypePvmove             LvVolumeType = 'p'
+	LvVolumeTypeVirtual            LvVolumeType = 'v'
+	LvVolumeTypeThinVolume         LvVolumeType = 'V'
+	LvVolumeTypeImage              LvVolumeType = 'i'
+	LvVolumeTypeImageOutOfSync     LvVolumeType = 'I'
+	LvVolumeTypeThinPool           LvVolumeType = 't'
+	LvVolumeTypeThinPoolData       LvVolumeType = 'T'
+	LvVolumeTypeMetadata           LvVolumeType = 'e'
+	LvVolumeTypeMirrorLog          LvVolumeType = 'l'
+	LvVolumeTypeMirrorLogOutOfSync LvVolumeType = 'L'
+	LvVolumeTypeVdoPool            LvVolumeType = 'd'
+	LvVolumeTypeVdoPoolData        LvVolumeType = 'D'
+	LvVolumeTypeUnderConversion    LvVolumeType = 'c'
+)
+
+const (
+	LvPermissionsNone              LvPermissions = AttrUnset
+	LvPermissionsWriteable         LvPermissions = 'w'
+	LvPermissionsReadOnly          LvPermissions = 'r'
+	LvPermissionsReadOnlyActivated LvPermissions = 'R'
+)
+
+const (
+	AllocationPolicyNone             AllocationPolicy = AttrUnset
+	AllocationPolicyAnywhere         AllocationPolicy = 'a'
+	AllocationPolicyContiguous       AllocationPolicy = 'c'
+	AllocationPolicyInherited        AllocationPolicy = 'i'
+	AllocationPolicyCling            AllocationPolicy = 'l'
+	AllocationPolicyNormal           AllocationPolicy = 'n'
+	AllocationPolicyAnywhereLocked   AllocationPolicy = 'A'
+	AllocationPolicyContiguousLocked AllocationPolicy = 'C'
+	AllocationPolicyInheritedLocked  AllocationPolicy = 'I'
+	AllocationPolicyClingLocked      AllocationPolicy = 'L'
+	AllocationPolicyNormalLocked     AllocationPolicy = 'N'
+)
+
+const (
+	LvFixedMinorNone LvFixedMinor = AttrUnset
+	LvFixedMinorSet  LvFixedMinor = 'm'
+)
+
+const (
+	LvStateNone                         LvState = AttrUnset
+	LvStateActive                       LvState = 'a'
+	LvStateHistorical                   LvState = 'h'
+	LvStateSuspended                    LvState = 's'
+	LvStateInvalidSnapshot              LvState = 'I'
+	LvStateSuspendedSnapshot            LvState = 'S'
+	LvStateSnapshotMergeFailed          LvState = 'm'
+	LvStateSuspendedSnapshotMergeFail   LvState = 'M'
+	LvStateDevicePresentWithoutTables   LvState = 'd'
+	LvStateDevicePresentInactiveTable   LvState = 'i'
+	LvStateThinPoolCheckNeeded          LvState = 'c'
+	LvStateSuspendedThinPoolCheckNeeded LvState = 'C'
+	LvStateUnknown                      LvState = 'X'
+)
+
+const (
+	LvDeviceStateNone    LvDeviceState = AttrUnset
+	LvDeviceStateOpen    LvDeviceState = 'o'
+	LvDeviceStateUnknown LvDeviceState = 'X'
+)
+
+const (
+	LvTargetTypeNone     LvTargetType = AttrUnset
+	LvTargetTypeCache    LvTargetType = 'C'
+	LvTargetTypeMirror   LvTargetType = 'm'
+	LvTargetTypeRaid     LvTargetType = 'r'
+	LvTargetTypeSnapshot LvTargetType = 's'
+	LvTargetTypeThin     LvTargetType = 't'
+	LvTargetTypeUnknown  LvTargetType = 'u'
+	LvTargetTypeVirtual  LvTargetType = 'v'
+)
+
+const (
+	LvZeroingNone LvZeroing = AttrUnset
+	LvZeroingSet  LvZeroing = 'z'
+)
+
+const (
+	LvHealthNone               LvHealth = AttrUnset
+	LvHealthPartial            LvHealth = 'p'
+	LvHealthUnknown            LvHealth = 'X'
+	LvHealthRefreshNeeded      LvHealth = 'r'
+	LvHealthMismatchesExist    LvHealth = 'm'
+	LvHealthWritemostly        LvHealth = 'w'
+	LvHealthReshaping          LvHealth = 's'
+	LvHealthRemoveAfterReshape LvHealth = 'R'
+	LvHealthFailed             LvHealth = 'F'
+	LvHealthOutOfDataSpace     LvHealth = 'D'
+	LvHealthMetadataReadOnly   LvHealth = 'M'
+	LvHealthError              LvHealth = 'E'
+)
+
+const (
+	LvSkipActivationNone LvSkipActivation = AttrUnset
+	LvSkipActivationSet  LvSkipActivation = 'k'
+)
+
+const (
+	VgPermissionsNone      VgPermissions = AttrUnset
+	VgPermissionsWriteable VgPermissions = 'w'
+	VgPermissionsReadOnly  VgPermissions = 'r'
+)
+
+const (
+	VgResizeableNone VgResizeable = AttrUnset
+	VgResizeableSet  VgResizeable = 'z'
+)
+
+const (
+	VgExportedNone VgExported = AttrUnset
+	VgExportedSet  VgExported = 'x'
+)
+
+const (
+	VgPartialNone VgPartial = AttrUnset
+	VgPartialSet  VgPartial = 'p'
+)
+
+const (
+	VgClusteredNone VgClustered = AttrUnset
+	VgClusteredSet  VgClustered = 'c'
+	VgSharedSet     VgClustered = 's'
+)
+
+const (
+	PvAllocationNone        PvAllocation = AttrUnset
+	PvAllocationDuplicate   PvAllocation = 'd'
+	PvAllocationAllocatable PvAllocation = 'a'
+	PvAllocationUsed        PvAllocation = 'u'
+)
+
+const (
+	PvExportedNone PvExported = AttrUnset
+	PvExportedSet  PvExported = 'x'
+)
+
+const (
+	PvMissingNone PvMissing = AttrUnset
+	PvMissingSet  PvMissing = 'm'
 )
 
 var (
-	lvAttrVolumeTypeMap = map[string]string{
-		"-": "-",
-		"C": "cache",
-		"m": "mirrored",
-		"M": "mirrored without initial sync",
-		"o": "origin",
-		"O": "origin without merging snapshot",
-		"r": "raid",
-		"R": "raid without initial sync",
-		"s": "snapshot merging",
-		"S": "snapshot",
-		"p": "pvmove",
-		"v": "virtual",
-		"V": "thin volume",
-		"i": "mirror or raid image",
-		"I": "mirror our raid image out-of-sync",
-		"t": "thin pool",
-		"T": "thin poool data",
-		"e": "metadata or pool metadata sparse",
-	}
-	lvAttrPermissionsMap = map[string]string{
-		"-": "-",
-		"w": "writeable",
-		"r": "read-only",
-		"R": "read-only activation of non-read-only volume",
-	}
-
-	lvAttrAllocationPolicyMap = map[string]string{
-		"-": "-",
-		"a": "anywhere",
-		"c": "contiguous",
-		"i": "inherited",
-		"l": "cling",
-		"n": "normal",
-	}
-
-	lvAttrFixedMinorMap = map[string]string{
-		"-": "-",
-		"m": "fixed minor",
-	}
-
-	lvAttrStateMap = map[string]string{
-		"-": "-",
-		"a": "active",
-		"h": "historical",
-		"s": "suspended",
-		"I": "invalid snapshot",
-		"S": "suspended snapshot",
-		"m": "snapshot merge failed",
-		"M": "suspended snapshot merge failed",
-		"d": "device present without tables",
-		"i": "mapped device present with inactive table",
-		"c": "thin-pool check needed",
-		"C": "suspended thin-pool check needed",
-		"X": "unknown",
-	}
-
-	lvAttrDeviceStateMap = map[string]string{
-		"-": "-",
-		"o": "open",
-		"X": "unknown",
-	}
-
-	lvAttrTargetTypeMap = map[string]string{
-		"-": "-",
-		"C": "cache",
-		"m": "mirror",
-		"r": "raid",
-		"s": "snapshot",
-		"t": "thin",
-		"u": "unknown",
-		"v": "virtual",
-	}
-
-	lvAttrOverrideNewBlocksWithZeroMap = map[string]string{
-		"-": "-",
-		"z": "overwrite by zero",
-	}
-
-	lvAttrVolumeHealthMap = map[string]string{
-		"-": "-",
-		"p": "partial",
-		"X": "unknown",
-		"r": "refresh needed",
-		"m": "mismatches exist",
-		"w": "writemostly",
-	}
-
-	lvAttrSkipActivationMap = map[string]string{
-		"-": "-",
-		"k": "skip activation",
-	}
-
-	lvAttrMapper = []map[string]string{
-		lvAttrVolumeTypeMap,
-		lvAttrPermissionsMap,
-		lvAttrAllocationPolicyMap,
-		lvAttrFixedMinorMap,
-		lvAttrStateMap,
-		lvAttrDeviceStateMap,
-		lvAttrTargetTypeMap,
-		lvAttrOverrideNewBlocksWithZeroMap,
-		lvAttrVolumeHealthMap,
-		lvAttrSkipActivationMap,
+	lvVolumeTypeNames = map[byte]string{
+		AttrUnset:                            "-",
+		byte(LvVolumeTypeCache):              "cache",
+		byte(LvVolumeTypeMirrored):           "mirrored",
+		byte(LvVolumeTypeMirroredNotSynced):  "mirrored without initial sync",
+		byte(LvVolumeTypeOrigin):             "origin",
+		byte(LvVolumeTypeOriginMerging):      "origin with merging snapshot",
+		byte(LvVolumeTypeRaid):               "raid",
+		byte(LvVolumeTypeRaidNotSynced):      "raid without initial sync",
+		byte(LvVolumeTypeSnapshot):           "snapshot",
+		byte(LvVolumeTypeSnapshotMerging):    "merging snapshot",
+		byte(LvVolumeTypePvmove):             "pvmove",
+		byte(LvVolumeTypeVirtual):            "virtual",
+		byte(LvVolumeTypeThinVolume):         "thin volume",
+		byte(LvVolumeTypeImage):              "mirror or raid image",
+		byte(LvVolumeTypeImageOutOfSync):     "mirror or raid image out-of-sync",
+		byte(LvVolumeTypeThinPool):           "thin pool",
+		byte(LvVolumeTypeThinPoolData):       "thin pool data",
+		byte(LvVolumeTypeMetadata):           "raid or pool metadata or pool metadata spare",
+		byte(LvVolumeTypeMirrorLog):          "mirror log",
+		byte(LvVolumeTypeMirrorLogOutOfSync): "mirror log out-of-sync",
+		byte(LvVolumeTypeVdoPool):            "vdo pool",
+		byte(LvVolumeTypeVdoPoolData):        "vdo pool data",
+		byte(LvVolumeTypeUnderConversion):    "under conversion",
+	}
+
+	lvPermissionsNames = map[byte]string{
+		AttrUnset:                            "-",
+		byte(LvPermissionsWriteable):         "writeable",
+		byte(LvPermissionsReadOnly):          "read-only",
+		byte(LvPermissionsReadOnlyActivated): "read-only activation of non-read-only volume",
+	}
+
+	allocationPolicyNames = map[byte]string{
+		AttrUnset:                              "-",
+		byte(AllocationPolicyAnywhere):         "anywhere",
+		byte(AllocationPolicyContiguous):       "contiguous",
+		byte(AllocationPolicyInherited):        "inherited",
+		byte(AllocationPolicyCling):            "cling",
+		byte(AllocationPolicyNormal):           "normal",
+		byte(AllocationPolicyAnywhereLocked):   "anywhere (locked)",
+		byte(AllocationPolicyContiguousLocked): "contiguous (locked)",
+		byte(AllocationPolicyInheritedLocked):  "inherited (locked)",
+		byte(AllocationPolicyClingLocked):      "cling (locked)",
+		byte(AllocationPolicyNormalLocked):     "normal (locked)",
+	}
+
+	lvFixedMinorNames = map[byte]string{
+		AttrUnset:             "-",
+		byte(LvFixedMinorSet): "fixed minor",
+	}
+
+	lvStateNames = map[byte]string{
+		AttrUnset:                                 "-",
+		byte(LvStateActive):                       "active",
+		byte(LvStateHistorical):                   "historical",
+		byte(LvStateSuspended):                    "suspended",
+		byte(LvStateInvalidSnapshot):              "invalid snapshot",
+		byte(LvStateSuspendedSnapshot):            "invalid suspended snapshot",
+		byte(LvStateSnapshotMergeFailed):          "snapshot merge failed",
+		byte(LvStateSuspendedSnapshotMergeFail):   "suspended snapshot merge failed",
+		byte(LvStateDevicePresentWithoutTables):   "device present without tables",
+		byte(LvStateDevicePresentInactiveTable):   "mapped device present with inactive table",
+		byte(LvStateThinPoolCheckNeeded):          "thin-pool check needed",
+		byte(LvStateSuspendedThinPoolCheckNeeded): "suspended thin-pool check needed",
+		byte(LvStateUnknown):                      "unknown",
+	}
+
+	lvDeviceStateNames = map[byte]string{
+		AttrUnset:                  "-",
+		byte(LvDeviceStateOpen):    "open",
+		byte(LvDeviceStateUnknown): "unknown",
+	}
+
+	lvTargetTypeNames = map[byte]string{
+		AttrUnset:                  "-",
+		byte(LvTargetTypeCache):    "cache",
+		byte(LvTargetTypeMirror):   "mirror",
+		byte(LvTargetTypeRaid):     "raid",
+		byte(LvTargetTypeSnapshot): "snapshot",
+		byte(LvTargetTypeThin):     "thin",
+		byte(LvTargetTypeUnknown):  "unknown",
+		byte(LvTargetTypeVirtual):  "virtual",
+	}
+
+	lvZeroingNames = map[byte]string{
+		AttrUnset:          "-",
+		byte(LvZeroingSet): "overwrite by zero",
+	}
+
+	lvHealthNames = map[byte]string{
+		AttrUnset:                        "-",
+		byte(LvHealthPartial):            "partial",
+		byte(LvHealthUnknown):            "unknown",
+		byte(LvHealthRefreshNeeded):      "refresh needed",
+		byte(LvHealthMismatchesExist):    "mismatches exist",
+		byte(LvHealthWritemostly):        "writemostly",
+		byte(LvHealthReshaping):          "reshaping",
+		byte(LvHealthRemoveAfterReshape): "remove after reshape",
+		byte(LvHealthFailed):             "failed",
+		byte(LvHealthOutOfDataSpace):     "out of data space",
+		byte(LvHealthMetadataReadOnly):   "metadata read only",
+		byte(LvHealthError):              "error",
+	}
+
+	lvSkipActivationNames = map[byte]string{
+		AttrUnset:                 "-",
+		byte(LvSkipActivationSet): "skip activation",
+	}
+
+	vgPermissionsNames = map[byte]string{
+		AttrUnset:                    "-",
+		byte(VgPermissionsWriteable): "writeable",
+		byte(VgPermissionsReadOnly):  "read-only",
+	}
+
+	vgResizeableNames = map[byte]string{
+		AttrUnset:             "-",
+		byte(VgResizeableSet): "resizeable",
+	}
+
+	vgExportedNames = map[byte]string{
+		AttrUnset:           "-",
+		byte(VgExportedSet): "exported",
+	}
+
+	vgPartialNames = map[byte]string{
+		AttrUnset:          "-",
+		byte(VgPartialSet): "partial",
+	}
+
+	vgClusteredNames = map[byte]string{
+		AttrUnset:            "-",
+		byte(VgClusteredSet): "clustered",
+		byte(VgSharedSet):    "shared",
+	}
+
+	pvAllocationNames = map[byte]string{
+		AttrUnset:                     "-",
+		byte(PvAllocationDuplicate):   "duplicate",
+		byte(PvAllocationAllocatable): "allocatable",
+		byte(PvAllocationUsed):        "used",
+	}
+
+	pvExportedNames = map[byte]string{
+		AttrUnset:           "-",
+		byte(PvExportedSet): "exported",
+	}
+
+	pvMissingNames = map[byte]string{
+		AttrUnset:          "-",
+		byte(PvMissingSet): "missing",
+	}
+
+	lvAttrMapper = []map[byte]string{
+		lvVolumeTypeNames,
+		lvPermissionsNames,
+		allocationPolicyNames,
+		lvFixedMinorNames,
+		lvStateNames,
+		lvDeviceStateNames,
+		lvTargetTypeNames,
+		lvZeroingNames,
+		lvHealthNames,
+		lvSkipActivationNames,
+	}
+
+	vgAttrMapper = []map[byte]string{
+		vgPermissionsNames,
+		vgResizeableNames,
+		vgExportedNames,
+		vgPartialNames,
+		allocationPolicyNames,
+		vgClusteredNames,
+	}
+
+	pvAttrMapper = []map[byte]string{
+		pvAllocationNames,
+		pvExportedNames,
+		pvMissingNames,
 	}
 )
 
-// ParseLvAttr takes an 'attr' string from 'lvs' command and
-// parses it so that it can be consumed via the LvAttr struct.
-// In case of any unexpected tokens or malformed attr, fails
-// with an error.
-func ParseLvAttr(attr string) (parsedAttr *LvAttr, err error) {
+// attrName looks up the human readable description of an
+// attribute character, falling back to the character itself.
+func attrName(names map[byte]string, c byte) string {
+	name, present := names[c]
+	if !present {
+		return string(c)
+	}
+
+	return name
+}
+
+func (v LvVolumeType) String() string     { return attrName(lvVolumeTypeNames, byte(v)) }
+func (v LvPermissions) String() string    { return attrName(lvPermissionsNames, byte(v)) }
+func (v AllocationPolicy) String() string { return attrName(allocationPolicyNames, byte(v)) }
+func (v LvFixedMinor) String() string     { return attrName(lvFixedMinorNames, byte(v)) }
+func (v LvState) String() string          { return attrName(lvStateNames, byte(v)) }
+func (v LvDeviceState) String() string    { return attrName(lvDeviceStateNames, byte(v)) }
+func (v LvTargetType) String() string     { return attrName(lvTargetTypeNames, byte(v)) }
+func (v LvZeroing) String() string        { return attrName(lvZeroingNames, byte(v)) }
+func (v LvHealth) String() string         { return attrName(lvHealthNames, byte(v)) }
+func (v LvSkipActivation) String() string { return attrName(lvSkipActivationNames, byte(v)) }
+func (v VgPermissions) String() string    { return attrName(vgPermissionsNames, byte(v)) }
+func (v VgResizeable) String() string     { return attrName(vgResizeableNames, byte(v)) }
+func (v VgExported) String() string       { return attrName(vgExportedNames, byte(v)) }
+func (v VgPartial) String() string        { return attrName(vgPartialNames, byte(v)) }
+func (v VgClustered) String() string      { return attrName(vgClusteredNames, byte(v)) }
+func (v PvAllocation) String() string     { return attrName(pvAllocationNames, byte(v)) }
+func (v PvExported) String() string       { return attrName(pvExportedNames, byte(v)) }
+func (v PvMissing) String() string        { return attrName(pvMissingNames, byte(v)) }
+
+// IsLocked indicates whether the allocation policy is locked
+// against changes (e.g., during a pvmove).
+func (v AllocationPolicy) IsLocked() bool {
+	return v >= 'A' && v <= 'Z'
+}
+
+// parseAttr validates each character of an 'attr' string
+// against the set of characters known for its position.
+func parseAttr(attr string, mapper []map[byte]string) (chars []byte, err error) {
 	if attr == "" {
 		err = errors.Errorf("attr must not be empty")
 		return
 	}
 
-	if len(attr) != 10 {
+	if len(attr) != len(mapper) {
 		err = errors.Errorf(
-			"malformed attr '%s' - must be 10chars",
-			attr)
+			"malformed attr '%s' - must be %dchars",
+			attr, len(mapper))
 		return
 	}
 
-	var (
-		mapping map[string]string
-		present bool
-		val     string
-		chars   = strings.Split(attr, "")
-	)
-
-	parsedAttr = new(LvAttr)
+	chars = []byte(attr)
 	for ndx, character := range chars {
-		mapping = lvAttrMapper[ndx]
-		val, present = mapping[character]
+		_, present := mapper[ndx][character]
 		if !present {
 			err = errors.Errorf(
-				"unexpected character '%' for lv attr '%d'",
+				"unexpected character '%c' for attr '%d'",
 				character, ndx)
 			return
 		}
+	}
 
-		switch ndx {
-		case 0:
-			parsedAttr.VolumeType = val
-		case 1:
-			parsedAttr.Permissions = val
-		case 2:
-			parsedAttr.AllocationPolicy = val
-		case 3:
-			parsedAttr.FixedMinor = val
-		case 4:
-			parsedAttr.State = val
-		case 5:
-			parsedAttr.DeviceState = val
-		case 6:
-			parsedAttr.TargetType = val
-		case 7:
-			parsedAttr.OverrideNewBlocksWithZero = val
-		case 8:
-			parsedAttr.VolumeHealth = val
-		case 9:
-			parsedAttr.SkipActivation = val
-		}
+	return
+}
+
+// ParseLvAttr takes an 'attr' string from 'lvs' command and
+// parses it so that it can be consumed via the LvAttr struct.
+// In case of any unexpected tokens or malformed attr, fails
+// with an error.
+func ParseLvAttr(attr string) (parsedAttr *LvAttr, err error) {
+	var chars []byte
+
+	chars, err = parseAttr(attr, lvAttrMapper)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse lv attr")
+		return
+	}
+
+	parsedAttr = &LvAttr{
+		VolumeType:                LvVolumeType(chars[0]),
+		Permissions:               LvPermissions(chars[1]),
+		AllocationPolicy:          AllocationPolicy(chars[2]),
+		FixedMinor:                LvFixedMinor(chars[3]),
+		State:                     LvState(chars[4]),
+		DeviceState:               LvDeviceState(chars[5]),
+		TargetType:                LvTargetType(chars[6]),
+		OverrideNewBlocksWithZero: LvZeroing(chars[7]),
+		VolumeHealth:              LvHealth(chars[8]),
+		SkipActivation:            LvSkipActivation(chars[9]),
+	}
+
+	return
+}
+
+// Encode converts the attributes back to the 10 characters
+// representation used by 'lvs'.
+func (a *LvAttr) Encode() string {
+	return string([]byte{
+		byte(a.VolumeType),
+		byte(a.Permissions),
+		byte(a.AllocationPolicy),
+		byte(a.FixedMinor),
+		byte(a.State),
+		byte(a.DeviceState),
+		byte(a.TargetType),
+		byte(a.OverrideNewBlocksWithZero),
+		byte(a.VolumeHealth),
+		byte(a.SkipActivation),
+	})
+}
+
+// IsActive indicates whether the volume is active.
+func (a *LvAttr) IsActive() bool {
+	return a.State == LvStateActive
+}
+
+// IsOpen indicates whether the volume's device is open
+// (e.g., mounted).
+func (a *LvAttr) IsOpen() bool {
+	return a.DeviceState == LvDeviceStateOpen
+}
+
+// IsThinPool indicates whether the volume is a thin pool.
+func (a *LvAttr) IsThinPool() bool {
+	return a.VolumeType == LvVolumeTypeThinPool
+}
+
+// IsThinVolume indicates whether the volume is thinly
+// provisioned from a thin pool (thin snapshots included).
+func (a *LvAttr) IsThinVolume() bool {
+	return a.VolumeType == LvVolumeTypeThinVolume
+}
+
+// IsSnapshot indicates whether the volume is a (thick)
+// snapshot, merging or not.
+func (a *LvAttr) IsSnapshot() bool {
+	return a.VolumeType == LvVolumeTypeSnapshot ||
+		a.VolumeType == LvVolumeTypeSnapshotMerging
+}
+
+// IsOrigin indicates whether the volume is the origin of
+// (thick) snapshots.
+func (a *LvAttr) IsOrigin() bool {
+	return a.VolumeType == LvVolumeTypeOrigin ||
+		a.VolumeType == LvVolumeTypeOriginMerging
+}
+
+// IsRaid indicates whether the volume is a raid volume.
+func (a *LvAttr) IsRaid() bool {
+	return a.VolumeType == LvVolumeTypeRaid ||
+		a.VolumeType == LvVolumeTypeRaidNotSynced
+}
+
+// IsReadOnly indicates whether the volume can't be written to.
+func (a *LvAttr) IsReadOnly() bool {
+	return a.Permissions == LvPermissionsReadOnly ||
+		a.Permissions == LvPermissionsReadOnlyActivated
+}
+
+// IsPartial indicates whether one or more of the physical
+// volumes that back the volume are missing.
+func (a *LvAttr) IsPartial() bool {
+	return a.VolumeHealth == LvHealthPartial
+}
+
+// SkipsActivation indicates whether the volume is flagged
+// to be skipped during activation.
+func (a *LvAttr) SkipsActivation() bool {
+	return a.SkipActivation == LvSkipActivationSet
+}
+
+// ParseVgAttr takes an 'attr' string from 'vgs' command and
+// parses it so that it can be consumed via the VgAttr struct.
+// In case of any unexpected tokens or malformed attr, fails
+// with an error.
+func ParseVgAttr(attr string) (parsedAttr *VgAttr, err error) {
+	var chars []byte
+
+	chars, err = parseAttr(attr, vgAttrMapper)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse vg attr")
+		return
+	}
+
+	parsedAttr = &VgAttr{
+		Permissions:      VgPermissions(chars[0]),
+		Resizeable:       VgResizeable(chars[1]),
+		Exported:         VgExported(chars[2]),
+		Partial:          VgPartial(chars[3]),
+		AllocationPolicy: AllocationPolicy(chars[4]),
+		Clustered:        VgClustered(chars[5]),
+	}
+
+	return
+}
+
+// Encode converts the attributes back to the 6 characters
+// representation used by 'vgs'.
+func (a *VgAttr) Encode() string {
+	return string([]byte{
+		byte(a.Permissions),
+		byte(a.Resizeable),
+		byte(a.Exported),
+		byte(a.Partial),
+		byte(a.AllocationPolicy),
+		byte(a.Clustered),
+	})
+}
+
+// IsWriteable indicates whether the volume group can be
+// modified.
+func (a *VgAttr) IsWriteable() bool {
+	return a.Permissions == VgPermissionsWriteable
+}
+
+// IsResizeable indicates whether the volume group can be
+// extended or reduced.
+func (a *VgAttr) IsResizeable() bool {
+	return a.Resizeable == VgResizeableSet
+}
+
+// IsExported indicates whether the volume group has been
+// exported (vgexport).
+func (a *VgAttr) IsExported() bool {
+	return a.Exported == VgExportedSet
+}
+
+// IsPartial indicates whether one or more of the physical
+// volumes of the group are missing.
+func (a *VgAttr) IsPartial() bool {
+	return a.Partial == VgPartialSet
+}
+
+// IsClustered indicates whether the volume group is
+// clustered or shared.
+func (a *VgAttr) IsClustered() bool {
+	return a.Clustered != VgClusteredNone
+}
+
+// ParsePvAttr takes an 'attr' string from 'pvs' command and
+// parses it so that it can be consumed via the PvAttr struct.
+// In case of any unexpected tokens or malformed attr, fails
+// with an error.
+func ParsePvAttr(attr string) (parsedAttr *PvAttr, err error) {
+	var chars []byte
+
+	chars, err = parseAttr(attr, pvAttrMapper)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse pv attr")
+		return
+	}
+
+	parsedAttr = &PvAttr{
+		Allocation: PvAllocation(chars[0]),
+		Exported:   PvExported(chars[1]),
+		Missing:    PvMissing(chars[2]),
+	}
+
+	return
+}
+
+// Encode converts the attributes back to the 3 characters
+// representation used by 'pvs'.
+func (a *PvAttr) Encode() string {
+	return string([]byte{
+		byte(a.Allocation),
+		byte(a.Exported),
+		byte(a.Missing),
+	})
+}
+
+// IsAllocatable indicates whether new extents can be
+// allocated from the physical volume.
+func (a *PvAttr) IsAllocatable() bool {
+	return a.Allocation == PvAllocationAllocatable
+}
+
+// IsDuplicate indicates whether the physical volume is a
+// duplicate of another device.
+func (a *PvAttr) IsDuplicate() bool {
+	return a.Allocation == PvAllocationDuplicate
+}
+
+// IsExported indicates whether the physical volume belongs
+// to an exported volume group.
+func (a *PvAttr) IsExported() bool {
+	return a.Exported == PvExportedSet
+}
+
+// IsMissing indicates whether the physical volume can't be
+// found in the system.
+func (a *PvAttr) IsMissing() bool {
+	return a.Missing == PvMissingSet
+}
+
+// VolumeGroupProblems lists the reasons why a volume group
+// shouldn't receive new volumes (e.g., a physical volume is
+// missing or the group has been exported).
+// A volume group without attributes has no known problems.
+func VolumeGroupProblems(vg *VolumeGroup) (problems []string, err error) {
+	var attr *VgAttr
+
+	problems = make([]string, 0)
+	if vg == nil || vg.Attr == "" {
+		return
+	}
+
+	attr, err = ParseVgAttr(vg.Attr)
+	if err != nil {
+		return
+	}
+
+	if !attr.IsWriteable() {
+		problems = append(problems, attr.Permissions.String())
+	}
+
+	if attr.IsExported() {
+		problems = append(problems, attr.Exported.String())
+	}
+
+	if attr.IsPartial() {
+		problems = append(problems, attr.Partial.String())
+	}
+
+	return
+}
+
+// PhysicalVolumeProblems lists the reasons why a physical
+// volume shouldn't be allocated from (e.g., it's missing or
+// it has been marked as non-allocatable).
+// A physical volume without attributes has no known problems.
+func PhysicalVolumeProblems(pv *PhysicalVolume) (problems []string, err error) {
+	var attr *PvAttr
+
+	problems = make([]string, 0)
+	if pv == nil || pv.Attr == "" {
+		return
+	}
+
+	attr, err = ParsePvAttr(pv.Attr)
+	if err != nil {
+		return
+	}
+
+	if !attr.IsAllocatable() {
+		problems = append(problems, "not allocatable")
+	}
+
+	if attr.IsExported() {
+		problems = append(problems, attr.Exported.String())
+	}
+
+	if attr.IsMissing() {
+		problems = append(problems, attr.Missing.String())
 	}
 
 	return
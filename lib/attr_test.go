@@ -48,16 +48,16 @@ func TestParseLvAttr(t *testing.T) {
 			desc:  "proper volume type parsing",
 			input: "t---------",
 			expected: &LvAttr{
-				VolumeType:                "thin pool",
-				Permissions:               "-",
-				AllocationPolicy:          "-",
-				FixedMinor:                "-",
-				State:                     "-",
-				DeviceState:               "-",
-				TargetType:                "-",
-				OverrideNewBlocksWithZero: "-",
-				VolumeHealth:              "-",
-				SkipActivation:            "-",
+				VolumeType:                LvVolumeTypeThinPool,
+				Permissions:               LvPermissionsNone,
+				AllocationPolicy:          AllocationPolicyNone,
+				FixedMinor:                LvFixedMinorNone,
+				State:                     LvStateNone,
+				DeviceState:               LvDeviceStateNone,
+				TargetType:                LvTargetTypeNone,
+				OverrideNewBlocksWithZero: LvZeroingNone,
+				VolumeHealth:              LvHealthNone,
+				SkipActivation:            LvSkipActivationNone,
 			},
 			shouldError: false,
 		},
@@ -65,16 +65,16 @@ func TestParseLvAttr(t *testing.T) {
 			desc:  "proper overall parsing",
 			input: "twi-aotz--",
 			expected: &LvAttr{
-				VolumeType:                "thin pool",
-				Permissions:               "writeable",
-				AllocationPolicy:          "inherited",
-				FixedMinor:                "-",
-				State:                     "active",
-				DeviceState:               "open",
-				TargetType:                "thin",
-				OverrideNewBlocksWithZero: "overwrite by zero",
-				VolumeHealth:              "-",
-				SkipActivation:            "-",
+				VolumeType:                LvVolumeTypeThinPool,
+				Permissions:               LvPermissionsWriteable,
+				AllocationPolicy:          AllocationPolicyInherited,
+				FixedMinor:                LvFixedMinorNone,
+				State:                     LvStateActive,
+				DeviceState:               LvDeviceStateOpen,
+				TargetType:                LvTargetTypeThin,
+				OverrideNewBlocksWithZero: LvZeroingSet,
+				VolumeHealth:              LvHealthNone,
+				SkipActivation:            LvSkipActivationNone,
 			},
 			shouldError: false,
 		},
@@ -82,16 +82,16 @@ func TestParseLvAttr(t *testing.T) {
 			desc:  "proper thin parse",
 			input: "Vwi-a-tz--",
 			expected: &LvAttr{
-				VolumeType:                "thin volume",
-				Permissions:               "writeable",
-				AllocationPolicy:          "inherited",
-				FixedMinor:                "-",
-				State:                     "active",
-				DeviceState:               "-",
-				TargetType:                "thin",
-				OverrideNewBlocksWithZero: "overwrite by zero",
-				VolumeHealth:              "-",
-				SkipActivation:            "-",
+				VolumeType:                LvVolumeTypeThinVolume,
+				Permissions:               LvPermissionsWriteable,
+				AllocationPolicy:          AllocationPolicyInherited,
+				FixedMinor:                LvFixedMinorNone,
+				State:                     LvStateActive,
+				DeviceState:               LvDeviceStateNone,
+				TargetType:                LvTargetTypeThin,
+				OverrideNewBlocksWithZero: LvZeroingSet,
+				VolumeHealth:              LvHealthNone,
+				SkipActivation:            LvSkipActivationNone,
 			},
 			shouldError: false,
 		},
@@ -136,3 +136,185 @@ func TestParseLvAttr(t *testing.T) {
 		})
 	}
 }
+
+func TestParseVgAttr(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    *VgAttr
+		shouldError bool
+	}{
+		{
+			desc:        "fails with empty",
+			input:       "",
+			shouldError: true,
+		},
+		{
+			desc:        "fails with lv attr",
+			input:       "-wi-a-----",
+			shouldError: true,
+		},
+		{
+			desc:        "fails with unexpected chars",
+			input:       "wz--q-",
+			shouldError: true,
+		},
+		{
+			desc:  "healthy vg",
+			input: "wz--n-",
+			expected: &VgAttr{
+				Permissions:      VgPermissionsWriteable,
+				Resizeable:       VgResizeableSet,
+				Exported:         VgExportedNone,
+				Partial:          VgPartialNone,
+				AllocationPolicy: AllocationPolicyNormal,
+				Clustered:        VgClusteredNone,
+			},
+		},
+		{
+			desc:  "partial and exported vg",
+			input: "rzxpn-",
+			expected: &VgAttr{
+				Permissions:      VgPermissionsReadOnly,
+				Resizeable:       VgResizeableSet,
+				Exported:         VgExportedSet,
+				Partial:          VgPartialSet,
+				AllocationPolicy: AllocationPolicyNormal,
+				Clustered:        VgClusteredNone,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			parsed, err := ParseVgAttr(tc.input)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, parsed)
+		})
+	}
+}
+
+func TestParsePvAttr(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    *PvAttr
+		shouldError bool
+	}{
+		{
+			desc:        "fails with empty",
+			input:       "",
+			shouldError: true,
+		},
+		{
+			desc:        "fails with unexpected chars",
+			input:       "a-z",
+			shouldError: true,
+		},
+		{
+			desc:  "allocatable pv",
+			input: "a--",
+			expected: &PvAttr{
+				Allocation: PvAllocationAllocatable,
+				Exported:   PvExportedNone,
+				Missing:    PvMissingNone,
+			},
+		},
+		{
+			desc:  "missing pv",
+			input: "u-m",
+			expected: &PvAttr{
+				Allocation: PvAllocationUsed,
+				Exported:   PvExportedNone,
+				Missing:    PvMissingSet,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			parsed, err := ParsePvAttr(tc.input)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, parsed)
+		})
+	}
+}
+
+func TestVolumeGroupProblems(t *testing.T) {
+	problems, err := VolumeGroupProblems(&VolumeGroup{Attr: "wz--n-"})
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	problems, err = VolumeGroupProblems(&VolumeGroup{Attr: "wz-pn-"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"partial"}, problems)
+
+	_, err = VolumeGroupProblems(&VolumeGroup{Attr: "wz"})
+	require.Error(t, err)
+}
+
+func TestPhysicalVolumeProblems(t *testing.T) {
+	problems, err := PhysicalVolumeProblems(&PhysicalVolume{Attr: "a--"})
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	problems, err = PhysicalVolumeProblems(&PhysicalVolume{Attr: "u-m"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"not allocatable", "missing"}, problems)
+}
+
+func TestLvAttrPredicates(t *testing.T) {
+	attr, err := ParseLvAttr("twi-aotz--")
+	require.NoError(t, err)
+
+	assert.True(t, attr.IsThinPool())
+	assert.True(t, attr.IsActive())
+	assert.True(t, attr.IsOpen())
+	assert.False(t, attr.IsThinVolume())
+	assert.False(t, attr.IsSnapshot())
+	assert.False(t, attr.IsReadOnly())
+	assert.Equal(t, "thin pool", attr.VolumeType.String())
+	assert.Equal(t, "overwrite by zero", attr.OverrideNewBlocksWithZero.String())
+
+	attr, err = ParseLvAttr("swi-a-s---")
+	require.NoError(t, err)
+
+	assert.True(t, attr.IsSnapshot())
+	assert.Equal(t, "snapshot", attr.VolumeType.String())
+}
+
+func TestAttrEncodingRoundTrip(t *testing.T) {
+	for _, input := range []string{
+		"twi-aotz--",
+		"Vwi-a-tz-k",
+		"-wi-ao----",
+		"rwi-a-r-p-",
+		"SwI-I-s---",
+	} {
+		attr, err := ParseLvAttr(input)
+		require.NoError(t, err)
+		assert.Equal(t, input, attr.Encode())
+	}
+
+	for _, input := range []string{"wz--n-", "rzxpNs"} {
+		attr, err := ParseVgAttr(input)
+		require.NoError(t, err)
+		assert.Equal(t, input, attr.Encode())
+	}
+
+	for _, input := range []string{"a--", "uxm", "d--"} {
+		attr, err := ParsePvAttr(input)
+		require.NoError(t, err)
+		assert.Equal(t, input, attr.Encode())
+	}
+}
@@ -0,0 +1,761 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// BackupVersion is the version of the backup manifests
+	// written by BackupVolume.
+	BackupVersion = 1
+
+	// BackupManifestName is the file, in the directory of
+	// each backup, that describes it.
+	BackupManifestName = "manifest.json"
+
+	backupChunksDir = "chunks"
+)
+
+// Extent is a range of bytes of a device.
+type Extent struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// BackupChunk is a piece of a volume stored by a backup.
+type BackupChunk struct {
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Sha256 string `json:"sha256"`
+}
+
+// BackupManifest describes a backup of a volume. Full backups
+// hold all the data of the volume while incremental ones only
+// hold what changed since their parent.
+type BackupManifest struct {
+	Version  int    `json:"version"`
+	Sequence int    `json:"sequence"`
+	Parent   int    `json:"parent,omitempty"`
+	Volume   string `json:"volume"`
+
+	// Snapshot is the thin snapshot that the backup was
+	// taken from, which the next incremental backup is
+	// computed against.
+	Snapshot  string    `json:"snapshot"`
+	Size      ByteSize  `json:"size"`
+	FsType    string    `json:"fstype"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Chunks []BackupChunk `json:"chunks"`
+
+	// Zeroed lists the extents that only contain zeros,
+	// which are not stored as chunks.
+	Zeroed []Extent `json:"zeroed"`
+}
+
+// IsFull indicates whether the backup doesn't depend on others.
+func (m BackupManifest) IsFull() bool {
+	return m.Parent == 0
+}
+
+// BackupConfig tunes a backup.
+type BackupConfig struct {
+	// Full forces a full backup, starting a new chain.
+	Full bool
+
+	// FreezeTimeout is how long the filesystem of a mounted
+	// volume can stay frozen while it's snapshotted. Zero
+	// disables freezing.
+	FreezeTimeout time.Duration
+}
+
+// backupDir is the directory of the backup 'seq'.
+func backupDir(dir string, seq int) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d", seq))
+}
+
+// ListBackups reads the manifests of the backups stored in
+// 'dir', sorted by sequence. Directories without a manifest
+// (e.g., of interrupted backups) are skipped.
+func ListBackups(dir string) (backups []*BackupManifest, err error) {
+	var (
+		entries []os.FileInfo
+		content []byte
+	)
+
+	entries, err = ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = errors.Wrapf(err, "couldn't list backups in %s", dir)
+		return
+	}
+
+	for _, entry := range entries {
+		seq, convErr := strconv.Atoi(entry.Name())
+		if convErr != nil || !entry.IsDir() {
+			continue
+		}
+
+		content, err = ioutil.ReadFile(
+			filepath.Join(backupDir(dir, seq), BackupManifestName))
+		if os.IsNotExist(err) {
+			err = nil
+			continue
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't read manifest of backup %d", seq)
+			return
+		}
+
+		manifest := new(BackupManifest)
+		err = json.Unmarshal(content, manifest)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"malformed manifest of backup %d", seq)
+			return
+		}
+
+		if manifest.Version != BackupVersion || manifest.Sequence != seq {
+			err = errors.Errorf(
+				"unsupported or misplaced manifest of backup %d", seq)
+			return
+		}
+
+		backups = append(backups, manifest)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Sequence < backups[j].Sequence
+	})
+
+	return
+}
+
+// BackupChain computes the backups needed to rebuild the
+// backup 'seq': the full backup it's based on followed by the
+// incremental ones up to it.
+func BackupChain(backups []*BackupManifest, seq int) (chain []*BackupManifest, err error) {
+	var bySeq = map[int]*BackupManifest{}
+
+	for _, backup := range backups {
+		bySeq[backup.Sequence] = backup
+	}
+
+	for seq != 0 {
+		backup, found := bySeq[seq]
+		if !found {
+			err = errors.Errorf("backup %d not found", seq)
+			return
+		}
+
+		if backup.Parent >= backup.Sequence {
+			err = errors.Errorf(
+				"backup %d has an invalid parent %d", seq, backup.Parent)
+			return
+		}
+
+		chain = append([]*BackupManifest{backup}, chain...)
+		seq = backup.Parent
+	}
+
+	return
+}
+
+// thinDeltaOutput is the xml output of 'thin_delta'.
+type thinDeltaOutput struct {
+	DataBlockSize int64 `xml:"data_block_size,attr"`
+	Diff          struct {
+		Ranges []struct {
+			XMLName xml.Name
+			Begin   int64 `xml:"begin,attr"`
+			Length  int64 `xml:"length,attr"`
+		} `xml:",any"`
+	} `xml:"diff"`
+}
+
+// ParseThinDelta parses the output of 'thin_delta', extracting
+// the extents (in bytes) that differ between the two thin
+// devices compared. Blocks that are only mapped in one of the
+// devices count as different.
+func ParseThinDelta(output []byte) (extents []Extent, err error) {
+	var (
+		delta     thinDeltaOutput
+		blockSize int64
+	)
+
+	err = xml.Unmarshal(output, &delta)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed thin_delta output")
+		return
+	}
+
+	if delta.DataBlockSize <= 0 {
+		err = errors.Errorf("thin_delta output lacks the data block size")
+		return
+	}
+
+	// the data block size is expressed in 512-byte sectors
+	blockSize = delta.DataBlockSize * 512
+
+	for _, r := range delta.Diff.Ranges {
+		switch r.XMLName.Local {
+		case "same":
+			continue
+		case "different", "left_only", "right_only":
+		default:
+			err = errors.Errorf(
+				"unknown thin_delta range %s", r.XMLName.Local)
+			return
+		}
+
+		extent := Extent{
+			Offset: r.Begin * blockSize,
+			Length: r.Length * blockSize,
+		}
+
+		last := len(extents) - 1
+		if last >= 0 && extents[last].Offset+extents[last].Length == extent.Offset {
+			extents[last].Length += extent.Length
+			continue
+		}
+
+		extents = append(extents, extent)
+	}
+
+	return
+}
+
+// ThinPoolDmName is the device mapper name of the thin pool
+// 'pool' of the volume group 'vg' ('-' are doubled in the
+// names that device mapper joins with '-').
+func ThinPoolDmName(vg, pool string) string {
+	return strings.Replace(vg, "-", "--", -1) + "-" +
+		strings.Replace(pool, "-", "--", -1)
+}
+
+// BuildThinDeltaArgs builds the command line (argv) that lists
+// the blocks that differ between the thin devices 'from' and
+// 'to' of the pool 'pool' of 'vg' using the metadata snapshot.
+func BuildThinDeltaArgs(vg, pool string, from, to uint64) (argv []string) {
+	argv = []string{
+		"thin_delta", "--metadata-snap",
+		"--snap1", strconv.FormatUint(from, 10),
+		"--snap2", strconv.FormatUint(to, 10),
+		"/dev/mapper/" + ThinPoolDmName(vg, pool+"_tmeta"),
+	}
+	return
+}
+
+// thinPoolMessage sends a message to the thin pool target of
+// 'pool'.
+func (l Lvm) thinPoolMessage(vg, pool, message string) (err error) {
+	_, err = l.Run("dmsetup", "message",
+		ThinPoolDmName(vg, pool)+"-tpool", "0", message)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't send %s to thin pool %s/%s", message, vg, pool)
+		return
+	}
+
+	return
+}
+
+// ThinDelta computes the extents that differ between the thin
+// volumes 'from' and 'to', which must share a pool. A snapshot
+// of the pool metadata is reserved while 'thin_delta' runs.
+func (l Lvm) ThinDelta(from, to *LogicalVolume) (extents []Extent, err error) {
+	var output []byte
+
+	if from.PoolLv == "" || from.PoolLv != to.PoolLv || from.VgName != to.VgName {
+		err = errors.Errorf(
+			"volumes %s and %s are not in the same thin pool",
+			from.LvName, to.LvName)
+		return
+	}
+
+	err = l.thinPoolMessage(from.VgName, from.PoolLv, "reserve_metadata_snap")
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		releaseErr := l.thinPoolMessage(from.VgName, from.PoolLv, "release_metadata_snap")
+		if err == nil {
+			err = releaseErr
+		}
+	}()
+
+	argv := BuildThinDeltaArgs(from.VgName, from.PoolLv,
+		uint64(from.ThinId), uint64(to.ThinId))
+
+	output, err = l.Run(argv[0], argv[1:]...)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to compute delta between %s and %s",
+			from.LvName, to.LvName)
+		return
+	}
+
+	extents, err = ParseThinDelta(output)
+	return
+}
+
+// WriteBackupChunks stores the 'extents' of 'src' as chunks of
+// at most 1MiB in 'dir', except for the ones that only contain
+// zeros, which are listed as zeroed.
+func WriteBackupChunks(dir string, src io.ReaderAt, extents []Extent) (chunks []BackupChunk, zeroed []Extent, err error) {
+	var (
+		buf   = make([]byte, cloneChunkSize)
+		zeros = make([]byte, cloneChunkSize)
+		n     int
+	)
+
+	err = os.MkdirAll(filepath.Join(dir, backupChunksDir), 0700)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't create chunks directory")
+		return
+	}
+
+	for _, extent := range extents {
+		end := extent.Offset + extent.Length
+
+		for offset := extent.Offset; offset < end; offset += int64(n) {
+			chunk := buf
+			if end-offset < int64(len(chunk)) {
+				chunk = chunk[:end-offset]
+			}
+
+			n, err = src.ReadAt(chunk, offset)
+			if err != nil && !(err == io.EOF && n == len(chunk)) {
+				err = errors.Wrapf(err,
+					"failed to read %d bytes at offset %d",
+					len(chunk), offset)
+				return
+			}
+			err = nil
+
+			if bytes.Equal(chunk, zeros[:len(chunk)]) {
+				last := len(zeroed) - 1
+				if last >= 0 && zeroed[last].Offset+zeroed[last].Length == offset {
+					zeroed[last].Length += int64(n)
+				} else {
+					zeroed = append(zeroed, Extent{offset, int64(n)})
+				}
+				continue
+			}
+
+			sum := sha256.Sum256(chunk)
+			err = ioutil.WriteFile(
+				filepath.Join(dir, backupChunksDir, strconv.FormatInt(offset, 10)),
+				chunk, 0600)
+			if err != nil {
+				err = errors.Wrapf(err,
+					"couldn't store chunk at offset %d", offset)
+				return
+			}
+
+			chunks = append(chunks, BackupChunk{
+				Offset: offset,
+				Length: int64(n),
+				Sha256: hex.EncodeToString(sum[:]),
+			})
+		}
+	}
+
+	return
+}
+
+// readBackupChunk reads a chunk of the backup 'backup',
+// verifying its checksum.
+func readBackupChunk(dir string, backup *BackupManifest, chunk BackupChunk) (content []byte, err error) {
+	content, err = ioutil.ReadFile(filepath.Join(
+		backupDir(dir, backup.Sequence),
+		backupChunksDir,
+		strconv.FormatInt(chunk.Offset, 10)))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't read chunk at offset %d of backup %d",
+			chunk.Offset, backup.Sequence)
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	if int64(len(content)) != chunk.Length ||
+		hex.EncodeToString(sum[:]) != chunk.Sha256 {
+		err = errors.Errorf(
+			"chunk at offset %d of backup %d is corrupt",
+			chunk.Offset, backup.Sequence)
+		content = nil
+		return
+	}
+
+	return
+}
+
+// RestoreBackupChain writes the data of the backups of 'chain'
+// (see BackupChain), stored in 'dir', to 'dst' such that it
+// ends up with the contents of the last backup of the chain.
+// The checksums of all the chunks of the chain are verified
+// before anything is written.
+// The extents that the full backup recorded as zeros are only
+// written with 'zeroGaps' - otherwise 'dst' must already read
+// as zeros (e.g., a new thin volume, which would get all of its
+// blocks provisioned).
+// Data beyond the size of the last backup (from before the
+// volume shrunk) is left out.
+func RestoreBackupChain(dir string, chain []*BackupManifest, dst io.WriterAt, zeroGaps bool) (err error) {
+	var (
+		content []byte
+		size    int64
+	)
+
+	if len(chain) == 0 || !chain[0].IsFull() {
+		err = errors.Errorf("a chain must start with a full backup")
+		return
+	}
+
+	size = int64(chain[len(chain)-1].Size)
+
+	for _, backup := range chain {
+		for _, chunk := range backup.Chunks {
+			_, err = readBackupChunk(dir, backup, chunk)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	for _, backup := range chain {
+		for _, chunk := range backup.Chunks {
+			if chunk.Offset >= size {
+				continue
+			}
+
+			// chunks are checked again in case they changed
+			// since the first pass.
+			content, err = readBackupChunk(dir, backup, chunk)
+			if err != nil {
+				return
+			}
+
+			if int64(len(content)) > size-chunk.Offset {
+				content = content[:size-chunk.Offset]
+			}
+
+			_, err = dst.WriteAt(content, chunk.Offset)
+			if err != nil {
+				err = errors.Wrapf(err,
+					"failed to write %d bytes at offset %d",
+					len(content), chunk.Offset)
+				return
+			}
+		}
+
+		if backup.IsFull() && !zeroGaps {
+			continue
+		}
+
+		for _, extent := range clampExtents(backup.Zeroed, size) {
+			err = writeZeros(dst, extent.Offset, extent.Offset+extent.Length)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// writeBackupManifest persists the manifest of a backup. It's
+// written last (and atomically) such that only complete
+// backups have one.
+func writeBackupManifest(dir string, manifest *BackupManifest) (err error) {
+	var (
+		content []byte
+		path    = filepath.Join(backupDir(dir, manifest.Sequence), BackupManifestName)
+	)
+
+	content, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't encode backup manifest")
+		return
+	}
+
+	err = ioutil.WriteFile(path+".tmp", content, 0600)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't write backup manifest")
+		return
+	}
+
+	return
+}
+
+// BackupVolume backs the thin volume 'vol' up to 'dir'.
+// A thin snapshot of the volume is taken (freezing its
+// filesystem if mounted) and kept until the next backup, which
+// only stores the blocks that changed since then as computed
+// by 'thin_delta'. The first backup of a volume (or one with
+// 'cfg.Full') is a full one.
+func (l Lvm) BackupVolume(vol *LogicalVolume, dir string, cfg BackupConfig) (manifest *BackupManifest, err error) {
+	var (
+		backups  []*BackupManifest
+		previous *BackupManifest
+		base     *LogicalVolume
+		snapshot *LogicalVolume
+		opts     MountOptions
+		extents  []Extent
+		device   *os.File
+		seq      = 1
+	)
+
+	if vol.PoolLv == "" {
+		err = errors.Errorf(
+			"volume %s is not thin - only thin volumes can be backed up incrementally",
+			vol.LvName)
+		return
+	}
+
+	opts, err = VolumeMountOptions(vol)
+	if err != nil {
+		return
+	}
+
+	backups, err = ListBackups(dir)
+	if err != nil {
+		return
+	}
+
+	if len(backups) > 0 {
+		previous = backups[len(backups)-1]
+		seq = previous.Sequence + 1
+
+		if previous.Volume != vol.VgName+"/"+vol.LvName {
+			err = errors.Errorf(
+				"%s holds backups of %s, not of %s/%s",
+				dir, previous.Volume, vol.VgName, vol.LvName)
+			return
+		}
+
+		base, err = l.GetLogicalVolume(vol.VgName + "/" + previous.Snapshot)
+		if err != nil {
+			return
+		}
+
+		if base == nil && !cfg.Full {
+			err = errors.Errorf(
+				"snapshot %s of the last backup is gone - "+
+					"a full backup is needed", previous.Snapshot)
+			return
+		}
+	}
+
+	snapshotCfg := LvCreationConfig{
+		Name:         fmt.Sprintf("%s_backup%06d", vol.LvName, seq),
+		VolumeGroup:  vol.VgName,
+		Snapshot:     vol.LvName,
+		ThinSnapshot: true,
+	}
+
+	err = l.CreateSnapshot(snapshotCfg, vol, cfg.FreezeTimeout)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			l.removeTemporaryVolume(vol.VgName, snapshotCfg.Name)
+			os.RemoveAll(backupDir(dir, seq))
+			err = errors.Wrapf(err,
+				"failed to back volume %s up", vol.LvName)
+		}
+	}()
+
+	snapshot, err = l.GetLogicalVolume(vol.VgName + "/" + snapshotCfg.Name)
+	if err == nil && (snapshot == nil || snapshot.LvDmPath == "") {
+		err = errors.Errorf(
+			"can't find the device of snapshot %s", snapshotCfg.Name)
+	}
+
+	if err != nil {
+		return
+	}
+
+	manifest = &BackupManifest{
+		Version:   BackupVersion,
+		Sequence:  seq,
+		Volume:    vol.VgName + "/" + vol.LvName,
+		Snapshot:  snapshot.LvName,
+		Size:      snapshot.LvSize,
+		FsType:    opts.FsType,
+		Tags:      ArchiveTags(vol),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if cfg.Full || base == nil {
+		extents = []Extent{{0, int64(snapshot.LvSize)}}
+	} else {
+		manifest.Parent = previous.Sequence
+
+		extents, err = l.ThinDelta(base, snapshot)
+		if err != nil {
+			return
+		}
+
+		// the volume might have grown since the last backup
+		if snapshot.LvSize > base.LvSize {
+			extents = append(extents, Extent{
+				int64(base.LvSize), int64(snapshot.LvSize - base.LvSize),
+			})
+		}
+	}
+
+	device, err = os.Open(snapshot.LvDmPath)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't open device %s", snapshot.LvDmPath)
+		return
+	}
+	defer device.Close()
+
+	manifest.Chunks, manifest.Zeroed, err = WriteBackupChunks(
+		backupDir(dir, seq), device, clampExtents(extents, int64(snapshot.LvSize)))
+	if err != nil {
+		return
+	}
+
+	err = writeBackupManifest(dir, manifest)
+	if err != nil {
+		return
+	}
+
+	if base != nil {
+		l.removeTemporaryVolume(base.VgName, base.LvName)
+	}
+
+	return
+}
+
+// clampExtents drops the parts of 'extents' beyond 'size'
+// (e.g., blocks of a pool bigger than the volume).
+func clampExtents(extents []Extent, size int64) (clamped []Extent) {
+	for _, extent := range extents {
+		if extent.Offset >= size {
+			continue
+		}
+
+		if extent.Offset+extent.Length > size {
+			extent.Length = size - extent.Offset
+		}
+
+		clamped = append(clamped, extent)
+	}
+
+	return
+}
+
+// RestoreBackup creates a volume as described by 'cfg' (see
+// BuildImportConfig) with the contents that the volume backed
+// up to 'dir' had at the time of the backup 'seq'. If 'seq' is
+// zero, the latest backup is restored.
+func (l Lvm) RestoreBackup(dir string, seq int, cfg LvCreationConfig) (err error) {
+	var (
+		backups []*BackupManifest
+		chain   []*BackupManifest
+		vol     *LogicalVolume
+		device  *os.File
+	)
+
+	backups, err = ListBackups(dir)
+	if err != nil {
+		return
+	}
+
+	if len(backups) == 0 {
+		err = errors.Errorf("no backups found in %s", dir)
+		return
+	}
+
+	if seq == 0 {
+		seq = backups[len(backups)-1].Sequence
+	}
+
+	chain, err = BackupChain(backups, seq)
+	if err != nil {
+		return
+	}
+
+	last := chain[len(chain)-1]
+	cfg, err = BuildImportConfig(cfg, ArchiveManifest{
+		Name:   last.Volume,
+		Size:   last.Size,
+		FsType: last.FsType,
+		Tags:   last.Tags,
+	})
+	if err != nil {
+		return
+	}
+
+	err = l.CreateLv(cfg)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			l.removeTemporaryVolume(cfg.VolumeGroup, cfg.Name)
+			err = errors.Wrapf(err, "failed to restore backup %d", seq)
+		}
+	}()
+
+	vol, err = l.GetLogicalVolume(cfg.VolumeGroup + "/" + cfg.Name)
+	if err == nil && (vol == nil || vol.LvDmPath == "") {
+		err = errors.Errorf(
+			"can't find the device of the restored volume %s", cfg.Name)
+	}
+
+	if err != nil {
+		return
+	}
+
+	device, err = os.OpenFile(vol.LvDmPath, os.O_WRONLY, 0)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't open device %s", vol.LvDmPath)
+		return
+	}
+	defer device.Close()
+
+	// only thin volumes read as zeros where nothing
+	// was written.
+	err = RestoreBackupChain(dir, chain, device, cfg.ThinPool == "")
+	if err != nil {
+		return
+	}
+
+	err = device.Sync()
+	return
+}
@@ -0,0 +1,267 @@
+package lib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const thinDeltaXml = `<superblock uuid="" time="1" transaction="2" data_block_size="128" nr_data_blocks="1600">
+  <diff left="1" right="2">
+    <same begin="0" length="4"/>
+    <different begin="4" length="2"/>
+    <right_only begin="6" length="1"/>
+    <same begin="7" length="10"/>
+    <left_only begin="17" length="3"/>
+  </diff>
+</superblock>`
+
+func TestParseThinDelta(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		output      string
+		expected    []Extent
+		shouldError bool
+	}{
+		{
+			desc:   "merges adjacent changes and skips same ranges",
+			output: thinDeltaXml,
+			expected: []Extent{
+				{4 * 65536, 3 * 65536},
+				{17 * 65536, 3 * 65536},
+			},
+		},
+		{
+			desc:   "no changes",
+			output: `<superblock data_block_size="128"><diff left="1" right="2"></diff></superblock>`,
+		},
+		{
+			desc:        "missing block size",
+			output:      `<superblock><diff left="1" right="2"></diff></superblock>`,
+			shouldError: true,
+		},
+		{
+			desc:        "unknown range",
+			output:      `<superblock data_block_size="128"><diff><moved begin="1" length="1"/></diff></superblock>`,
+			shouldError: true,
+		},
+		{
+			desc:        "malformed",
+			output:      `<superblock`,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			extents, err := ParseThinDelta([]byte(tc.output))
+			if tc.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, extents)
+		})
+	}
+}
+
+func TestBuildThinDeltaArgs(t *testing.T) {
+	assert.Equal(t, []string{
+		"thin_delta", "--metadata-snap",
+		"--snap1", "1", "--snap2", "5",
+		"/dev/mapper/my--vg-pool_tmeta",
+	}, BuildThinDeltaArgs("my-vg", "pool", 1, 5))
+}
+
+func TestThinDelta(t *testing.T) {
+	var (
+		runner = &cannedRunner{output: []byte(thinDeltaXml)}
+		l      = Lvm{logger: zerolog.Nop(), runner: runner}
+		from   = &LogicalVolume{LvName: "a", VgName: "vg", PoolLv: "pool", ThinId: 1}
+		to     = &LogicalVolume{LvName: "b", VgName: "vg", PoolLv: "pool", ThinId: 2}
+	)
+
+	extents, err := l.ThinDelta(from, to)
+	require.NoError(t, err)
+	assert.Len(t, extents, 2)
+
+	// the metadata snapshot is released at the end
+	assert.Equal(t, "dmsetup", runner.name)
+	assert.Equal(t, []string{"message", "vg-pool-tpool", "0", "release_metadata_snap"}, runner.args)
+
+	_, err = l.ThinDelta(from, &LogicalVolume{LvName: "c", VgName: "vg", PoolLv: "other"})
+	assert.Error(t, err)
+}
+
+func TestBackupChain(t *testing.T) {
+	var backups = []*BackupManifest{
+		{Sequence: 1},
+		{Sequence: 2, Parent: 1},
+		{Sequence: 3, Parent: 2},
+		{Sequence: 4},
+		{Sequence: 5, Parent: 4},
+		{Sequence: 7, Parent: 6},
+	}
+
+	var testCases = []struct {
+		seq         int
+		expected    []int
+		shouldError bool
+	}{
+		{seq: 1, expected: []int{1}},
+		{seq: 3, expected: []int{1, 2, 3}},
+		{seq: 5, expected: []int{4, 5}},
+		{seq: 7, shouldError: true},
+		{seq: 8, shouldError: true},
+	}
+
+	for _, tc := range testCases {
+		chain, err := BackupChain(backups, tc.seq)
+		if tc.shouldError {
+			assert.Error(t, err)
+			continue
+		}
+
+		require.NoError(t, err)
+
+		seqs := []int{}
+		for _, backup := range chain {
+			seqs = append(seqs, backup.Sequence)
+		}
+		assert.Equal(t, tc.expected, seqs)
+	}
+}
+
+func TestBackups_restoreChain(t *testing.T) {
+	var (
+		size = int64(3*cloneChunkSize + 10)
+		v1   = rawImage()
+		v2   = append([]byte{}, v1...)
+	)
+
+	dir, err := ioutil.TempDir("", "golvm-backups")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	full := &BackupManifest{Version: BackupVersion, Sequence: 1, Volume: "vg/vol", Size: ByteSize(size)}
+	full.Chunks, full.Zeroed, err = WriteBackupChunks(backupDir(dir, 1),
+		bytes.NewReader(v1), []Extent{{0, size}})
+	require.NoError(t, err)
+	assert.Len(t, full.Chunks, 2)
+	assert.Equal(t, []Extent{{0, cloneChunkSize}, {2 * cloneChunkSize, cloneChunkSize}}, full.Zeroed)
+	require.NoError(t, writeBackupManifest(dir, full))
+
+	// 'hello' gets discarded and 'again' written elsewhere
+	copy(v2[cloneChunkSize+1:], make([]byte, 5))
+	copy(v2[10:], "again")
+
+	incr := &BackupManifest{Version: BackupVersion, Sequence: 2, Parent: 1, Volume: "vg/vol", Size: ByteSize(size)}
+	incr.Chunks, incr.Zeroed, err = WriteBackupChunks(backupDir(dir, 2),
+		bytes.NewReader(v2), []Extent{{0, 65536}, {cloneChunkSize, 65536}})
+	require.NoError(t, err)
+	require.NoError(t, writeBackupManifest(dir, incr))
+
+	// interrupted backups have no manifest
+	require.NoError(t, os.MkdirAll(backupDir(dir, 3), 0700))
+
+	backups, err := ListBackups(dir)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+
+	for seq, expected := range map[int][]byte{1: v1, 2: v2} {
+		chain, err := BackupChain(backups, seq)
+		require.NoError(t, err)
+
+		device := &memoryDevice{data: bytes.Repeat([]byte{0xff}, int(size))}
+		require.NoError(t, RestoreBackupChain(dir, chain, device, true))
+		assert.Equal(t, expected, device.data)
+
+		// devices that read as zeros only get the zeros
+		// of incremental backups written
+		device = &memoryDevice{data: make([]byte, size)}
+		require.NoError(t, RestoreBackupChain(dir, chain, device, false))
+		assert.Equal(t, expected, device.data)
+
+		written := 0
+		for _, backup := range chain {
+			for _, chunk := range backup.Chunks {
+				written += int(chunk.Length)
+			}
+
+			if !backup.IsFull() {
+				for _, extent := range backup.Zeroed {
+					written += int(extent.Length)
+				}
+			}
+		}
+		assert.Equal(t, written, device.written)
+	}
+
+	// corrupt chunks are detected
+	chunk := filepath.Join(backupDir(dir, 2), backupChunksDir, "0")
+	require.NoError(t, ioutil.WriteFile(chunk, []byte("corrupt"), 0600))
+
+	chain, err := BackupChain(backups, 2)
+	require.NoError(t, err)
+
+	// nothing gets written, not even the intact full backup
+	device := &memoryDevice{data: make([]byte, size)}
+	assert.Error(t, RestoreBackupChain(dir, chain, device, true))
+	assert.Zero(t, device.written)
+
+	assert.Error(t, RestoreBackupChain(dir, chain[1:],
+		&memoryDevice{data: make([]byte, size)}, true))
+}
+
+func TestBackups_restoreShrunkChain(t *testing.T) {
+	var (
+		size   = int64(3*cloneChunkSize + 10)
+		shrunk = int64(cloneChunkSize + 100)
+		v1     = rawImage()
+		v2     = append([]byte{}, v1[:shrunk]...)
+	)
+
+	dir, err := ioutil.TempDir("", "golvm-backups")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	full := &BackupManifest{Version: BackupVersion, Sequence: 1, Volume: "vg/vol", Size: ByteSize(size)}
+	full.Chunks, full.Zeroed, err = WriteBackupChunks(backupDir(dir, 1),
+		bytes.NewReader(v1), []Extent{{0, size}})
+	require.NoError(t, err)
+	require.NoError(t, writeBackupManifest(dir, full))
+
+	// the volume shrunk, leaving 'world' and part of the
+	// chunk with 'hello' out
+	copy(v2[20:], "again")
+
+	incr := &BackupManifest{Version: BackupVersion, Sequence: 2, Parent: 1, Volume: "vg/vol", Size: ByteSize(shrunk)}
+	incr.Chunks, incr.Zeroed, err = WriteBackupChunks(backupDir(dir, 2),
+		bytes.NewReader(v2), clampExtents([]Extent{{0, 65536}, {size, 65536}}, shrunk))
+	require.NoError(t, err)
+	require.NoError(t, writeBackupManifest(dir, incr))
+
+	backups, err := ListBackups(dir)
+	require.NoError(t, err)
+
+	chain, err := BackupChain(backups, 2)
+	require.NoError(t, err)
+
+	for _, zeroGaps := range []bool{true, false} {
+		device := &memoryDevice{data: make([]byte, shrunk)}
+		require.NoError(t, RestoreBackupChain(dir, chain, device, zeroGaps))
+		assert.Equal(t, v2, device.data)
+	}
+}
+
+func TestClampExtents(t *testing.T) {
+	assert.Equal(t, []Extent{{0, 10}, {20, 5}},
+		clampExtents([]Extent{{0, 10}, {20, 10}, {30, 10}}, 25))
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"github.com/pkg/errors"
+
+	units "github.com/docker/go-units"
+)
+
+// ByteSize represents an exact amount of bytes as reported
+// by lvm when running with `--units=b`.
+type ByteSize uint64
+
+// UnmarshalJSON decodes a size in bytes. Both the string
+// representation used by the 'json' report format (e.g.,
+// "12582912" or "12582912B") and the numbers used by the
+// 'json_std' format are accepted. Empty strings and nulls
+// decode to zero.
+func (b *ByteSize) UnmarshalJSON(data []byte) (err error) {
+	var value uint64
+
+	value, err = decodeReportUint(data, "B")
+	if err != nil {
+		err = errors.Wrapf(err, "malformed size")
+		return
+	}
+
+	*b = ByteSize(value)
+	return
+}
+
+// String returns a human readable representation of
+// the size using binary units (e.g., "12 MiB").
+func (b ByteSize) String() string {
+	return units.BytesSize(float64(b))
+}
+
+// Extents computes the number of extents of size 'extentSize'
+// needed to hold 'b' bytes - rounding up like lvm does.
+// An 'extentSize' of zero means that the extent size is not
+// known, in which case every byte counts as an extent.
+func (b ByteSize) Extents(extentSize ByteSize) uint64 {
+	if extentSize == 0 {
+		return uint64(b)
+	}
+
+	return (uint64(b) + uint64(extentSize) - 1) / uint64(extentSize)
+}
+
+// RoundUpToExtent rounds a size up to the next multiple of
+// 'extentSize', which is the amount of space that lvm actually
+// allocates for a volume of that size.
+func (b ByteSize) RoundUpToExtent(extentSize ByteSize) ByteSize {
+	if extentSize == 0 {
+		return b
+	}
+
+	return ByteSize(b.Extents(extentSize) * uint64(extentSize))
+}
+
+// ParseByteSize converts a human readable size (e.g., "10M" or
+// "1.5G") to a ByteSize. Units are interpreted as powers of 2,
+// the same way that lvm interprets them.
+func ParseByteSize(size string) (b ByteSize, err error) {
+	var bytes uint64
+
+	bytes, err = FromHumanSize(size)
+	if err != nil {
+		return
+	}
+
+	b = ByteSize(bytes)
+	return
+}
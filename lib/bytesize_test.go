@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestByteSizeUnmarshalJSON(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    ByteSize
+		shouldError bool
+	}{
+		{
+			desc:     "empty string is zero",
+			input:    `""`,
+			expected: 0,
+		},
+		{
+			desc:     "plain bytes",
+			input:    `"12582912"`,
+			expected: 12582912,
+		},
+		{
+			desc:     "bytes with suffix",
+			input:    `"12582912B"`,
+			expected: 12582912,
+		},
+		{
+			desc:     "json_std numbers",
+			input:    `12582912`,
+			expected: 12582912,
+		},
+		{
+			desc:     "json_std null is zero",
+			input:    `null`,
+			expected: 0,
+		},
+		{
+			desc:        "decimals should fail",
+			input:       `"12.00"`,
+			shouldError: true,
+		},
+		{
+			desc:        "garbage should fail",
+			input:       `"abc"`,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var actual ByteSize
+
+			err := json.Unmarshal([]byte(tc.input), &actual)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestByteSizeExtentRounding(t *testing.T) {
+	var mib = ByteSize(1024 * 1024)
+
+	assert.Equal(t, uint64(3), (10 * mib).Extents(4*mib))
+	assert.Equal(t, 12*mib, (10 * mib).RoundUpToExtent(4*mib))
+	assert.Equal(t, 8*mib, (8 * mib).RoundUpToExtent(4*mib))
+	assert.Equal(t, uint64(0), ByteSize(0).Extents(4*mib))
+	assert.Equal(t, 10*mib, (10 * mib).RoundUpToExtent(0))
+}
+
+func TestParseByteSize(t *testing.T) {
+	size, err := ParseByteSize("10M")
+	require.NoError(t, err)
+	assert.Equal(t, ByteSize(10*1024*1024), size)
+	assert.Equal(t, "10 MiB", size.String())
+
+	_, err = ParseByteSize("ten")
+	require.Error(t, err)
+}
@@ -0,0 +1,278 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	versionRegex = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+)
+
+// Version represents a 'major.minor.patch' version of one of
+// the tools that golvm shells out to.
+type Version struct {
+	Major uint64
+	Minor uint64
+	Patch uint64
+}
+
+// ParseVersion extracts the first version found in the output
+// of a '--version'-like command (e.g., "LVM version:
+// 2.03.11(2) (2021-01-08)" or "cryptsetup 2.3.7").
+func ParseVersion(output string) (version Version, err error) {
+	var matches = versionRegex.FindStringSubmatch(output)
+
+	if matches == nil {
+		err = errors.Errorf(
+			"no version found in '%s'", strings.TrimSpace(output))
+		return
+	}
+
+	version.Major, _ = strconv.ParseUint(matches[1], 10, 64)
+	version.Minor, _ = strconv.ParseUint(matches[2], 10, 64)
+	if matches[3] != "" {
+		version.Patch, _ = strconv.ParseUint(matches[3], 10, 64)
+	}
+
+	return
+}
+
+// AtLeast indicates whether the version is equal to or newer
+// than 'major.minor.patch'.
+func (v Version) AtLeast(major, minor, patch uint64) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+
+	return v.Patch >= patch
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// ToolVersion records whether a tool could be found and,
+// if so, which version of it is installed.
+type ToolVersion struct {
+	Tool    string
+	Found   bool
+	Version Version
+}
+
+func (t ToolVersion) String() string {
+	if !t.Found {
+		return "not found"
+	}
+
+	return t.Version.String()
+}
+
+// Feature is an entry of the capability matrix.
+type Feature struct {
+	Name      string
+	Supported bool
+}
+
+// Capabilities describes the tools installed in the system
+// and the features that golvm can rely on.
+type Capabilities struct {
+	Lvm        ToolVersion
+	Cryptsetup ToolVersion
+	Mke2fs     ToolVersion
+	Xfsprogs   ToolVersion
+	Btrfsprogs ToolVersion
+	ThinTools  ToolVersion
+
+	// Segtypes is the set of segment types (e.g., 'thin-pool'
+	// or 'raid5') that the installed lvm2 reports supporting.
+	Segtypes map[string]bool
+
+	JsonReport    bool
+	JsonStdReport bool
+	FullReport    bool
+	Thin          bool
+	Raid          bool
+	Vdo           bool
+	Luks2         bool
+}
+
+// ParseSegtypes parses the output of 'lvm segtypes', which
+// lists one segment type per line.
+func ParseSegtypes(output string) (segtypes map[string]bool) {
+	segtypes = make(map[string]bool)
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		segtypes[line] = true
+	}
+
+	return
+}
+
+// DeriveFeatures fills the feature flags of the capabilities
+// based on the tool versions and segment types gathered.
+//	-	JSON reports and 'lvm fullreport' came with lvm2 2.02.158;
+//	-	the 'json_std' report format came with lvm2 2.03.17;
+//	-	LUKS2 requires cryptsetup 2.
+func (c *Capabilities) DeriveFeatures() {
+	var lvm = c.Lvm.Version
+
+	c.JsonReport = c.Lvm.Found && lvm.AtLeast(2, 2, 158)
+	c.FullReport = c.Lvm.Found && lvm.AtLeast(2, 2, 158)
+	c.JsonStdReport = c.Lvm.Found && lvm.AtLeast(2, 3, 17)
+	c.Thin = c.Segtypes["thin-pool"] && c.Segtypes["thin"]
+	c.Raid = c.Segtypes[LayoutRaid1] ||
+		c.Segtypes[LayoutRaid5] ||
+		c.Segtypes[LayoutRaid10]
+	c.Vdo = c.Segtypes["vdo"]
+	c.Luks2 = c.Cryptsetup.Found && c.Cryptsetup.Version.AtLeast(2, 0, 0)
+}
+
+// Tools lists the versions of all the tools probed.
+func (c Capabilities) Tools() []ToolVersion {
+	return []ToolVersion{
+		c.Lvm,
+		c.Cryptsetup,
+		c.Mke2fs,
+		c.Xfsprogs,
+		c.Btrfsprogs,
+		c.ThinTools,
+	}
+}
+
+// Features lists the capability matrix in a stable order.
+func (c Capabilities) Features() []Feature {
+	return []Feature{
+		{"json report", c.JsonReport},
+		{"json_std report", c.JsonStdReport},
+		{"fullreport", c.FullReport},
+		{"thin", c.Thin},
+		{"raid", c.Raid},
+		{"vdo", c.Vdo},
+		{"luks", c.Cryptsetup.Found},
+		{"luks2", c.Luks2},
+		{"thin backups", c.Thin && c.ThinTools.Found},
+	}
+}
+
+// CheckCreationConfig verifies that the installed tools
+// support everything that a creation configuration asks for.
+func (c Capabilities) CheckCreationConfig(cfg LvCreationConfig) (err error) {
+	if !c.JsonReport {
+		err = errors.Errorf(
+			"lvm2 %s doesn't support json reports (>= 2.02.158 required)",
+			c.Lvm)
+		return
+	}
+
+	if cfg.ThinPool != "" && !c.Thin {
+		err = errors.Errorf(
+			"thin volumes requested but lvm2 doesn't support " +
+				"thin provisioning (missing thin-pool segment type)")
+		return
+	}
+
+	if cfg.Type != "" && !c.Segtypes[cfg.Type] {
+		err = errors.Errorf(
+			"%s volumes requested but lvm2 doesn't support "+
+				"the %s segment type", cfg.Type, cfg.Type)
+		return
+	}
+
+	if cfg.KeyFile != "" && !c.Cryptsetup.Found {
+		err = errors.Errorf(
+			"encryption requested but cryptsetup wasn't found")
+		return
+	}
+
+	switch cfg.FsType {
+	case "ext4":
+		if !c.Mke2fs.Found {
+			err = errors.Errorf(
+				"ext4 requested but mke2fs (e2fsprogs) wasn't found")
+			return
+		}
+	case "xfs":
+		if !c.Xfsprogs.Found {
+			err = errors.Errorf(
+				"xfs requested but mkfs.xfs (xfsprogs) wasn't found")
+			return
+		}
+	case "btrfs":
+		if !c.Btrfsprogs.Found {
+			err = errors.Errorf(
+				"btrfs requested but mkfs.btrfs (btrfs-progs) wasn't found")
+			return
+		}
+	}
+
+	return
+}
+
+// probeTool runs a version command and records the version
+// found. Failures to run the command mean that the tool is
+// missing.
+func (l Lvm) probeTool(tool string, name string, args ...string) (version ToolVersion) {
+	version.Tool = tool
+
+	output, err := l.Run(name, args...)
+	if err != nil {
+		l.logger.Debug().
+			Err(err).
+			Str("tool", tool).
+			Msg("tool not found")
+		return
+	}
+
+	version.Found = true
+	version.Version, err = ParseVersion(string(output))
+	if err != nil {
+		l.logger.Warn().
+			Err(err).
+			Str("tool", tool).
+			Msg("couldn't parse tool version")
+	}
+
+	return
+}
+
+// ProbeCapabilities gathers the versions of lvm2, cryptsetup,
+// e2fsprogs, xfsprogs, btrfs-progs and thin-provisioning-tools
+// as well as the segment types supported by lvm2 and derives
+// the features available.
+func (l Lvm) ProbeCapabilities() (caps Capabilities) {
+	caps.Lvm = l.probeTool("lvm2", "lvm", "version")
+	caps.Cryptsetup = l.probeTool("cryptsetup", "cryptsetup", "--version")
+	caps.Mke2fs = l.probeTool("e2fsprogs", "mke2fs", "-V")
+	caps.Xfsprogs = l.probeTool("xfsprogs", "mkfs.xfs", "-V")
+	caps.Btrfsprogs = l.probeTool("btrfs-progs", "mkfs.btrfs", "--version")
+	caps.ThinTools = l.probeTool("thin-provisioning-tools", "thin_delta", "-V")
+
+	caps.Segtypes = map[string]bool{}
+	if caps.Lvm.Found {
+		output, err := l.Run("lvm", "segtypes")
+		if err != nil {
+			l.logger.Warn().
+				Err(err).
+				Msg("couldn't list lvm segment types")
+		} else {
+			caps.Segtypes = ParseSegtypes(string(output))
+		}
+	}
+
+	caps.DeriveFeatures()
+	return
+}
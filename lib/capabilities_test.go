@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	lvmVersionOutput = `  LVM version:     2.03.11(2) (2021-01-08)
+  Library version: 1.02.175 (2021-01-08)
+  Driver version:  4.45.0
+`
+	lvmSegtypesOutput = `  cache
+  cache-pool
+  error
+  linear
+  mirror
+  raid1
+  raid10
+  raid5
+  snapshot
+  striped
+  thin
+  thin-pool
+  zero
+`
+)
+
+func TestParseVersion(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    Version
+		shouldError bool
+	}{
+		{
+			desc:        "empty output should fail",
+			input:       "",
+			shouldError: true,
+		},
+		{
+			desc:     "lvm version",
+			input:    lvmVersionOutput,
+			expected: Version{2, 3, 11},
+		},
+		{
+			desc:     "cryptsetup",
+			input:    "cryptsetup 2.3.7\n",
+			expected: Version{2, 3, 7},
+		},
+		{
+			desc:     "mke2fs",
+			input:    "mke2fs 1.46.5 (30-Dec-2021)\n\tUsing EXT2FS Library version 1.46.5\n",
+			expected: Version{1, 46, 5},
+		},
+		{
+			desc:     "lsblk",
+			input:    "lsblk from util-linux 2.37.2\n",
+			expected: Version{2, 37, 2},
+		},
+		{
+			desc:     "missing patch",
+			input:    "tool 1.2\n",
+			expected: Version{1, 2, 0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseVersion(tc.input)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	var v = Version{2, 2, 158}
+
+	assert.True(t, v.AtLeast(2, 2, 158))
+	assert.True(t, v.AtLeast(2, 2, 100))
+	assert.True(t, v.AtLeast(1, 9, 9))
+	assert.False(t, v.AtLeast(2, 2, 159))
+	assert.False(t, v.AtLeast(2, 3, 0))
+	assert.False(t, v.AtLeast(3, 0, 0))
+}
+
+func TestDeriveFeatures(t *testing.T) {
+	var caps = Capabilities{
+		Lvm:        ToolVersion{Tool: "lvm2", Found: true, Version: Version{2, 3, 11}},
+		Cryptsetup: ToolVersion{Tool: "cryptsetup", Found: true, Version: Version{2, 3, 7}},
+		Segtypes:   ParseSegtypes(lvmSegtypesOutput),
+	}
+
+	caps.DeriveFeatures()
+
+	assert.True(t, caps.JsonReport)
+	assert.True(t, caps.FullReport)
+	assert.False(t, caps.JsonStdReport)
+	assert.True(t, caps.Thin)
+	assert.True(t, caps.Raid)
+	assert.False(t, caps.Vdo)
+	assert.True(t, caps.Luks2)
+}
+
+func TestCheckCreationConfig(t *testing.T) {
+	var caps = Capabilities{
+		Lvm:      ToolVersion{Tool: "lvm2", Found: true, Version: Version{2, 3, 11}},
+		Mke2fs:   ToolVersion{Tool: "e2fsprogs", Found: true, Version: Version{1, 46, 5}},
+		Segtypes: ParseSegtypes("linear\nstriped\nraid1\n"),
+	}
+	caps.DeriveFeatures()
+
+	var testCases = []struct {
+		desc        string
+		caps        Capabilities
+		cfg         LvCreationConfig
+		shouldError bool
+	}{
+		{
+			desc: "plain volume",
+			caps: caps,
+			cfg:  LvCreationConfig{Name: "lv", Size: "10M"},
+		},
+		{
+			desc:        "old lvm without json reports",
+			caps:        Capabilities{Lvm: ToolVersion{Found: true, Version: Version{2, 2, 100}}},
+			cfg:         LvCreationConfig{Name: "lv", Size: "10M"},
+			shouldError: true,
+		},
+		{
+			desc:        "thin without thin-pool support",
+			caps:        caps,
+			cfg:         LvCreationConfig{Name: "lv", Size: "10M", ThinPool: "pool"},
+			shouldError: true,
+		},
+		{
+			desc: "supported raid type",
+			caps: caps,
+			cfg:  LvCreationConfig{Name: "lv", Size: "10M", Type: LayoutRaid1},
+		},
+		{
+			desc:        "unsupported raid type",
+			caps:        caps,
+			cfg:         LvCreationConfig{Name: "lv", Size: "10M", Type: LayoutRaid5},
+			shouldError: true,
+		},
+		{
+			desc:        "keyfile without cryptsetup",
+			caps:        caps,
+			cfg:         LvCreationConfig{Name: "lv", Size: "10M", KeyFile: "/key"},
+			shouldError: true,
+		},
+		{
+			desc: "ext4 with e2fsprogs",
+			caps: caps,
+			cfg:  LvCreationConfig{Name: "lv", Size: "10M", FsType: "ext4"},
+		},
+		{
+			desc:        "xfs without xfsprogs",
+			caps:        caps,
+			cfg:         LvCreationConfig{Name: "lv", Size: "10M", FsType: "xfs"},
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := tc.caps.CheckCreationConfig(tc.cfg)
+			if tc.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// CloneTagPrefix prefixes the tag that records the
+	// volume (vg/lv) that a clone was copied from.
+	CloneTagPrefix = "golvm/clone-of="
+
+	// cloneChunkSize is the amount of data copied at once
+	// when cloning thick volumes.
+	cloneChunkSize = 1 << 20
+)
+
+// CloneOptions tunes the cloning of a volume.
+type CloneOptions struct {
+	// Sparse skips writing the chunks of the source that
+	// only contain zeros. It requires the clone to be a
+	// thin volume, whose unwritten blocks read as zeros.
+	Sparse bool
+
+	// FreezeTimeout is how long the filesystem of a mounted
+	// thin source can stay frozen while it's snapshotted.
+	// Zero disables freezing.
+	FreezeTimeout time.Duration
+
+	// Progress, if set, is called as the copy of a thick
+	// source advances.
+	Progress func(copied, total int64)
+}
+
+// CloneSource retrieves the volume (vg/lv) that a clone was
+// copied from, if any.
+func CloneSource(vol *LogicalVolume) (source string, found bool) {
+	for _, tag := range vol.LvTags {
+		if strings.HasPrefix(tag, CloneTagPrefix) {
+			source = strings.TrimPrefix(tag, CloneTagPrefix)
+			found = true
+			return
+		}
+	}
+
+	return
+}
+
+// BuildCloneConfig adapts the configuration of a volume to be
+// created as a clone of 'source'.
+// Thin sources are cloned with a thin snapshot, which lives in
+// the same pool. Thick sources are copied into a new volume
+// that is at least as big as the source and that, if not
+// specified, gets the size of the source.
+func BuildCloneConfig(cfg LvCreationConfig, source *LogicalVolume) (clone LvCreationConfig, err error) {
+	var size ByteSize
+
+	clone = cfg
+
+	if cfg.Snapshot != "" {
+		err = errors.Errorf("a clone can't be a snapshot")
+		return
+	}
+
+	if cfg.KeyFile != "" {
+		err = errors.Errorf(
+			"clones reuse the encryption of their source - " +
+				"a keyfile can't be specified")
+		return
+	}
+
+	clone.Tags = append(append([]string{}, cfg.Tags...),
+		CloneTagPrefix+source.VgName+"/"+source.LvName)
+
+	if source.PoolLv != "" {
+		if cfg.Size != "" {
+			err = errors.Errorf(
+				"clones of thin volumes take the size of their source")
+			return
+		}
+
+		if cfg.ThinPool != "" && cfg.ThinPool != source.PoolLv {
+			err = errors.Errorf(
+				"clones of thin volumes live in the pool %s of their source",
+				source.PoolLv)
+			return
+		}
+
+		if cfg.VolumeGroup != "" && cfg.VolumeGroup != source.VgName {
+			err = errors.Errorf(
+				"clones of thin volumes live in the volume group %s of their source",
+				source.VgName)
+			return
+		}
+
+		clone.ThinPool = ""
+		clone.Snapshot = source.LvName
+		clone.ThinSnapshot = true
+		clone.VolumeGroup = source.VgName
+		return
+	}
+
+	if cfg.Size == "" {
+		clone.Size = fmt.Sprintf("%db", uint64(source.LvSize))
+		return
+	}
+
+	size, err = ParseByteSize(cfg.Size)
+	if err != nil {
+		err = errors.Wrapf(err, "invalid size %s", cfg.Size)
+		return
+	}
+
+	if size < source.LvSize {
+		err = errors.Errorf(
+			"clone of %s must be at least as big as it (%s)",
+			source.LvName, source.LvSize)
+		return
+	}
+
+	return
+}
+
+// CopyBlocks copies 'size' bytes from 'src' to 'dst' in
+// chunks, calling 'progress' (if set) every time another
+// percent of the data is copied. With 'sparse', the chunks
+// that only contain zeros are not written.
+func CopyBlocks(dst io.WriterAt, src io.ReaderAt, size int64, sparse bool, progress func(copied, total int64)) (err error) {
+	var (
+		buf      = make([]byte, cloneChunkSize)
+		zeros    = make([]byte, cloneChunkSize)
+		reported = int64(-1)
+		offset   int64
+		n        int
+	)
+
+	for offset < size {
+		chunk := buf
+		if size-offset < int64(len(chunk)) {
+			chunk = chunk[:size-offset]
+		}
+
+		n, err = src.ReadAt(chunk, offset)
+		if err != nil && !(err == io.EOF && n == len(chunk)) {
+			err = errors.Wrapf(err,
+				"failed to read %d bytes at offset %d",
+				len(chunk), offset)
+			return
+		}
+		err = nil
+
+		if !sparse || !bytes.Equal(chunk, zeros[:len(chunk)]) {
+			_, err = dst.WriteAt(chunk, offset)
+			if err != nil {
+				err = errors.Wrapf(err,
+					"failed to write %d bytes at offset %d",
+					len(chunk), offset)
+				return
+			}
+		}
+
+		offset += int64(len(chunk))
+
+		if progress != nil && offset*100/size > reported {
+			reported = offset * 100 / size
+			progress(offset, size)
+		}
+	}
+
+	return
+}
+
+// copyDevice copies the contents of the device 'source' to the
+// device 'target'.
+func copyDevice(target, source string, size int64, sparse bool, progress func(copied, total int64)) (err error) {
+	var src, dst *os.File
+
+	src, err = os.Open(source)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't open device %s", source)
+		return
+	}
+	defer src.Close()
+
+	dst, err = os.OpenFile(target, os.O_WRONLY, 0)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't open device %s", target)
+		return
+	}
+	defer dst.Close()
+
+	err = CopyBlocks(dst, src, size, sparse, progress)
+	if err != nil {
+		return
+	}
+
+	err = dst.Sync()
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't flush device %s", target)
+		return
+	}
+
+	return
+}
+
+// randomUuid generates a random (version 4) UUID.
+func randomUuid() (uuid string, err error) {
+	var raw = make([]byte, 16)
+
+	_, err = rand.Read(raw)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't generate random uuid")
+		return
+	}
+
+	raw[6] = (raw[6] & 0x0f) | 0x40
+	raw[8] = (raw[8] & 0x3f) | 0x80
+
+	uuid = formatUUID(raw)
+	return
+}
+
+// BuildLuksUuidArgs builds the command line (argv) that gives
+// the luks header of 'device' the UUID 'uuid'.
+func BuildLuksUuidArgs(device, uuid string) (argv []string, err error) {
+	if device == "" || uuid == "" {
+		err = errors.Errorf("a device and a uuid must be specified")
+		return
+	}
+
+	argv = []string{"cryptsetup", "luksUUID", "--uuid", uuid, device}
+	return
+}
+
+// regenerateLuksUuid gives the luks header of a cloned device
+// a new UUID such that it can be told apart from the one of
+// its source. The key stays the same.
+func (l Lvm) regenerateLuksUuid(device string) (err error) {
+	var (
+		uuid string
+		argv []string
+	)
+
+	uuid, err = randomUuid()
+	if err != nil {
+		return
+	}
+
+	argv, err = BuildLuksUuidArgs(device, uuid)
+	if err != nil {
+		return
+	}
+
+	_, err = l.Run(argv[0], argv[1:]...)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't regenerate the luks uuid of device %s", device)
+		return
+	}
+
+	return
+}
+
+// CloneVolume creates a writable and independent copy of
+// 'source' as described by 'cfg', which must have been built
+// by BuildCloneConfig.
+// Thin sources are snapshotted (freezing their filesystem if
+// mounted) while thick ones, which must not be mounted, are
+// copied block by block. Clones of luks volumes keep the key
+// of their source but get a new luks UUID.
+func (l Lvm) CloneVolume(cfg LvCreationConfig, source *LogicalVolume, opts CloneOptions) (err error) {
+	var (
+		sig         *FsSignature
+		clone       *LogicalVolume
+		mountpoints []string
+	)
+
+	if source.LvDmPath == "" {
+		err = errors.Errorf(
+			"can't find the device of volume %s - is it active?",
+			source.LvName)
+		return
+	}
+
+	sig, err = ProbeDevice(source.LvDmPath)
+	if err != nil {
+		return
+	}
+
+	if cfg.ThinSnapshot {
+		if opts.Sparse {
+			err = errors.Errorf(
+				"clones of thin volumes share their blocks and can't be sparse")
+			return
+		}
+
+		err = l.CreateSnapshot(cfg, source, opts.FreezeTimeout)
+		if err != nil {
+			return
+		}
+	} else {
+		if opts.Sparse && cfg.ThinPool == "" {
+			err = errors.Errorf(
+				"sparse clones must be created in a thin pool")
+			return
+		}
+
+		mountpoints, err = l.volumeMountpoints([]*LogicalVolume{source})
+		if err != nil {
+			return
+		}
+
+		if len(mountpoints) > 0 {
+			err = errors.Errorf(
+				"volume %s is mounted at %s and must be unmounted to be copied",
+				source.LvName, mountpoints[0])
+			return
+		}
+
+		err = l.CreateLv(cfg)
+		if err != nil {
+			return
+		}
+	}
+
+	clone, err = l.GetLogicalVolume(cfg.VolumeGroup + "/" + cfg.Name)
+	if err == nil && (clone == nil || clone.LvDmPath == "") {
+		err = errors.Errorf(
+			"can't find the device of the clone %s", cfg.Name)
+	}
+
+	if err == nil && !cfg.ThinSnapshot {
+		l.logger.Debug().
+			Str("source", source.LvDmPath).
+			Str("clone", clone.LvDmPath).
+			Bool("sparse", opts.Sparse).
+			Msg("copying volume")
+
+		err = copyDevice(clone.LvDmPath, source.LvDmPath,
+			int64(source.LvSize), opts.Sparse, opts.Progress)
+	}
+
+	if err == nil && sig != nil && sig.Type == "crypto_LUKS" {
+		err = l.regenerateLuksUuid(clone.LvDmPath)
+	}
+
+	if err != nil {
+		rmErr := l.RemoveLv(LvRemovalConfig{
+			LvName: cfg.Name,
+			VgName: cfg.VolumeGroup,
+		})
+		if rmErr != nil {
+			l.logger.Error().
+				Err(rmErr).
+				Str("clone", cfg.Name).
+				Msg("couldn't remove incomplete clone")
+		}
+
+		err = errors.Wrapf(err,
+			"failed to clone volume %s", source.LvName)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,193 @@
+package lib
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCloneConfig(t *testing.T) {
+	var (
+		thin = &LogicalVolume{
+			LvName: "golden",
+			VgName: "vg",
+			PoolLv: "tp",
+			LvSize: 1 << 30,
+		}
+		thick = &LogicalVolume{
+			LvName: "golden",
+			VgName: "vg",
+			LvSize: 1 << 30,
+		}
+	)
+
+	var testCases = []struct {
+		desc        string
+		cfg         LvCreationConfig
+		source      *LogicalVolume
+		expected    LvCreationConfig
+		shouldError bool
+	}{
+		{
+			desc:   "thin sources get thin snapshots",
+			cfg:    LvCreationConfig{Name: "new", Tags: []string{"golvm/fstype=xfs"}},
+			source: thin,
+			expected: LvCreationConfig{
+				Name:         "new",
+				VolumeGroup:  "vg",
+				Snapshot:     "golden",
+				ThinSnapshot: true,
+				Tags:         []string{"golvm/fstype=xfs", "golvm/clone-of=vg/golden"},
+			},
+		},
+		{
+			desc:        "thin sources don't take a size",
+			cfg:         LvCreationConfig{Name: "new", Size: "2G"},
+			source:      thin,
+			shouldError: true,
+		},
+		{
+			desc:        "thin sources are cloned in their pool",
+			cfg:         LvCreationConfig{Name: "new", ThinPool: "other"},
+			source:      thin,
+			shouldError: true,
+		},
+		{
+			desc:        "thin sources are cloned in their vg",
+			cfg:         LvCreationConfig{Name: "new", VolumeGroup: "vg2"},
+			source:      thin,
+			shouldError: true,
+		},
+		{
+			desc:   "thick sources get the size of the source by default",
+			cfg:    LvCreationConfig{Name: "new"},
+			source: thick,
+			expected: LvCreationConfig{
+				Name: "new",
+				Size: "1073741824b",
+				Tags: []string{"golvm/clone-of=vg/golden"},
+			},
+		},
+		{
+			desc:   "thick sources can be copied into bigger volumes of other vgs",
+			cfg:    LvCreationConfig{Name: "new", Size: "2G", VolumeGroup: "vg2"},
+			source: thick,
+			expected: LvCreationConfig{
+				Name:        "new",
+				Size:        "2G",
+				VolumeGroup: "vg2",
+				Tags:        []string{"golvm/clone-of=vg/golden"},
+			},
+		},
+		{
+			desc:   "thick sources can be copied into thin pools",
+			cfg:    LvCreationConfig{Name: "new", ThinPool: "tp"},
+			source: thick,
+			expected: LvCreationConfig{
+				Name:     "new",
+				Size:     "1073741824b",
+				ThinPool: "tp",
+				Tags:     []string{"golvm/clone-of=vg/golden"},
+			},
+		},
+		{
+			desc:        "thick sources can't be copied into smaller volumes",
+			cfg:         LvCreationConfig{Name: "new", Size: "512M"},
+			source:      thick,
+			shouldError: true,
+		},
+		{
+			desc:        "clones can't have a keyfile",
+			cfg:         LvCreationConfig{Name: "new", KeyFile: "/key"},
+			source:      thick,
+			shouldError: true,
+		},
+		{
+			desc:        "clones can't be snapshots",
+			cfg:         LvCreationConfig{Name: "new", Snapshot: "other"},
+			source:      thick,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cfg, err := BuildCloneConfig(tc.cfg, tc.source)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, cfg)
+		})
+	}
+}
+
+// recordingWriter records the offsets written to.
+type recordingWriter struct {
+	offsets []int64
+}
+
+func (w *recordingWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.offsets = append(w.offsets, off)
+	return len(p), nil
+}
+
+func TestCopyBlocks(t *testing.T) {
+	var (
+		size     = int64(3*cloneChunkSize + 10)
+		data     = make([]byte, size)
+		progress []int64
+	)
+
+	data[cloneChunkSize+1] = 1
+	data[size-1] = 1
+
+	dst := new(recordingWriter)
+	err := CopyBlocks(dst, bytes.NewReader(data), size, false, func(copied, total int64) {
+		assert.Equal(t, size, total)
+		progress = append(progress, copied)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{0, cloneChunkSize, 2 * cloneChunkSize, 3 * cloneChunkSize}, dst.offsets)
+	assert.Equal(t, []int64{cloneChunkSize, 2 * cloneChunkSize, 3 * cloneChunkSize, size}, progress)
+
+	sparse := new(recordingWriter)
+	err = CopyBlocks(sparse, bytes.NewReader(data), size, true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{cloneChunkSize, 3 * cloneChunkSize}, sparse.offsets)
+
+	err = CopyBlocks(new(recordingWriter), bytes.NewReader(data[:10]), size, false, nil)
+	assert.Error(t, err)
+}
+
+func TestIsVolumeCopy_clones(t *testing.T) {
+	var vol = &LogicalVolume{LvTags: StringList{"golvm/clone-of=vg/golden"}}
+
+	source, found := CloneSource(vol)
+	assert.True(t, found)
+	assert.Equal(t, "vg/golden", source)
+	assert.True(t, IsVolumeCopy(vol))
+
+	for _, tag := range vol.LvTags {
+		assert.NoError(t, ValidateTag(tag))
+	}
+}
+
+func TestBuildLuksUuidArgs(t *testing.T) {
+	uuid, err := randomUuid()
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(
+		`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), uuid)
+
+	argv, err := BuildLuksUuidArgs("/dev/dev", uuid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cryptsetup", "luksUUID", "--uuid", uuid, "/dev/dev"}, argv)
+
+	_, err = BuildLuksUuidArgs("", uuid)
+	assert.Error(t, err)
+}
@@ -101,3 +101,105 @@ func DecodeLogicalVolumesResponse(response []byte) (infos []*LogicalVolume, err
 	infos = report.Report[0].Lv
 	return
 }
+
+// DecodeLogicalVolumeSegmentsResponse takes a JSON response from
+// the execution of the 'lvs --segments' command and returns a slice
+// of LogicalVolumeSegment structs.
+func DecodeLogicalVolumeSegmentsResponse(response []byte) (infos []*LogicalVolumeSegment, err error) {
+	if response == nil {
+		err = errors.Errorf("response can't be nil")
+		return
+	}
+
+	if len(response) == 0 {
+		err = errors.Errorf("can't decode empty response")
+		return
+	}
+
+	var report = new(LogicalVolumeSegmentsReport)
+	err = json.Unmarshal(response, report)
+	if err != nil {
+		err = errors.Wrapf(err, "errored decoding lvs segments response")
+		return
+	}
+
+	if len(report.Report) != 1 {
+		err = errors.Errorf(
+			"unexpected number of responses decoded - %s",
+			response)
+		return
+	}
+
+	infos = report.Report[0].Seg
+	if infos == nil {
+		infos = report.Report[0].Lv
+	}
+
+	return
+}
+
+// DecodeFullReportResponse takes a JSON response from the
+// execution of the 'lvm fullreport' command and builds an
+// Inventory out of it.
+// As each volume group gets its own entry in the report, the
+// volume group name is filled in for the objects that don't
+// carry it.
+func DecodeFullReportResponse(response []byte) (inv *Inventory, err error) {
+	if response == nil {
+		err = errors.Errorf("response can't be nil")
+		return
+	}
+
+	if len(response) == 0 {
+		err = errors.Errorf("can't decode empty response")
+		return
+	}
+
+	var report = new(FullReport)
+	err = json.Unmarshal(response, report)
+	if err != nil {
+		err = errors.Wrapf(err, "errored decoding fullreport response")
+		return
+	}
+
+	inv = new(Inventory)
+
+	for _, entry := range report.Report {
+		var vgName string
+
+		if len(entry.Vg) > 1 {
+			err = errors.Errorf(
+				"unexpected number of volume groups in fullreport entry - %d",
+				len(entry.Vg))
+			return
+		}
+
+		if len(entry.Vg) == 1 {
+			vgName = entry.Vg[0].Name
+			inv.VolumeGroups = append(inv.VolumeGroups, entry.Vg[0])
+		}
+
+		for _, pv := range entry.Pv {
+			if pv.VolumeGroup == "" {
+				pv.VolumeGroup = vgName
+			}
+			inv.PhysicalVolumes = append(inv.PhysicalVolumes, pv)
+		}
+
+		for _, lv := range entry.Lv {
+			if lv.VgName == "" {
+				lv.VgName = vgName
+			}
+			inv.AllLogicalVolumes = append(inv.AllLogicalVolumes, lv)
+		}
+
+		for _, seg := range entry.Seg {
+			if seg.VgName == "" {
+				seg.VgName = vgName
+			}
+			inv.Segments = append(inv.Segments, seg)
+		}
+	}
+
+	return
+}
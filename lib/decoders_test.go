@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,9 +18,9 @@ const (
                 {
                     "pv_attr": "a--",
                     "pv_fmt": "lvm2",
-                    "pv_free": "48.00",
+                    "pv_free": "50331648",
                     "pv_name": "/dev/loop0",
-                    "pv_size": "48.00",
+                    "pv_size": "50331648",
                     "vg_name": "myvg"
                 }
             ]
@@ -36,9 +38,10 @@ const (
                     "pv_count": "1",
                     "snap_count": "0",
                     "vg_attr": "wz--n-",
-                    "vg_free": "48.00",
+                    "vg_extent_size": "4194304",
+                    "vg_free": "50331648",
                     "vg_name": "myvg",
-                    "vg_size": "48.00"
+                    "vg_size": "50331648"
                 }
             ]
         }
@@ -55,7 +58,7 @@ const (
                     "data_percent": "",
                     "lv_attr": "-wi-a-----",
                     "lv_name": "lv1",
-                    "lv_size": "12.00",
+                    "lv_size": "12582912",
                     "metadata_percent": "",
                     "mirror_log": "",
                     "move_pv": "",
@@ -67,6 +70,26 @@ const (
             ]
         }
     ]
+}`
+	respLvSegs1 = `
+{
+    "report": [
+        {
+            "seg": [
+                {
+                    "lv_name": "striped",
+                    "vg_name": "myvg",
+                    "segtype": "striped",
+                    "seg_start_pe": "0",
+                    "seg_size_pe": "6",
+                    "stripes": "2",
+                    "stripe_size": "65536",
+                    "seg_pe_ranges": "/dev/loop0:0-2 /dev/loop1:0-2",
+                    "devices": "/dev/loop0(0),/dev/loop1(0)"
+                }
+            ]
+        }
+    ]
 }`
 )
 
@@ -95,9 +118,9 @@ func TestParsePhysycalVolumesOutput(t *testing.T) {
 				&PhysicalVolume{
 					Attr:             "a--",
 					Fmt:              "lvm2",
-					PhysicalSize:     48,
+					PhysicalSize:     50331648,
 					PhysicalVolume:   "/dev/loop0",
-					PhysicalSizeFree: 48,
+					PhysicalSizeFree: 50331648,
 					VolumeGroup:      "myvg",
 				},
 			},
@@ -171,8 +194,8 @@ func TestParseVolumeGroupsOutput(t *testing.T) {
 				&VolumeGroup{
 					Attr:      "wz--n-",
 					Name:      "myvg",
-					Free:      48,
-					Size:      48,
+					Free:      50331648,
+					Size:      50331648,
 					LvCount:   0,
 					PvCount:   1,
 					SnapCount: 0,
@@ -253,7 +276,7 @@ func TestParseLogicalVolumesOutput(t *testing.T) {
 			expected: []*LogicalVolume{
 				&LogicalVolume{
 					LvName:   "lv1",
-					LvSize:   12.0,
+					LvSize:   12582912,
 					LvAttr:   "-wi-a-----",
 					LvDmPath: "/dev/mapper/volgroup0-tvol2",
 				},
@@ -296,3 +319,107 @@ func TestParseLogicalVolumesOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLogicalVolumeSegmentsOutput(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       []byte
+		expected    []*LogicalVolumeSegment
+		shouldError bool
+	}{
+		{
+			desc:        "nil input should fail",
+			input:       nil,
+			shouldError: true,
+		},
+		{
+			desc:        "empty input should fail",
+			input:       []byte(""),
+			shouldError: true,
+		},
+		{
+			desc:  "valid response should return valid",
+			input: []byte(respLvSegs1),
+			expected: []*LogicalVolumeSegment{
+				&LogicalVolumeSegment{
+					LvName:      "striped",
+					VgName:      "myvg",
+					SegType:     "striped",
+					SegStartPe:  0,
+					SegSizePe:   6,
+					Stripes:     2,
+					StripeSize:  65536,
+					SegPeRanges: "/dev/loop0:0-2 /dev/loop1:0-2",
+					Devices:     "/dev/loop0(0),/dev/loop1(0)",
+				},
+			},
+			shouldError: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			infos, err := DecodeLogicalVolumeSegmentsResponse(tc.input)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, infos)
+		})
+	}
+}
+
+// TestDecodeFixturesFromLvmVersions makes sure that the
+// reports produced by different lvm2 versions (and report
+// formats) decode to the same values. The fixtures live under
+// 'testdata/<lvm2 version>'.
+func TestDecodeFixturesFromLvmVersions(t *testing.T) {
+	var versions = []string{
+		"2.02.176",
+		"2.03.11",
+		"2.03.21",
+	}
+
+	for _, version := range versions {
+		t.Run(version, func(t *testing.T) {
+			var dir = filepath.Join("testdata", version)
+
+			pvsOutput, err := ioutil.ReadFile(filepath.Join(dir, "pvs.json"))
+			require.NoError(t, err)
+
+			pvs, err := DecodePhysicalVolumesResponse(pvsOutput)
+			require.NoError(t, err)
+			require.Len(t, pvs, 2)
+			assert.Equal(t, "/dev/loop0", pvs[0].PhysicalVolume)
+			assert.Equal(t, ByteSize(50331648), pvs[0].PhysicalSize)
+			assert.Equal(t, ByteSize(37748736), pvs[0].PhysicalSizeFree)
+
+			vgsOutput, err := ioutil.ReadFile(filepath.Join(dir, "vgs.json"))
+			require.NoError(t, err)
+
+			vgs, err := DecodeVolumeGroupsResponse(vgsOutput)
+			require.NoError(t, err)
+			require.Len(t, vgs, 1)
+			assert.Equal(t, "myvg", vgs[0].Name)
+			assert.Equal(t, Count(2), vgs[0].PvCount)
+			assert.Equal(t, Count(2), vgs[0].LvCount)
+			assert.Equal(t, ByteSize(88080384), vgs[0].Free)
+			assert.Equal(t, ByteSize(4194304), vgs[0].ExtentSize)
+
+			lvsOutput, err := ioutil.ReadFile(filepath.Join(dir, "lvs.json"))
+			require.NoError(t, err)
+
+			lvs, err := DecodeLogicalVolumesResponse(lvsOutput)
+			require.NoError(t, err)
+			require.Len(t, lvs, 2)
+			assert.Equal(t, "lv1", lvs[0].LvName)
+			assert.Equal(t, ByteSize(8388608), lvs[0].LvSize)
+			assert.Equal(t, Percent(0), lvs[0].DataPercent)
+			assert.Equal(t, "pool", lvs[1].LvName)
+			assert.Equal(t, Percent(12.5), lvs[1].DataPercent)
+			assert.Equal(t, Percent(10.84), lvs[1].MetadataPercent)
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ExportConfig tunes the export of a volume.
+type ExportConfig struct {
+	Kind     ArchiveKind
+	Compress bool
+
+	// SnapshotSize is the size of the temporary snapshot
+	// that thick volumes are exported from when they're
+	// mounted or exported as files. Defaults to the size
+	// of the volume.
+	SnapshotSize string
+
+	// FreezeTimeout is how long the filesystem of a mounted
+	// volume can stay frozen while the temporary snapshot is
+	// taken. Zero disables freezing.
+	FreezeTimeout time.Duration
+}
+
+// exportMountOptions are the options that temporary
+// snapshots are mounted with to be exported.
+func exportMountOptions(fsType string) (opts MountOptions, err error) {
+	opts, err = MountOptions{Flags: []string{"ro"}}.WithFsType(fsType)
+	if err != nil {
+		return
+	}
+
+	if fsType == "xfs" {
+		opts = opts.WithNouuid()
+	}
+
+	return
+}
+
+// createTemporarySnapshot takes a snapshot of 'vol' to export
+// it from.
+func (l Lvm) createTemporarySnapshot(vol *LogicalVolume, cfg ExportConfig) (snapshot *LogicalVolume, err error) {
+	var lvCfg = LvCreationConfig{
+		Name:         fmt.Sprintf("%s_export%d", vol.LvName, time.Now().Unix()),
+		VolumeGroup:  vol.VgName,
+		Snapshot:     vol.LvName,
+		ThinSnapshot: vol.PoolLv != "",
+	}
+
+	if !lvCfg.ThinSnapshot {
+		lvCfg.Size = cfg.SnapshotSize
+		if lvCfg.Size == "" {
+			lvCfg.Size = fmt.Sprintf("%db", uint64(vol.LvSize))
+		}
+	}
+
+	err = l.CreateSnapshot(lvCfg, vol, cfg.FreezeTimeout)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't take temporary snapshot of %s", vol.LvName)
+		return
+	}
+
+	snapshot, err = l.GetLogicalVolume(vol.VgName + "/" + lvCfg.Name)
+	if err == nil && (snapshot == nil || snapshot.LvDmPath == "") {
+		err = errors.Errorf(
+			"can't find the device of temporary snapshot %s", lvCfg.Name)
+	}
+
+	if err != nil {
+		l.removeTemporaryVolume(vol.VgName, lvCfg.Name)
+		snapshot = nil
+	}
+
+	return
+}
+
+// removeTemporaryVolume removes a volume that only existed
+// while exporting or importing, logging failures.
+func (l Lvm) removeTemporaryVolume(vgName, lvName string) {
+	err := l.RemoveLv(LvRemovalConfig{
+		LvName: lvName,
+		VgName: vgName,
+	})
+	if err != nil {
+		l.logger.Error().
+			Err(err).
+			Str("volume", vgName+"/"+lvName).
+			Msg("couldn't remove temporary volume")
+	}
+}
+
+// withMountedDevice mounts 'device' at a temporary directory
+// while 'fn' runs.
+func (l Lvm) withMountedDevice(device string, opts MountOptions, fn func(dir string) error) (err error) {
+	var dir string
+
+	dir, err = ioutil.TempDir("", "golvm-")
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't create temporary mountpoint")
+		return
+	}
+	defer os.Remove(dir)
+
+	err = l.Mount(device, dir, opts)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		unmountErr := l.Unmount(dir, UnmountNormal)
+		if err == nil {
+			err = unmountErr
+		}
+	}()
+
+	err = fn(dir)
+	return
+}
+
+// ExportVolume streams an archive of 'vol' to 'w'.
+// Raw archives hold the blocks of the volume, which are read
+// from a temporary snapshot if the volume is mounted, while fs
+// archives hold the files of its filesystem, which are always
+// read from a temporary snapshot.
+func (l Lvm) ExportVolume(vol *LogicalVolume, w io.Writer, cfg ExportConfig) (err error) {
+	var (
+		opts        MountOptions
+		sig         *FsSignature
+		tags        []string
+		mountpoints []string
+		source      = vol
+		aw          *ArchiveWriter
+		device      *os.File
+	)
+
+	if vol.LvDmPath == "" {
+		err = errors.Errorf(
+			"can't find the device of volume %s - is it active?",
+			vol.LvName)
+		return
+	}
+
+	opts, err = VolumeMountOptions(vol)
+	if err != nil {
+		return
+	}
+
+	sig, err = ProbeDevice(vol.LvDmPath)
+	if err != nil {
+		return
+	}
+
+	if cfg.Kind == ArchiveFs && sig == nil {
+		err = errors.Errorf(
+			"volume %s has no filesystem to export files from",
+			vol.LvName)
+		return
+	}
+
+	tags = ArchiveTags(vol)
+	if sig != nil && (cfg.Kind == ArchiveFs || sig.IsFilesystem()) {
+		opts, err = ProbedMountOptions(vol, opts, sig)
+		if err != nil {
+			return
+		}
+
+		// volumes not created by golvm get the filesystem
+		// they hold recorded.
+		if _, tagged := VolumeFsType(vol); !tagged {
+			tags = append(tags, FsTypeTagPrefix+opts.FsType)
+		}
+	}
+
+	mountpoints, err = l.volumeMountpoints([]*LogicalVolume{vol})
+	if err != nil {
+		return
+	}
+
+	if cfg.Kind == ArchiveFs || len(mountpoints) > 0 {
+		source, err = l.createTemporarySnapshot(vol, cfg)
+		if err != nil {
+			return
+		}
+		defer l.removeTemporaryVolume(source.VgName, source.LvName)
+	}
+
+	aw, err = NewArchiveWriter(w, ArchiveManifest{
+		Kind:   cfg.Kind,
+		Name:   vol.LvName,
+		Size:   vol.LvSize,
+		FsType: opts.FsType,
+		Tags:   tags,
+	}, cfg.Compress)
+	if err != nil {
+		return
+	}
+
+	switch cfg.Kind {
+	case ArchiveRaw:
+		device, err = os.Open(source.LvDmPath)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't open device %s", source.LvDmPath)
+			return
+		}
+		defer device.Close()
+
+		err = aw.WriteRawImage(device, int64(vol.LvSize))
+	case ArchiveFs:
+		opts, err = exportMountOptions(opts.FsType)
+		if err != nil {
+			return
+		}
+
+		err = l.withMountedDevice(source.LvDmPath, opts, aw.WriteFilesystemTree)
+	default:
+		err = errors.Errorf("unknown archive kind %s", cfg.Kind)
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err, "failed to export volume %s", vol.LvName)
+		return
+	}
+
+	err = aw.Close()
+	return
+}
+
+// BuildImportConfig adapts the configuration of a volume to be
+// created out of the archive described by 'manifest': it gets
+// the settings of the archived volume and, if not specified,
+// its size.
+func BuildImportConfig(cfg LvCreationConfig, manifest ArchiveManifest) (imported LvCreationConfig, err error) {
+	var size ByteSize
+
+	imported = cfg
+
+	if cfg.Snapshot != "" || cfg.KeyFile != "" {
+		err = errors.Errorf(
+			"imported volumes can't be snapshots nor be encrypted")
+		return
+	}
+
+	// only the settings that archives carry are kept.
+	imported.Tags = append(append([]string{}, cfg.Tags...),
+		ArchiveTags(&LogicalVolume{LvTags: manifest.Tags})...)
+	imported.FsType = manifest.FsType
+
+	if cfg.Size == "" {
+		imported.Size = fmt.Sprintf("%db", uint64(manifest.Size))
+		return
+	}
+
+	size, err = ParseByteSize(cfg.Size)
+	if err != nil {
+		err = errors.Wrapf(err, "invalid size %s", cfg.Size)
+		return
+	}
+
+	if size < manifest.Size {
+		err = errors.Errorf(
+			"the imported volume must be at least as big as %s (%s)",
+			manifest.Name, manifest.Size)
+		return
+	}
+
+	return
+}
+
+// ImportVolume creates a volume as described by 'cfg' (see
+// BuildImportConfig) and fills it with the contents of the
+// archive. If the archive turns out to be corrupt, the volume
+// is removed.
+func (l Lvm) ImportVolume(ar *ArchiveReader, cfg LvCreationConfig) (err error) {
+	var (
+		vol        *LogicalVolume
+		device     *os.File
+		opts       MountOptions
+		formatOpts FormatOptions
+	)
+
+	err = l.CreateLv(cfg)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			l.removeTemporaryVolume(cfg.VolumeGroup, cfg.Name)
+			err = errors.Wrapf(err,
+				"failed to import %s", ar.Manifest.Name)
+		}
+	}()
+
+	vol, err = l.GetLogicalVolume(cfg.VolumeGroup + "/" + cfg.Name)
+	if err == nil && (vol == nil || vol.LvDmPath == "") {
+		err = errors.Errorf(
+			"can't find the device of the imported volume %s", cfg.Name)
+	}
+
+	if err != nil {
+		return
+	}
+
+	switch ar.Manifest.Kind {
+	case ArchiveRaw:
+		device, err = os.OpenFile(vol.LvDmPath, os.O_WRONLY, 0)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't open device %s", vol.LvDmPath)
+			return
+		}
+		defer device.Close()
+
+		// only thin volumes read as zeros where nothing
+		// was written.
+		err = ar.ReadRawImage(device, cfg.ThinPool == "")
+		if err != nil {
+			return
+		}
+
+		err = device.Sync()
+	case ArchiveFs:
+		opts, err = VolumeMountOptions(vol)
+		if err != nil {
+			return
+		}
+
+		formatOpts, err = VolumeFormatOptions(vol)
+		if err != nil {
+			return
+		}
+
+		err = l.FormatDevice(vol.LvDmPath, opts.FsType, formatOpts)
+		if err != nil {
+			return
+		}
+
+		err = l.withMountedDevice(vol.LvDmPath, opts, ar.ReadFilesystemTree)
+	default:
+		err = errors.Errorf("unknown archive kind %s", ar.Manifest.Kind)
+	}
+
+	return
+}
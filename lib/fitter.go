@@ -7,15 +7,26 @@ import (
 // PickBestVolumeGroup picks the volume group that best
 // accomodates space of a given size.
 // 'size' specifies the size to be accomodated - if 0, any
-// volume with free space fits it.
-func PickBestVolumeGroup(size float64, vols []*VolumeGroup) (bestVol *VolumeGroup, err error) {
+// volume with free space fits it. The size is rounded up to
+// the extent size of each volume group before comparing.
+// Volume groups that are partial, exported or read-only (or
+// whose attributes can't be parsed) are never picked.
+func PickBestVolumeGroup(size ByteSize, vols []*VolumeGroup) (bestVol *VolumeGroup, err error) {
+	var problems []string
+
 	if vols == nil {
 		err = errors.Errorf("can't pick best volume from nil list of vols")
 		return
 	}
 
 	for _, vol := range vols {
-		if vol.Free > size {
+		problems, err = VolumeGroupProblems(vol)
+		if err != nil || len(problems) > 0 {
+			err = nil
+			continue
+		}
+
+		if vol.Free > 0 && vol.Free >= size.RoundUpToExtent(vol.ExtentSize) {
 			if bestVol == nil {
 				bestVol = vol
 				continue
@@ -10,7 +10,7 @@ import (
 func TestPickBestVolumeGroup(t *testing.T) {
 	var testCases = []struct {
 		desc        string
-		size        float64
+		size        ByteSize
 		vols        []*VolumeGroup
 		expected    *VolumeGroup
 		shouldError bool
@@ -83,6 +83,56 @@ func TestPickBestVolumeGroup(t *testing.T) {
 			},
 			shouldError: false,
 		},
+		{
+			desc: "should round the size up to the extent size",
+			size: 15,
+			vols: []*VolumeGroup{
+				&VolumeGroup{
+					Name:       "vg1",
+					Size:       60,
+					Free:       15,
+					ExtentSize: 4,
+				},
+				&VolumeGroup{
+					Name:       "vg2",
+					Size:       60,
+					Free:       16,
+					ExtentSize: 4,
+				},
+			},
+			expected: &VolumeGroup{
+				Name: "vg2",
+			},
+			shouldError: false,
+		},
+		{
+			desc: "should skip partial and exported vgs",
+			size: 0,
+			vols: []*VolumeGroup{
+				&VolumeGroup{
+					Name: "vg1",
+					Attr: "wz--n-",
+					Size: 60,
+					Free: 10,
+				},
+				&VolumeGroup{
+					Name: "vg2",
+					Attr: "wz-pn-",
+					Size: 60,
+					Free: 50,
+				},
+				&VolumeGroup{
+					Name: "vg3",
+					Attr: "wzx-n-",
+					Size: 60,
+					Free: 40,
+				},
+			},
+			expected: &VolumeGroup{
+				Name: "vg1",
+			},
+			shouldError: false,
+		},
 	}
 
 	var (
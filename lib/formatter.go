@@ -0,0 +1,357 @@
+package lib
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FsTypeNone leaves volumes raw, without a filesystem.
+	FsTypeNone = "none"
+
+	// MkfsOptionPrefix prefixes the formatting options in
+	// the options of a docker volume (e.g., 'mkfs.label').
+	MkfsOptionPrefix = "mkfs."
+
+	// MkfsTagPrefix prefixes the tags that record each of
+	// the formatting options of a volume.
+	MkfsTagPrefix = "golvm/mkfs."
+)
+
+// FormatOptions are the tuning options of a formatter keyed
+// by their names:
+//	-	label:		label of the filesystem
+//	-	inode-ratio:	bytes per inode
+//	-	reserved:	percentage of blocks reserved
+//				for the super-user
+//	-	lazy-init:	whether to lazily initialize the
+//				inode tables and the journal
+//	-	block-size:	size of the blocks in bytes
+// Each formatter supports a subset of them.
+type FormatOptions map[string]string
+
+// Formatter creates a filesystem on a device.
+type Formatter interface {
+	// Name is the type of filesystem created, as used
+	// by mount(2).
+	Name() string
+
+	// Validate checks whether the options are supported
+	// and have valid values.
+	Validate(opts FormatOptions) error
+
+	// Args builds the command line (argv) that formats
+	// 'device'. An empty command line means that there's
+	// nothing to run.
+	Args(device string, opts FormatOptions) ([]string, error)
+}
+
+var (
+	// formatters holds the registered formatters by name.
+	// Registration is meant to happen at initialization
+	// time, thus there's no locking.
+	formatters = map[string]Formatter{}
+
+	validLabel = regexp.MustCompile(`^[A-Za-z0-9_+.\-]+$`)
+)
+
+// RegisterFormatter makes a formatter available under its
+// name, replacing any formatter previously registered with
+// the same name.
+func RegisterFormatter(f Formatter) {
+	formatters[f.Name()] = f
+}
+
+// GetFormatter retrieves the formatter of a filesystem type.
+func GetFormatter(fsType string) (f Formatter, err error) {
+	var found bool
+
+	f, found = formatters[fsType]
+	if !found {
+		err = errors.Errorf(
+			"unsupported fs type %s - must be one of %s",
+			fsType, strings.Join(FormatterNames(), ", "))
+		return
+	}
+
+	return
+}
+
+// FormatterNames lists the names of the registered
+// formatters in alphabetical order.
+func FormatterNames() (names []string) {
+	names = make([]string, 0, len(formatters))
+
+	for name := range formatters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return
+}
+
+// FormatOptionsFromMap gathers the formatting options out of
+// a map of options whose keys start with 'prefix' (e.g.,
+// 'mkfs.label=data' with 'mkfs.' as the prefix).
+func FormatOptionsFromMap(opts map[string]string, prefix string) (formatOpts FormatOptions) {
+	formatOpts = FormatOptions{}
+
+	for key, value := range opts {
+		if strings.HasPrefix(key, prefix) {
+			formatOpts[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+
+	return
+}
+
+// ParseFormatOptions parses a list of 'key=value' options.
+func ParseFormatOptions(opts []string) (formatOpts FormatOptions, err error) {
+	formatOpts = FormatOptions{}
+
+	for _, opt := range opts {
+		var parts = strings.SplitN(opt, "=", 2)
+
+		if len(parts) != 2 || parts[0] == "" {
+			err = errors.Errorf(
+				"malformed format option '%s' - must be 'key=value'", opt)
+			return
+		}
+
+		formatOpts[parts[0]] = parts[1]
+	}
+
+	return
+}
+
+// keys lists the names of the options in alphabetical order
+// so that command lines and tags are deterministic.
+func (o FormatOptions) keys() (keys []string) {
+	for key := range o {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return
+}
+
+// Tags gives the tags that persist the formatting options
+// with a volume such that it can be formatted later on (on
+// its first mount).
+func (o FormatOptions) Tags() (tags []string) {
+	for _, key := range o.keys() {
+		tags = append(tags, MkfsTagPrefix+key+"="+o[key])
+	}
+
+	return
+}
+
+// VolumeFormatOptions retrieves the formatting options
+// persisted in the tags of a volume.
+func VolumeFormatOptions(vol *LogicalVolume) (opts FormatOptions, err error) {
+	var tags = []string{}
+
+	for _, tag := range vol.LvTags {
+		if strings.HasPrefix(tag, MkfsTagPrefix) {
+			tags = append(tags, strings.TrimPrefix(tag, MkfsTagPrefix))
+		}
+	}
+
+	opts, err = ParseFormatOptions(tags)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"invalid format options in tags of volume %s",
+			vol.LvName)
+		return
+	}
+
+	return
+}
+
+// mkfsOption describes how a formatting option is validated
+// and turned into arguments of a mkfs command.
+type mkfsOption struct {
+	validate func(value string) error
+	args     func(value string) []string
+}
+
+// mkfsFormatter formats devices with one of the mkfs.<fs>
+// commands.
+type mkfsFormatter struct {
+	name    string
+	command string
+	options map[string]mkfsOption
+}
+
+func (f mkfsFormatter) Name() string {
+	return f.name
+}
+
+func (f mkfsFormatter) Validate(opts FormatOptions) (err error) {
+	for _, key := range opts.keys() {
+		option, found := f.options[key]
+		if !found {
+			err = errors.Errorf(
+				"format option %s is not supported by %s",
+				key, f.name)
+			return
+		}
+
+		err = option.validate(opts[key])
+		if err != nil {
+			err = errors.Wrapf(err,
+				"invalid value for format option %s", key)
+			return
+		}
+	}
+
+	return
+}
+
+func (f mkfsFormatter) Args(device string, opts FormatOptions) (argv []string, err error) {
+	if device == "" {
+		err = errors.Errorf("a device must be specified")
+		return
+	}
+
+	err = f.Validate(opts)
+	if err != nil {
+		return
+	}
+
+	if f.command == "" {
+		return
+	}
+
+	argv = []string{f.command}
+	for _, key := range opts.keys() {
+		argv = append(argv, f.options[key].args(opts[key])...)
+	}
+
+	argv = append(argv, device)
+	return
+}
+
+// flagArgs builds the arguments of an option that maps to a
+// flag taking the value as is.
+func flagArgs(flag string) func(string) []string {
+	return func(value string) []string {
+		return []string{flag, value}
+	}
+}
+
+// labelValidator accepts labels of up to 'max' characters.
+// Characters are restricted to the ones that can be stored
+// in the tags of a volume.
+func labelValidator(max int) func(string) error {
+	return func(value string) (err error) {
+		if len(value) > max || !validLabel.MatchString(value) {
+			err = errors.Errorf(
+				"'%s' must have up to %d letters, numbers or '_+.-'",
+				value, max)
+		}
+
+		return
+	}
+}
+
+// uintValidator accepts integers within [min, max]. If
+// 'powerOfTwo' is set, only powers of two are accepted.
+func uintValidator(min, max uint64, powerOfTwo bool) func(string) error {
+	return func(value string) (err error) {
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || n < min || n > max {
+			err = errors.Errorf(
+				"'%s' must be a number between %d and %d",
+				value, min, max)
+			return
+		}
+
+		if powerOfTwo && n&(n-1) != 0 {
+			err = errors.Errorf(
+				"'%s' must be a power of two", value)
+			return
+		}
+
+		return
+	}
+}
+
+// percentValidator accepts percentages within [0, max].
+func percentValidator(max float64) func(string) error {
+	return func(value string) (err error) {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || n < 0 || n > max {
+			err = errors.Errorf(
+				"'%s' must be a percentage between 0 and %g",
+				value, max)
+			return
+		}
+
+		return
+	}
+}
+
+// boolValidator accepts 'true' and 'false'.
+func boolValidator(value string) (err error) {
+	if value != "true" && value != "false" {
+		err = errors.Errorf("'%s' must be true or false", value)
+	}
+
+	return
+}
+
+// ext4LazyInitArgs toggles the lazy initialization of both
+// the inode tables and the journal.
+func ext4LazyInitArgs(value string) []string {
+	var flag = "0"
+	if value == "true" {
+		flag = "1"
+	}
+
+	return []string{"-E",
+		"lazy_itable_init=" + flag + ",lazy_journal_init=" + flag}
+}
+
+func init() {
+	RegisterFormatter(mkfsFormatter{
+		name:    "ext4",
+		command: "mkfs.ext4",
+		options: map[string]mkfsOption{
+			"label":       {labelValidator(16), flagArgs("-L")},
+			"inode-ratio": {uintValidator(1024, 67108864, false), flagArgs("-i")},
+			"reserved":    {percentValidator(50), flagArgs("-m")},
+			"lazy-init":   {boolValidator, ext4LazyInitArgs},
+			"block-size":  {uintValidator(1024, 65536, true), flagArgs("-b")},
+		},
+	})
+
+	RegisterFormatter(mkfsFormatter{
+		name:    "xfs",
+		command: "mkfs.xfs",
+		options: map[string]mkfsOption{
+			"label": {labelValidator(12), flagArgs("-L")},
+			"block-size": {uintValidator(512, 65536, true), func(value string) []string {
+				return []string{"-b", "size=" + value}
+			}},
+		},
+	})
+
+	RegisterFormatter(mkfsFormatter{
+		name:    "btrfs",
+		command: "mkfs.btrfs",
+		options: map[string]mkfsOption{
+			"label":      {labelValidator(255), flagArgs("--label")},
+			"block-size": {uintValidator(4096, 65536, true), flagArgs("--sectorsize")},
+		},
+	})
+
+	RegisterFormatter(mkfsFormatter{
+		name:    FsTypeNone,
+		options: map[string]mkfsOption{},
+	})
+}
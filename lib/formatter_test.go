@@ -0,0 +1,209 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatter_Args(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		fsType      string
+		device      string
+		opts        FormatOptions
+		expected    []string
+		shouldError bool
+	}{
+		{
+			desc:        "fail with unknown fstype",
+			fsType:      "ext3",
+			device:      "/dev/device",
+			shouldError: true,
+		},
+		{
+			desc:        "fail with empty device",
+			fsType:      "ext4",
+			device:      "",
+			shouldError: true,
+		},
+		{
+			desc:     "ext4 without options",
+			fsType:   "ext4",
+			device:   "/dev/device",
+			expected: []string{"mkfs.ext4", "/dev/device"},
+		},
+		{
+			desc:   "ext4 with all the options",
+			fsType: "ext4",
+			device: "/dev/device",
+			opts: FormatOptions{
+				"label":       "data",
+				"inode-ratio": "65536",
+				"reserved":    "0.5",
+				"lazy-init":   "false",
+				"block-size":  "4096",
+			},
+			expected: []string{
+				"mkfs.ext4",
+				"-b", "4096",
+				"-i", "65536",
+				"-L", "data",
+				"-E", "lazy_itable_init=0,lazy_journal_init=0",
+				"-m", "0.5",
+				"/dev/device",
+			},
+		},
+		{
+			desc:        "ext4 with too long label",
+			fsType:      "ext4",
+			device:      "/dev/device",
+			opts:        FormatOptions{"label": "a-label-longer-than-16"},
+			shouldError: true,
+		},
+		{
+			desc:        "ext4 with label with spaces",
+			fsType:      "ext4",
+			device:      "/dev/device",
+			opts:        FormatOptions{"label": "my data"},
+			shouldError: true,
+		},
+		{
+			desc:        "ext4 with block size not a power of two",
+			fsType:      "ext4",
+			device:      "/dev/device",
+			opts:        FormatOptions{"block-size": "3000"},
+			shouldError: true,
+		},
+		{
+			desc:        "ext4 with too many reserved blocks",
+			fsType:      "ext4",
+			device:      "/dev/device",
+			opts:        FormatOptions{"reserved": "60"},
+			shouldError: true,
+		},
+		{
+			desc:        "ext4 with non-boolean lazy init",
+			fsType:      "ext4",
+			device:      "/dev/device",
+			opts:        FormatOptions{"lazy-init": "yes"},
+			shouldError: true,
+		},
+		{
+			desc:   "xfs with label and block size",
+			fsType: "xfs",
+			device: "/dev/device",
+			opts: FormatOptions{
+				"label":      "data",
+				"block-size": "4096",
+			},
+			expected: []string{
+				"mkfs.xfs",
+				"-b", "size=4096",
+				"-L", "data",
+				"/dev/device",
+			},
+		},
+		{
+			desc:        "xfs doesn't support inode ratio",
+			fsType:      "xfs",
+			device:      "/dev/device",
+			opts:        FormatOptions{"inode-ratio": "65536"},
+			shouldError: true,
+		},
+		{
+			desc:   "btrfs with label",
+			fsType: "btrfs",
+			device: "/dev/device",
+			opts:   FormatOptions{"label": "data"},
+			expected: []string{
+				"mkfs.btrfs",
+				"--label", "data",
+				"/dev/device",
+			},
+		},
+		{
+			desc:     "none has nothing to run",
+			fsType:   "none",
+			device:   "/dev/device",
+			expected: nil,
+		},
+		{
+			desc:        "none takes no options",
+			fsType:      "none",
+			device:      "/dev/device",
+			opts:        FormatOptions{"label": "data"},
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			formatter, err := GetFormatter(tc.fsType)
+			if err == nil {
+				var argv []string
+
+				argv, err = formatter.Args(tc.device, tc.opts)
+				if !tc.shouldError {
+					require.NoError(t, err)
+					assert.Equal(t, tc.expected, argv)
+					return
+				}
+			}
+
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestFormatterNames(t *testing.T) {
+	assert.Equal(t,
+		[]string{"btrfs", "ext4", "none", "xfs"},
+		FormatterNames())
+}
+
+func TestFormatOptions_tags(t *testing.T) {
+	var opts = FormatOptionsFromMap(map[string]string{
+		"size":             "10G",
+		"mkfs.label":       "data",
+		"mkfs.inode-ratio": "65536",
+	}, MkfsOptionPrefix)
+
+	assert.Equal(t, FormatOptions{
+		"label":       "data",
+		"inode-ratio": "65536",
+	}, opts)
+
+	tags := opts.Tags()
+	assert.Equal(t, []string{
+		"golvm/mkfs.inode-ratio=65536",
+		"golvm/mkfs.label=data",
+	}, tags)
+
+	for _, tag := range tags {
+		assert.NoError(t, ValidateTag(tag))
+	}
+
+	persisted, err := VolumeFormatOptions(&LogicalVolume{
+		LvName: "vol",
+		LvTags: append(StringList{"golvm/fstype=ext4"}, tags...),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, opts, persisted)
+}
+
+func TestParseFormatOptions(t *testing.T) {
+	opts, err := ParseFormatOptions([]string{"label=data", "block-size=4096"})
+	require.NoError(t, err)
+	assert.Equal(t, FormatOptions{
+		"label":      "data",
+		"block-size": "4096",
+	}, opts)
+
+	_, err = ParseFormatOptions([]string{"label"})
+	assert.Error(t, err)
+
+	_, err = ParseFormatOptions([]string{"=data"})
+	assert.Error(t, err)
+}
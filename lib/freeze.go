@@ -0,0 +1,309 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// FIFREEZE and FITHAW are the ioctls that freeze and
+	// thaw a filesystem (_IOWR('X', 119, int) and
+	// _IOWR('X', 120, int) on most architectures).
+	FIFREEZE = 0xC0045877
+	FITHAW   = 0xC0045878
+
+	// DefaultFreezeTimeout is how long filesystems are kept
+	// frozen at most while snapshots are taken.
+	DefaultFreezeTimeout = 10 * time.Second
+)
+
+// filesystemIoctl issues one of the freezing ioctls on the
+// filesystem mounted at 'mountpoint'.
+func filesystemIoctl(mountpoint string, req uint) (err error) {
+	var dir *os.File
+
+	dir, err = os.Open(mountpoint)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't open mountpoint %s", mountpoint)
+		return
+	}
+	defer dir.Close()
+
+	err = unix.IoctlSetInt(int(dir.Fd()), req, 0)
+	return
+}
+
+// FreezeFilesystem flushes the filesystem mounted at
+// 'mountpoint' and blocks any writes to it until it's thawed.
+func FreezeFilesystem(mountpoint string) (err error) {
+	err = filesystemIoctl(mountpoint, FIFREEZE)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't freeze filesystem at %s", mountpoint)
+		return
+	}
+
+	return
+}
+
+// ThawFilesystem unblocks the writes to the filesystem
+// mounted at 'mountpoint'.
+func ThawFilesystem(mountpoint string) (err error) {
+	err = filesystemIoctl(mountpoint, FITHAW)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't thaw filesystem at %s", mountpoint)
+		return
+	}
+
+	return
+}
+
+// Freezer freezes and thaws filesystems. It exists so that
+// the freezing logic can be exercised without privileges.
+type Freezer interface {
+	Freeze(mountpoint string) error
+	Thaw(mountpoint string) error
+}
+
+// IoctlFreezer freezes filesystems with the FIFREEZE and
+// FITHAW ioctls.
+type IoctlFreezer struct{}
+
+func (f IoctlFreezer) Freeze(mountpoint string) error {
+	return FreezeFilesystem(mountpoint)
+}
+
+func (f IoctlFreezer) Thaw(mountpoint string) error {
+	return ThawFilesystem(mountpoint)
+}
+
+// FreezeTimeoutError tells that filesystems got thawed because
+// the freeze timeout elapsed before the operation completed.
+type FreezeTimeoutError struct {
+	Mountpoints []string
+	Timeout     time.Duration
+}
+
+func (e *FreezeTimeoutError) Error() string {
+	return fmt.Sprintf(
+		"filesystems at %s got thawed after %s, before the operation completed",
+		strings.Join(e.Mountpoints, ", "), e.Timeout)
+}
+
+// ThawError tells that an operation ran while filesystems were
+// frozen but they couldn't all be thawed afterwards.
+type ThawError struct {
+	Err error
+}
+
+func (e *ThawError) Error() string {
+	return e.Err.Error()
+}
+
+// WithFrozenFilesystem runs 'fn' while the filesystem mounted
+// at 'mountpoint' is frozen (see WithFrozenFilesystems).
+func WithFrozenFilesystem(freezer Freezer, mountpoint string, timeout time.Duration, fn func() error) (err error) {
+	return WithFrozenFilesystems(freezer, []string{mountpoint}, timeout, fn)
+}
+
+// WithFrozenFilesystems runs 'fn' while the filesystems mounted
+// at 'mountpoints' are all frozen.
+// The filesystems are thawed when 'fn' returns (or panics) or
+// once 'timeout' elapses after they got frozen, whatever comes
+// first, such that a stuck 'fn' can't block writes forever. If
+// the timeout elapses, 'fn' is still waited for, but a
+// FreezeTimeoutError is returned as what it did might not be
+// consistent. Failures to thaw give a ThawError.
+// If one of the filesystems can't be frozen, the ones already
+// frozen are thawed and 'fn' is not run.
+func WithFrozenFilesystems(freezer Freezer, mountpoints []string, timeout time.Duration, fn func() error) (err error) {
+	var (
+		once     sync.Once
+		frozen   []string
+		timedOut bool
+		thawErr  error
+		mu       sync.Mutex
+	)
+
+	thaw := func() {
+		once.Do(func() {
+			for i := len(frozen) - 1; i >= 0; i-- {
+				err := freezer.Thaw(frozen[i])
+				if err != nil && thawErr == nil {
+					thawErr = err
+				}
+			}
+		})
+	}
+
+	for _, mountpoint := range mountpoints {
+		err = freezer.Freeze(mountpoint)
+		if err != nil {
+			thaw()
+			return
+		}
+
+		frozen = append(frozen, mountpoint)
+	}
+
+	timer := time.AfterFunc(timeout, func() {
+		mu.Lock()
+		timedOut = true
+		mu.Unlock()
+
+		thaw()
+	})
+
+	defer func() {
+		timer.Stop()
+		thaw()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case err != nil:
+			// the error of the operation prevails
+		case timedOut:
+			err = &FreezeTimeoutError{
+				Mountpoints: mountpoints,
+				Timeout:     timeout,
+			}
+		case thawErr != nil:
+			err = &ThawError{Err: thawErr}
+		}
+	}()
+
+	err = fn()
+	return
+}
+
+// volumeMountpoints lists where the filesystems of 'vols' are
+// mounted, one mountpoint per mounted volume. Volumes that
+// aren't active or mounted are left out.
+func (l Lvm) volumeMountpoints(vols []*LogicalVolume) (mountpoints []string, err error) {
+	var (
+		devices []DeviceNumber
+		table   *MountTable
+		mounts  []*MountInfo
+		seen    = map[string]bool{}
+	)
+
+	for _, vol := range vols {
+		if vol.LvDmPath == "" {
+			continue
+		}
+
+		if table == nil {
+			table, err = l.GetMountTable()
+			if err != nil {
+				return
+			}
+		}
+
+		devices, err = l.VolumeDeviceNumbers(vol)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't retrieve device numbers of volume %s",
+				vol.LvName)
+			return
+		}
+
+		mounts = table.OfDevices(devices)
+		if len(mounts) == 0 || seen[mounts[0].Location] {
+			continue
+		}
+
+		seen[mounts[0].Location] = true
+		mountpoints = append(mountpoints, mounts[0].Location)
+	}
+
+	return
+}
+
+// createFrozen runs 'create' while the filesystems mounted at
+// 'mountpoints' are frozen. Volumes created after the timeout
+// thawed the filesystems might not be consistent, so 'remove'
+// gets rid of them. Failures to thaw don't affect the volumes,
+// which were all created while frozen, and are only logged.
+func (l Lvm) createFrozen(mountpoints []string, timeout time.Duration, create func() error, remove func()) (err error) {
+	var freezer = l.freezer
+
+	if freezer == nil {
+		freezer = IoctlFreezer{}
+	}
+
+	err = WithFrozenFilesystems(freezer, mountpoints, timeout, create)
+	switch err.(type) {
+	case *FreezeTimeoutError:
+		remove()
+	case *ThawError:
+		l.logger.Error().
+			Err(err).
+			Strs("mountpoints", mountpoints).
+			Msg("couldn't thaw filesystems after creating volumes")
+		err = nil
+	}
+
+	return
+}
+
+// CreateSnapshot creates a snapshot (or any volume described
+// by 'cfg') of 'origin', freezing the filesystem of 'origin'
+// while it's taken if it's mounted, such that the snapshot
+// is consistent. A zero 'timeout' disables the freezing.
+// If the timeout elapses before the snapshot is taken, the
+// snapshot is removed.
+func (l Lvm) CreateSnapshot(cfg LvCreationConfig, origin *LogicalVolume, timeout time.Duration) (err error) {
+	var mountpoints []string
+
+	if timeout == 0 {
+		return l.CreateLv(cfg)
+	}
+
+	mountpoints, err = l.volumeMountpoints([]*LogicalVolume{origin})
+	if err != nil {
+		return
+	}
+
+	if len(mountpoints) == 0 {
+		return l.CreateLv(cfg)
+	}
+
+	l.logger.Debug().
+		Str("origin", origin.LvName).
+		Str("mountpoint", mountpoints[0]).
+		Dur("timeout", timeout).
+		Msg("freezing origin filesystem")
+
+	err = l.createFrozen(mountpoints[:1], timeout, func() error {
+		return l.CreateLv(cfg)
+	}, func() {
+		rmErr := l.RemoveLv(LvRemovalConfig{
+			LvName: cfg.Name,
+			VgName: cfg.VolumeGroup,
+		})
+		if rmErr != nil {
+			l.logger.Error().
+				Err(rmErr).
+				Str("snapshot", cfg.Name).
+				Msg("couldn't remove snapshot taken after the freeze timeout")
+		}
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to create snapshot of frozen volume %s",
+			origin.LvName)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,176 @@
+package lib
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFreezer records the freezes and thaws requested.
+type fakeFreezer struct {
+	calls     []string
+	freezeErr error
+	thawErr   error
+
+	sync.Mutex
+}
+
+func (f *fakeFreezer) Freeze(mountpoint string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	f.calls = append(f.calls, "freeze "+mountpoint)
+	return f.freezeErr
+}
+
+func (f *fakeFreezer) Thaw(mountpoint string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	f.calls = append(f.calls, "thaw "+mountpoint)
+	return f.thawErr
+}
+
+func (f *fakeFreezer) Calls() []string {
+	f.Lock()
+	defer f.Unlock()
+
+	return append([]string{}, f.calls...)
+}
+
+func TestWithFrozenFilesystem(t *testing.T) {
+	var freezer = new(fakeFreezer)
+
+	err := WithFrozenFilesystem(freezer, "/mnt", time.Second, func() error {
+		assert.Equal(t, []string{"freeze /mnt"}, freezer.Calls())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"freeze /mnt", "thaw /mnt"}, freezer.Calls())
+}
+
+func TestWithFrozenFilesystem_thawsWhenOperationFails(t *testing.T) {
+	var freezer = new(fakeFreezer)
+
+	err := WithFrozenFilesystem(freezer, "/mnt", time.Second, func() error {
+		return errors.Errorf("lvcreate failed")
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lvcreate failed")
+	assert.Equal(t, []string{"freeze /mnt", "thaw /mnt"}, freezer.Calls())
+}
+
+func TestWithFrozenFilesystem_thawsWhenOperationPanics(t *testing.T) {
+	var freezer = new(fakeFreezer)
+
+	assert.Panics(t, func() {
+		WithFrozenFilesystem(freezer, "/mnt", time.Second, func() error {
+			panic("boom")
+		})
+	})
+	assert.Equal(t, []string{"freeze /mnt", "thaw /mnt"}, freezer.Calls())
+}
+
+func TestWithFrozenFilesystem_thawsOnTimeout(t *testing.T) {
+	var freezer = new(fakeFreezer)
+
+	err := WithFrozenFilesystem(freezer, "/mnt", 10*time.Millisecond, func() error {
+		time.Sleep(200 * time.Millisecond)
+
+		// thawed while the operation was still running
+		assert.Equal(t, []string{"freeze /mnt", "thaw /mnt"}, freezer.Calls())
+		return nil
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "got thawed")
+	assert.Equal(t, []string{"freeze /mnt", "thaw /mnt"}, freezer.Calls())
+}
+
+func TestLvm_createFrozen(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		freezer     *fakeFreezer
+		delay       time.Duration
+		removed     bool
+		shouldError bool
+	}{
+		{
+			desc:    "keeps volumes created while frozen",
+			freezer: new(fakeFreezer),
+		},
+		{
+			desc:        "removes volumes created after the timeout",
+			freezer:     new(fakeFreezer),
+			delay:       200 * time.Millisecond,
+			removed:     true,
+			shouldError: true,
+		},
+		{
+			desc:    "keeps volumes when thawing fails",
+			freezer: &fakeFreezer{thawErr: errors.Errorf("thaw failed")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var (
+				l       = Lvm{logger: zerolog.Nop(), freezer: tc.freezer}
+				removed bool
+			)
+
+			err := l.createFrozen([]string{"/mnt"}, 50*time.Millisecond, func() error {
+				time.Sleep(tc.delay)
+				return nil
+			}, func() {
+				removed = true
+			})
+			if tc.shouldError {
+				require.Error(t, err)
+				_, ok := err.(*FreezeTimeoutError)
+				assert.True(t, ok)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.removed, removed)
+		})
+	}
+}
+
+func TestWithFrozenFilesystem_doesntRunWhenFreezeFails(t *testing.T) {
+	var (
+		freezer = &fakeFreezer{freezeErr: errors.Errorf("not supported")}
+		ran     bool
+	)
+
+	err := WithFrozenFilesystem(freezer, "/mnt", time.Second, func() error {
+		ran = true
+		return nil
+	})
+	require.Error(t, err)
+	assert.False(t, ran)
+	assert.Equal(t, []string{"freeze /mnt"}, freezer.Calls())
+}
+
+func TestLvm_CreateSnapshot_withoutFreezing(t *testing.T) {
+	var (
+		runner  = &cannedRunner{}
+		freezer = new(fakeFreezer)
+		l       = Lvm{logger: zerolog.Nop(), runner: runner, freezer: freezer}
+	)
+
+	err := l.CreateSnapshot(LvCreationConfig{
+		Name:        "snap",
+		VolumeGroup: "vg",
+		Snapshot:    "origin",
+		Size:        "10M",
+	}, &LogicalVolume{LvName: "origin", LvDmPath: "/dev/vg/origin"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "lvcreate", runner.name)
+	assert.Empty(t, freezer.Calls())
+}
@@ -0,0 +1,344 @@
+package lib
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FsckPolicy determines when filesystems get checked before
+// being mounted.
+type FsckPolicy string
+
+const (
+	// FsckNever never checks filesystems.
+	FsckNever FsckPolicy = "never"
+
+	// FsckAuto checks filesystems that need it: ext
+	// filesystems that weren't cleanly unmounted or that
+	// are due a check. Journaled filesystems that replay
+	// their logs at mount time (xfs and btrfs) are not
+	// checked.
+	FsckAuto FsckPolicy = "auto"
+
+	// FsckAlways checks filesystems on every mount.
+	FsckAlways FsckPolicy = "always"
+)
+
+// FsckStatus summarizes the outcome of a filesystem check.
+type FsckStatus string
+
+const (
+	FsckSkipped     FsckStatus = "skipped"
+	FsckClean       FsckStatus = "clean"
+	FsckCorrected   FsckStatus = "corrected"
+	FsckLogReplay   FsckStatus = "log-replay"
+	FsckUncorrected FsckStatus = "uncorrected"
+	FsckFailed      FsckStatus = "failed"
+)
+
+const (
+	// FsckPolicyTagPrefix prefixes the tag that records
+	// the fsck policy of a volume.
+	FsckPolicyTagPrefix = "golvm/fsck="
+
+	// FsckResultTagPrefix prefixes the tags that record
+	// the result of the last check of a volume.
+	FsckResultTagPrefix = "golvm/fsck-result."
+)
+
+const (
+	e2fsckErrorsCorrected   = 1
+	e2fsckRebootRequired    = 2
+	e2fsckErrorsUncorrected = 4
+
+	// e2fsckFailures groups the exit codes that indicate
+	// that the check itself failed (operational error,
+	// usage error, cancellation and shared library error).
+	e2fsckFailures = 8 | 16 | 32 | 128
+
+	xfsRepairCorrupted = 1
+	xfsRepairDirtyLog  = 2
+)
+
+// FsckResult is the result of a filesystem check.
+type FsckResult struct {
+	Status    FsckStatus
+	ExitCode  int
+	CheckedAt time.Time
+
+	// Output is what the checker printed. It's not
+	// persisted with the volume.
+	Output string
+}
+
+// ParseFsckPolicy validates an fsck policy, defaulting to
+// FsckNever.
+func ParseFsckPolicy(policy string) (parsed FsckPolicy, err error) {
+	switch FsckPolicy(policy) {
+	case "", FsckNever:
+		parsed = FsckNever
+	case FsckAuto, FsckAlways:
+		parsed = FsckPolicy(policy)
+	default:
+		err = errors.Errorf(
+			"unknown fsck policy %s - must be never, auto or always",
+			policy)
+	}
+
+	return
+}
+
+// Mountable indicates whether the filesystem can be mounted
+// after the check.
+func (r FsckResult) Mountable() bool {
+	switch r.Status {
+	case FsckSkipped, FsckClean, FsckCorrected, FsckLogReplay:
+		return true
+	}
+
+	return false
+}
+
+// Tags gives the tags that persist the result with a volume.
+// Checks that were skipped are not recorded.
+func (r FsckResult) Tags() (tags []string) {
+	if r.Status == FsckSkipped {
+		return
+	}
+
+	tags = []string{
+		FsckResultTagPrefix + "status=" + string(r.Status),
+		FsckResultTagPrefix + "exit=" + strconv.Itoa(r.ExitCode),
+		FsckResultTagPrefix + "time=" + r.CheckedAt.UTC().Format(time.RFC3339),
+	}
+	return
+}
+
+// VolumeFsckPolicy retrieves the fsck policy persisted in the
+// tags of a volume. If there's none, 'found' is false.
+func VolumeFsckPolicy(vol *LogicalVolume) (policy FsckPolicy, found bool, err error) {
+	for _, tag := range vol.LvTags {
+		if strings.HasPrefix(tag, FsckPolicyTagPrefix) {
+			found = true
+			policy, err = ParseFsckPolicy(
+				strings.TrimPrefix(tag, FsckPolicyTagPrefix))
+			return
+		}
+	}
+
+	return
+}
+
+// VolumeFsckResult retrieves the result of the last check
+// persisted in the tags of a volume. If the volume was never
+// checked, a nil result is returned.
+func VolumeFsckResult(vol *LogicalVolume) (result *FsckResult, err error) {
+	for _, tag := range vol.LvTags {
+		if !strings.HasPrefix(tag, FsckResultTagPrefix) {
+			continue
+		}
+
+		if result == nil {
+			result = &FsckResult{}
+		}
+
+		var parts = strings.SplitN(
+			strings.TrimPrefix(tag, FsckResultTagPrefix), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch parts[0] {
+		case "status":
+			result.Status = FsckStatus(parts[1])
+		case "exit":
+			result.ExitCode, err = strconv.Atoi(parts[1])
+		case "time":
+			result.CheckedAt, err = time.Parse(time.RFC3339, parts[1])
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err,
+				"malformed fsck result tag %s of volume %s",
+				tag, vol.LvName)
+			return
+		}
+	}
+
+	return
+}
+
+// BuildFsckArgs builds the command line (argv) that checks
+// the filesystem of 'device' according to 'policy'. An empty
+// command line means that no check is needed.
+//	-	ext2/3/4:	'e2fsck -p', which only checks
+//				filesystems that need it unless
+//				forced with '-f' (always);
+//	-	xfs:		'xfs_repair -n' (always);
+//	-	btrfs:		'btrfs check --readonly' (always).
+func BuildFsckArgs(device, fsType string, policy FsckPolicy) (argv []string, err error) {
+	if device == "" {
+		err = errors.Errorf("a device must be specified")
+		return
+	}
+
+	if policy == FsckNever {
+		return
+	}
+
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		argv = []string{"e2fsck", "-p"}
+		if policy == FsckAlways {
+			argv = append(argv, "-f")
+		}
+	case "xfs":
+		if policy == FsckAlways {
+			argv = []string{"xfs_repair", "-n"}
+		}
+	case "btrfs":
+		if policy == FsckAlways {
+			argv = []string{"btrfs", "check", "--readonly"}
+		}
+	}
+
+	if argv != nil {
+		argv = append(argv, device)
+	}
+
+	return
+}
+
+// FsckStatusFromExitCode interprets the exit code of the
+// checker of a filesystem.
+func FsckStatusFromExitCode(fsType string, code int) FsckStatus {
+	if code == 0 {
+		return FsckClean
+	}
+
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		switch {
+		case code&e2fsckFailures != 0:
+			return FsckFailed
+		case code&e2fsckErrorsUncorrected != 0:
+			return FsckUncorrected
+		case code&(e2fsckErrorsCorrected|e2fsckRebootRequired) != 0:
+			return FsckCorrected
+		}
+	case "xfs":
+		switch code {
+		case xfsRepairCorrupted:
+			return FsckUncorrected
+		case xfsRepairDirtyLog:
+			// the log gets replayed when mounting, only
+			// after which the check is meaningful.
+			return FsckLogReplay
+		}
+	case "btrfs":
+		return FsckUncorrected
+	}
+
+	return FsckFailed
+}
+
+// exitCode retrieves the exit code of a command that ran
+// through a Runner, erroring if it didn't run at all.
+func exitCode(runErr error) (code int, err error) {
+	if runErr == nil {
+		return
+	}
+
+	exitErr, ok := errors.Cause(runErr).(*exec.ExitError)
+	if !ok {
+		err = runErr
+		return
+	}
+
+	code = exitErr.ExitCode()
+	return
+}
+
+// CheckFilesystem checks the filesystem of a device that is
+// not mounted according to 'policy'.
+// Errors are only returned when the checker couldn't run;
+// the outcome of the check is in the result's status.
+func (l Lvm) CheckFilesystem(device, fsType string, policy FsckPolicy) (result FsckResult, err error) {
+	var (
+		argv   []string
+		output []byte
+	)
+
+	argv, err = BuildFsckArgs(device, fsType, policy)
+	if err != nil {
+		return
+	}
+
+	if len(argv) == 0 {
+		result.Status = FsckSkipped
+		return
+	}
+
+	result.CheckedAt = time.Now()
+	output, err = l.Run(argv[0], argv[1:]...)
+	result.Output = string(output)
+
+	result.ExitCode, err = exitCode(err)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't check filesystem of device %s", device)
+		return
+	}
+
+	result.Status = FsckStatusFromExitCode(fsType, result.ExitCode)
+
+	l.logger.Info().
+		Str("device", device).
+		Str("fstype", fsType).
+		Str("status", string(result.Status)).
+		Int("exit-code", result.ExitCode).
+		Msg("filesystem checked")
+
+	return
+}
+
+// ReplaceTags removes the tags of a volume that start with
+// 'prefix' and adds 'tags' in a single 'lvchange' call.
+func (l Lvm) ReplaceTags(vol *LogicalVolume, prefix string, tags []string) (err error) {
+	var args []string
+
+	for _, tag := range vol.LvTags {
+		if strings.HasPrefix(tag, prefix) {
+			args = append(args, "--deltag", tag)
+		}
+	}
+
+	for _, tag := range tags {
+		err = ValidateTag(tag)
+		if err != nil {
+			return
+		}
+
+		args = append(args, "--addtag", tag)
+	}
+
+	if len(args) == 0 {
+		return
+	}
+
+	args = append(args, vol.VgName+"/"+vol.LvName)
+
+	_, err = l.Run("lvchange", args...)
+	l.InvalidateInventory()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't update tags of volume %s", vol.LvName)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exitingRunner runs a shell that prints 'output' and exits
+// with 'code' in place of any command, recording the last
+// command requested.
+type exitingRunner struct {
+	output string
+	code   int
+	argv   []string
+}
+
+func (r *exitingRunner) Run(name string, args ...string) ([]byte, error) {
+	r.argv = append([]string{name}, args...)
+	return ExecRunner{}.Run("sh", "-c",
+		fmt.Sprintf("printf '%s'; exit %d", r.output, r.code))
+}
+
+func TestBuildFsckArgs(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		fsType   string
+		policy   FsckPolicy
+		expected []string
+	}{
+		{"never checks", "ext4", FsckNever, nil},
+		{"ext4 auto", "ext4", FsckAuto, []string{"e2fsck", "-p", "/dev/dev"}},
+		{"ext4 always", "ext4", FsckAlways, []string{"e2fsck", "-p", "-f", "/dev/dev"}},
+		{"xfs auto relies on log replay", "xfs", FsckAuto, nil},
+		{"xfs always", "xfs", FsckAlways, []string{"xfs_repair", "-n", "/dev/dev"}},
+		{"btrfs always", "btrfs", FsckAlways, []string{"btrfs", "check", "--readonly", "/dev/dev"}},
+		{"raw volumes are never checked", "none", FsckAlways, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			argv, err := BuildFsckArgs("/dev/dev", tc.fsType, tc.policy)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, argv)
+		})
+	}
+
+	_, err := BuildFsckArgs("", "ext4", FsckAuto)
+	assert.Error(t, err)
+}
+
+func TestFsckStatusFromExitCode(t *testing.T) {
+	var testCases = []struct {
+		fsType   string
+		code     int
+		expected FsckStatus
+	}{
+		{"ext4", 0, FsckClean},
+		{"ext4", 1, FsckCorrected},
+		{"ext4", 3, FsckCorrected},
+		{"ext4", 4, FsckUncorrected},
+		{"ext4", 5, FsckUncorrected},
+		{"ext4", 8, FsckFailed},
+		{"ext4", 12, FsckFailed},
+		{"xfs", 0, FsckClean},
+		{"xfs", 1, FsckUncorrected},
+		{"xfs", 2, FsckLogReplay},
+		{"xfs", 3, FsckFailed},
+		{"btrfs", 1, FsckUncorrected},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s exiting with %d", tc.fsType, tc.code), func(t *testing.T) {
+			assert.Equal(t, tc.expected, FsckStatusFromExitCode(tc.fsType, tc.code))
+		})
+	}
+}
+
+func TestLvm_CheckFilesystem(t *testing.T) {
+	var (
+		runner = &exitingRunner{output: "dev: 11/256 files", code: 4}
+		l      = Lvm{logger: zerolog.Nop(), runner: runner}
+	)
+
+	result, err := l.CheckFilesystem("/dev/dev", "ext4", FsckAlways)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e2fsck", "-p", "-f", "/dev/dev"}, runner.argv)
+	assert.Equal(t, FsckUncorrected, result.Status)
+	assert.Equal(t, 4, result.ExitCode)
+	assert.Contains(t, result.Output, "dev: 11/256 files")
+	assert.False(t, result.Mountable())
+
+	runner.code = 1
+	result, err = l.CheckFilesystem("/dev/dev", "ext4", FsckAuto)
+	require.NoError(t, err)
+	assert.Equal(t, FsckCorrected, result.Status)
+	assert.True(t, result.Mountable())
+
+	result, err = l.CheckFilesystem("/dev/dev", "xfs", FsckAuto)
+	require.NoError(t, err)
+	assert.Equal(t, FsckSkipped, result.Status)
+	assert.True(t, result.Mountable())
+	assert.Empty(t, result.Tags())
+}
+
+func TestVolumeFsckResult(t *testing.T) {
+	var (
+		checkedAt = time.Date(2018, 3, 4, 10, 20, 30, 0, time.UTC)
+		result    = FsckResult{
+			Status:    FsckCorrected,
+			ExitCode:  1,
+			CheckedAt: checkedAt,
+		}
+		vol = &LogicalVolume{LvName: "vol"}
+	)
+
+	persisted, err := VolumeFsckResult(vol)
+	require.NoError(t, err)
+	assert.Nil(t, persisted)
+
+	for _, tag := range result.Tags() {
+		require.NoError(t, ValidateTag(tag))
+	}
+
+	vol.LvTags = append(StringList{"golvm/fsck=always"}, result.Tags()...)
+
+	persisted, err = VolumeFsckResult(vol)
+	require.NoError(t, err)
+	require.NotNil(t, persisted)
+	assert.Equal(t, result, *persisted)
+
+	policy, found, err := VolumeFsckPolicy(vol)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, FsckAlways, policy)
+}
+
+func TestLvm_ReplaceTags(t *testing.T) {
+	var (
+		runner = &cannedRunner{}
+		l      = Lvm{logger: zerolog.Nop(), runner: runner}
+		vol    = &LogicalVolume{
+			LvName: "vol",
+			VgName: "vg",
+			LvTags: StringList{"golvm/fstype=ext4", "golvm/fsck-result.exit=4"},
+		}
+	)
+
+	err := l.ReplaceTags(vol, FsckResultTagPrefix, []string{"golvm/fsck-result.exit=0"})
+	require.NoError(t, err)
+	assert.Equal(t, "lvchange", runner.name)
+	assert.Equal(t, []string{
+		"--deltag", "golvm/fsck-result.exit=4",
+		"--addtag", "golvm/fsck-result.exit=0",
+		"vg/vol",
+	}, runner.args)
+
+	err = l.ReplaceTags(vol, FsckResultTagPrefix, []string{"with spaces"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,407 @@
+package lib
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SnapshotGroupTagPrefix prefixes the tag that records the
+// consistency group that a snapshot was taken as part of.
+const SnapshotGroupTagPrefix = "golvm/group="
+
+// validGroupName matches the names that can be used both in
+// tags and in the names of logical volumes.
+var validGroupName = regexp.MustCompile(`^[A-Za-z0-9_+.\-]+$`)
+
+// SnapshotGroupConfig describes a consistency group: a set of
+// snapshots of different volumes taken at the same point in
+// time.
+type SnapshotGroupConfig struct {
+	// Name identifies the group. Each snapshot is named
+	// after its origin and the group (see
+	// SnapshotGroupMemberName).
+	Name string
+
+	// Size of each snapshot (not needed for thin origins).
+	Size string
+
+	// FreezeTimeout is how long the filesystems of the
+	// mounted origins can be kept frozen at most. Zero
+	// disables freezing.
+	FreezeTimeout time.Duration
+}
+
+// ValidateSnapshotGroupName checks whether 'name' can be used
+// to name a consistency group.
+func ValidateSnapshotGroupName(name string) (err error) {
+	if !validGroupName.MatchString(name) || strings.HasPrefix(name, "-") {
+		err = errors.Errorf(
+			"invalid group name '%s' - must only contain "+
+				"[A-Za-z0-9_+.-] and not start with '-'", name)
+		return
+	}
+
+	return
+}
+
+// SnapshotGroupMemberName is the name of the snapshot of
+// 'origin' that is part of the group 'group'.
+func SnapshotGroupMemberName(origin *LogicalVolume, group string) string {
+	return origin.LvName + "_" + group
+}
+
+// VolumeSnapshotGroup retrieves the consistency group that a
+// volume is part of, if any.
+func VolumeSnapshotGroup(vol *LogicalVolume) (group string, found bool) {
+	for _, tag := range vol.LvTags {
+		if strings.HasPrefix(tag, SnapshotGroupTagPrefix) {
+			group = strings.TrimPrefix(tag, SnapshotGroupTagPrefix)
+			found = true
+			return
+		}
+	}
+
+	return
+}
+
+// SnapshotGroups indexes the volumes that are part of a
+// consistency group by the name of the group.
+func SnapshotGroups(vols []*LogicalVolume) (groups map[string][]*LogicalVolume) {
+	groups = map[string][]*LogicalVolume{}
+
+	for _, vol := range vols {
+		group, found := VolumeSnapshotGroup(vol)
+		if !found {
+			continue
+		}
+
+		groups[group] = append(groups[group], vol)
+	}
+
+	return
+}
+
+// BuildSnapshotGroupConfigs builds the configuration of each
+// of the snapshots of a consistency group. Snapshots keep the
+// mount options of their origins and get tagged with the
+// group.
+func BuildSnapshotGroupConfigs(cfg SnapshotGroupConfig, origins []*LogicalVolume) (cfgs []LvCreationConfig, err error) {
+	var (
+		opts MountOptions
+		seen = map[string]bool{}
+	)
+
+	err = ValidateSnapshotGroupName(cfg.Name)
+	if err != nil {
+		return
+	}
+
+	if len(origins) == 0 {
+		err = errors.Errorf(
+			"at least one volume must be part of group %s", cfg.Name)
+		return
+	}
+
+	for _, origin := range origins {
+		var fullName = origin.VgName + "/" + origin.LvName
+
+		if seen[fullName] {
+			err = errors.Errorf(
+				"volume %s specified more than once", fullName)
+			return
+		}
+		seen[fullName] = true
+
+		if origin.Origin != "" {
+			err = errors.Errorf(
+				"volume %s is a snapshot itself", fullName)
+			return
+		}
+
+		opts, err = VolumeMountOptions(origin)
+		if err != nil {
+			return
+		}
+
+		lvCfg := LvCreationConfig{
+			Name:         SnapshotGroupMemberName(origin, cfg.Name),
+			Snapshot:     origin.LvName,
+			ThinSnapshot: origin.PoolLv != "",
+			VolumeGroup:  origin.VgName,
+			Tags: append(opts.Tags(),
+				SnapshotGroupTagPrefix+cfg.Name),
+		}
+
+		if !lvCfg.ThinSnapshot {
+			lvCfg.Size = cfg.Size
+		}
+
+		_, err = BuildLogicalVolumeCretionArgs(lvCfg)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"invalid snapshot of volume %s", fullName)
+			return
+		}
+
+		cfgs = append(cfgs, lvCfg)
+	}
+
+	return
+}
+
+// BuildMergeSnapshotsArgs builds the arguments to 'lvconvert'
+// that merge the snapshots 'snapshots' back into their origins.
+func BuildMergeSnapshotsArgs(snapshots []*LogicalVolume) (args []string, err error) {
+	if len(snapshots) == 0 {
+		err = errors.Errorf("at least one snapshot must be specified")
+		return
+	}
+
+	args = []string{"--merge"}
+	for _, snapshot := range snapshots {
+		if snapshot.Origin == "" {
+			err = errors.Errorf(
+				"volume %s/%s is not a snapshot",
+				snapshot.VgName, snapshot.LvName)
+			return
+		}
+
+		args = append(args, snapshot.VgName+"/"+snapshot.LvName)
+	}
+
+	return
+}
+
+// CreateSnapshotGroup snapshots all the 'origins' at the same
+// point in time: the filesystems of the mounted ones are all
+// frozen while the snapshots are taken.
+// If one of the snapshots can't be created or the freeze
+// timeout elapses before they all are, the ones already
+// created are removed such that the group is either complete
+// or nonexistent. Failures to thaw the filesystems afterwards
+// don't affect the group (see createFrozen).
+func (l Lvm) CreateSnapshotGroup(cfg SnapshotGroupConfig, origins []*LogicalVolume) (err error) {
+	var (
+		cfgs        []LvCreationConfig
+		mountpoints []string
+		existing    []*LogicalVolume
+	)
+
+	cfgs, err = BuildSnapshotGroupConfigs(cfg, origins)
+	if err != nil {
+		return
+	}
+
+	existing, err = l.FindLogicalVolumes(LvQuery{
+		Tags: []string{SnapshotGroupTagPrefix + cfg.Name},
+	})
+	if err != nil {
+		return
+	}
+
+	if len(existing) > 0 {
+		err = errors.Errorf("group %s already exists", cfg.Name)
+		return
+	}
+
+	remove := func(created []LvCreationConfig) {
+		for _, lvCfg := range created {
+			rmErr := l.RemoveLv(LvRemovalConfig{
+				LvName: lvCfg.Name,
+				VgName: lvCfg.VolumeGroup,
+			})
+			if rmErr != nil {
+				l.logger.Error().
+					Err(rmErr).
+					Str("snapshot", lvCfg.Name).
+					Msg("couldn't remove snapshot of incomplete group")
+			}
+		}
+	}
+
+	create := func() (err error) {
+		for i, lvCfg := range cfgs {
+			err = l.CreateLv(lvCfg)
+			if err == nil {
+				continue
+			}
+
+			err = errors.Wrapf(err,
+				"failed to create snapshot %s of group %s",
+				lvCfg.Name, cfg.Name)
+			remove(cfgs[:i])
+			return
+		}
+
+		return
+	}
+
+	if cfg.FreezeTimeout == 0 {
+		return create()
+	}
+
+	mountpoints, err = l.volumeMountpoints(origins)
+	if err != nil {
+		return
+	}
+
+	if len(mountpoints) == 0 {
+		return create()
+	}
+
+	l.logger.Debug().
+		Str("group", cfg.Name).
+		Strs("mountpoints", mountpoints).
+		Dur("timeout", cfg.FreezeTimeout).
+		Msg("freezing filesystems of group")
+
+	err = l.createFrozen(mountpoints, cfg.FreezeTimeout, create, func() {
+		remove(cfgs)
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to snapshot frozen volumes of group %s", cfg.Name)
+		return
+	}
+
+	return
+}
+
+// GetSnapshotGroup retrieves the snapshots that are part of
+// the group 'group'.
+func (l Lvm) GetSnapshotGroup(group string) (snapshots []*LogicalVolume, err error) {
+	err = ValidateSnapshotGroupName(group)
+	if err != nil {
+		return
+	}
+
+	snapshots, err = l.FindLogicalVolumes(LvQuery{
+		Tags: []string{SnapshotGroupTagPrefix + group},
+	})
+	if err != nil {
+		return
+	}
+
+	if len(snapshots) == 0 {
+		err = errors.Errorf("group %s not found", group)
+		return
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].LvFullName < snapshots[j].LvFullName
+	})
+
+	return
+}
+
+// ensureUnmounted errors if any of 'vols' is mounted.
+func (l Lvm) ensureUnmounted(vols []*LogicalVolume) (err error) {
+	var mountpoints []string
+
+	mountpoints, err = l.volumeMountpoints(vols)
+	if err != nil {
+		return
+	}
+
+	if len(mountpoints) > 0 {
+		err = errors.Errorf(
+			"volumes mounted at %s must be unmounted first",
+			strings.Join(mountpoints, ", "))
+		return
+	}
+
+	return
+}
+
+// RemoveSnapshotGroup removes all the snapshots of the group
+// 'group'. Nothing is removed if any of them is mounted.
+func (l Lvm) RemoveSnapshotGroup(group string) (err error) {
+	var snapshots []*LogicalVolume
+
+	snapshots, err = l.GetSnapshotGroup(group)
+	if err != nil {
+		return
+	}
+
+	err = l.ensureUnmounted(snapshots)
+	if err != nil {
+		err = errors.Wrapf(err, "can't remove group %s", group)
+		return
+	}
+
+	for _, snapshot := range snapshots {
+		err = l.RemoveLv(LvRemovalConfig{
+			LvName: snapshot.LvName,
+			VgName: snapshot.VgName,
+		})
+		if err != nil {
+			err = errors.Wrapf(err,
+				"failed to remove snapshot %s of group %s",
+				snapshot.LvName, group)
+			return
+		}
+	}
+
+	return
+}
+
+// RollbackSnapshotGroup reverts the origins of the snapshots
+// of the group 'group' to the point in time when the group was
+// created by merging the snapshots back into them. The merge
+// consumes the snapshots. Both the snapshots and their origins
+// must be unmounted.
+func (l Lvm) RollbackSnapshotGroup(group string) (err error) {
+	var (
+		snapshots []*LogicalVolume
+		origins   []*LogicalVolume
+		origin    *LogicalVolume
+		args      []string
+	)
+
+	snapshots, err = l.GetSnapshotGroup(group)
+	if err != nil {
+		return
+	}
+
+	for _, snapshot := range snapshots {
+		origin, err = l.GetLogicalVolume(
+			snapshot.VgName + "/" + snapshot.Origin)
+		if err != nil {
+			return
+		}
+
+		if origin == nil {
+			err = errors.Errorf(
+				"origin %s of snapshot %s not found",
+				snapshot.Origin, snapshot.LvName)
+			return
+		}
+
+		origins = append(origins, origin)
+	}
+
+	err = l.ensureUnmounted(append(origins, snapshots...))
+	if err != nil {
+		err = errors.Wrapf(err, "can't roll back group %s", group)
+		return
+	}
+
+	args, err = BuildMergeSnapshotsArgs(snapshots)
+	if err != nil {
+		return
+	}
+
+	_, err = l.Run("lvconvert", args...)
+	l.InvalidateInventory()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to merge snapshots of group %s", group)
+		return
+	}
+
+	return
+}
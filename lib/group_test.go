@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSnapshotGroupConfigs(t *testing.T) {
+	var (
+		data = &LogicalVolume{
+			LvName: "data",
+			VgName: "vg",
+			LvTags: StringList{"golvm/fstype=xfs", "golvm/mountopt=noatime"},
+		}
+		wal = &LogicalVolume{LvName: "wal", VgName: "vg2"}
+		cfg = SnapshotGroupConfig{Name: "nightly", Size: "10M"}
+	)
+
+	cfgs, err := BuildSnapshotGroupConfigs(cfg, []*LogicalVolume{data, wal})
+	require.NoError(t, err)
+	assert.Equal(t, []LvCreationConfig{
+		{
+			Name:        "data_nightly",
+			Size:        "10M",
+			Snapshot:    "data",
+			VolumeGroup: "vg",
+			Tags: []string{
+				"golvm/fstype=xfs",
+				"golvm/mountopt=noatime",
+				"golvm/group=nightly",
+			},
+		},
+		{
+			Name:        "wal_nightly",
+			Size:        "10M",
+			Snapshot:    "wal",
+			VolumeGroup: "vg2",
+			Tags: []string{
+				"golvm/fstype=ext4",
+				"golvm/group=nightly",
+			},
+		},
+	}, cfgs)
+}
+
+func TestBuildSnapshotGroupConfigs_fails(t *testing.T) {
+	var (
+		vol      = &LogicalVolume{LvName: "data", VgName: "vg"}
+		snapshot = &LogicalVolume{LvName: "snap", VgName: "vg", Origin: "data"}
+	)
+
+	var testCases = []struct {
+		desc    string
+		cfg     SnapshotGroupConfig
+		origins []*LogicalVolume
+	}{
+		{"invalid group name", SnapshotGroupConfig{Name: "a b", Size: "10M"}, []*LogicalVolume{vol}},
+		{"group name starting with -", SnapshotGroupConfig{Name: "-a", Size: "10M"}, []*LogicalVolume{vol}},
+		{"no volumes", SnapshotGroupConfig{Name: "g", Size: "10M"}, nil},
+		{"repeated volumes", SnapshotGroupConfig{Name: "g", Size: "10M"}, []*LogicalVolume{vol, vol}},
+		{"snapshot of snapshot", SnapshotGroupConfig{Name: "g", Size: "10M"}, []*LogicalVolume{snapshot}},
+		{"missing size", SnapshotGroupConfig{Name: "g"}, []*LogicalVolume{vol}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := BuildSnapshotGroupConfigs(tc.cfg, tc.origins)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSnapshotGroups(t *testing.T) {
+	var (
+		a = &LogicalVolume{LvName: "a", LvTags: StringList{"golvm/group=g1"}}
+		b = &LogicalVolume{LvName: "b", LvTags: StringList{"golvm/fstype=xfs", "golvm/group=g1"}}
+		c = &LogicalVolume{LvName: "c", LvTags: StringList{"golvm/group=g2"}}
+		d = &LogicalVolume{LvName: "d"}
+	)
+
+	assert.Equal(t, map[string][]*LogicalVolume{
+		"g1": {a, b},
+		"g2": {c},
+	}, SnapshotGroups([]*LogicalVolume{a, b, c, d}))
+
+	_, found := VolumeSnapshotGroup(d)
+	assert.False(t, found)
+}
+
+func TestBuildMergeSnapshotsArgs(t *testing.T) {
+	args, err := BuildMergeSnapshotsArgs([]*LogicalVolume{
+		{LvName: "data_g", VgName: "vg", Origin: "data"},
+		{LvName: "wal_g", VgName: "vg2", Origin: "wal"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--merge", "vg/data_g", "vg2/wal_g"}, args)
+
+	_, err = BuildMergeSnapshotsArgs(nil)
+	assert.Error(t, err)
+
+	_, err = BuildMergeSnapshotsArgs([]*LogicalVolume{{LvName: "data", VgName: "vg"}})
+	assert.Error(t, err)
+}
+
+func TestWithFrozenFilesystems(t *testing.T) {
+	var freezer = new(fakeFreezer)
+
+	err := WithFrozenFilesystems(freezer, []string{"/data", "/wal"}, time.Second, func() error {
+		assert.Equal(t, []string{"freeze /data", "freeze /wal"}, freezer.Calls())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"freeze /data", "freeze /wal",
+		"thaw /wal", "thaw /data",
+	}, freezer.Calls())
+}
+
+// failingFreezer fails to freeze a specific mountpoint.
+type failingFreezer struct {
+	fakeFreezer
+	failing string
+}
+
+func (f *failingFreezer) Freeze(mountpoint string) error {
+	f.fakeFreezer.Freeze(mountpoint)
+	if mountpoint == f.failing {
+		return errors.Errorf("can't freeze %s", mountpoint)
+	}
+
+	return nil
+}
+
+func TestWithFrozenFilesystems_thawsWhenFreezeFails(t *testing.T) {
+	var (
+		freezer = &failingFreezer{failing: "/wal"}
+		ran     bool
+	)
+
+	err := WithFrozenFilesystems(freezer, []string{"/data", "/wal", "/logs"}, time.Second, func() error {
+		ran = true
+		return nil
+	})
+	require.Error(t, err)
+	assert.False(t, ran)
+	assert.Equal(t, []string{"freeze /data", "freeze /wal", "thaw /data"}, freezer.Calls())
+}
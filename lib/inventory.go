@@ -0,0 +1,178 @@
+package lib
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Inventory is a consistent snapshot of the LVM topology
+// (physical volumes, volume groups, logical volumes and their
+// segments) gathered from a single 'lvm fullreport' call.
+type Inventory struct {
+	PhysicalVolumes []*PhysicalVolume
+	VolumeGroups    []*VolumeGroup
+
+	// AllLogicalVolumes includes hidden volumes (e.g., raid
+	// images and thin pool data volumes), whose names are
+	// enclosed in brackets.
+	AllLogicalVolumes []*LogicalVolume
+
+	Segments []*LogicalVolumeSegment
+}
+
+// isHiddenLv indicates whether a logical volume name refers
+// to a volume that lvm hides from the default listings.
+func isHiddenLv(name string) bool {
+	return strings.HasPrefix(name, "[")
+}
+
+// LogicalVolumes lists the logical volumes that are not
+// hidden, i.e., those that 'lvs' would show without '--all'.
+func (inv *Inventory) LogicalVolumes() (vols []*LogicalVolume) {
+	vols = make([]*LogicalVolume, 0, len(inv.AllLogicalVolumes))
+
+	for _, vol := range inv.AllLogicalVolumes {
+		if isHiddenLv(vol.LvName) {
+			continue
+		}
+
+		vols = append(vols, vol)
+	}
+
+	return
+}
+
+// LogicalVolume retrieves a visible logical volume either by
+// its `lv_name` or by `vg_name/lv_name`. Bare names that exist
+// in more than one volume group are reported as ambiguous.
+func (inv *Inventory) LogicalVolume(name string) (vol *LogicalVolume, err error) {
+	q, err := ParseLvQueryName(name)
+	if err != nil {
+		return
+	}
+
+	vol, err = singleLogicalVolume(name, inv.FindLogicalVolumes(q))
+	return
+}
+
+// FindLogicalVolumes lists the visible logical volumes that
+// match a query.
+func (inv *Inventory) FindLogicalVolumes(q LvQuery) (vols []*LogicalVolume) {
+	vols = make([]*LogicalVolume, 0)
+
+	for _, vol := range inv.LogicalVolumes() {
+		if q.Matches(vol) {
+			vols = append(vols, vol)
+		}
+	}
+
+	return
+}
+
+// ThinPool retrieves a thin pool either by its `lv_name` or by
+// `vg_name/lv_name`, erroring if there's none.
+func (inv *Inventory) ThinPool(name string) (pool *LogicalVolume, err error) {
+	var attr *LvAttr
+
+	pool, err = inv.LogicalVolume(name)
+	if err != nil {
+		return
+	}
+
+	if pool == nil {
+		err = errors.Errorf("thin pool %s not found", name)
+		return
+	}
+
+	attr, err = ParseLvAttr(pool.LvAttr)
+	if err != nil {
+		return
+	}
+
+	if !attr.IsThinPool() {
+		err = errors.Errorf("volume %s is not a thin pool", name)
+		pool = nil
+		return
+	}
+
+	return
+}
+
+// VolumeGroup retrieves a volume group by its name.
+func (inv *Inventory) VolumeGroup(name string) *VolumeGroup {
+	for _, vg := range inv.VolumeGroups {
+		if vg.Name == name {
+			return vg
+		}
+	}
+
+	return nil
+}
+
+// PhysicalVolume retrieves a physical volume by its device
+// path.
+func (inv *Inventory) PhysicalVolume(name string) *PhysicalVolume {
+	for _, pv := range inv.PhysicalVolumes {
+		if pv.PhysicalVolume == name {
+			return pv
+		}
+	}
+
+	return nil
+}
+
+// LogicalVolumesIn lists the visible logical volumes of a
+// volume group.
+func (inv *Inventory) LogicalVolumesIn(vgName string) (vols []*LogicalVolume) {
+	vols = make([]*LogicalVolume, 0)
+
+	for _, vol := range inv.LogicalVolumes() {
+		if vol.VgName == vgName {
+			vols = append(vols, vol)
+		}
+	}
+
+	return
+}
+
+// PhysicalVolumesIn lists the physical volumes that are
+// members of a volume group.
+func (inv *Inventory) PhysicalVolumesIn(vgName string) (pvs []*PhysicalVolume) {
+	pvs = make([]*PhysicalVolume, 0)
+
+	for _, pv := range inv.PhysicalVolumes {
+		if pv.VolumeGroup == vgName {
+			pvs = append(pvs, pv)
+		}
+	}
+
+	return
+}
+
+// SegmentsOf lists the segments of a logical volume.
+func (inv *Inventory) SegmentsOf(vol *LogicalVolume) (segs []*LogicalVolumeSegment) {
+	segs = make([]*LogicalVolumeSegment, 0)
+
+	for _, seg := range inv.Segments {
+		if seg.VgName == vol.VgName && seg.LvName == vol.LvName {
+			segs = append(segs, seg)
+		}
+	}
+
+	return
+}
+
+// PhysicalVolumesOf lists the physical volumes that back a
+// logical volume. See PhysicalVolumesOf.
+func (inv *Inventory) PhysicalVolumesOf(vol *LogicalVolume) ([]string, error) {
+	return PhysicalVolumesOf(inv.Segments, vol.VgName, vol.LvName)
+}
+
+// PhysicalVolumesAvoiding lists the physical volumes of the
+// volume group of 'vol' that don't back it. See
+// PhysicalVolumesAvoiding.
+func (inv *Inventory) PhysicalVolumesAvoiding(vol *LogicalVolume) ([]string, error) {
+	return PhysicalVolumesAvoiding(inv.PhysicalVolumes,
+		inv.Segments, vol.VgName, vol.LvName)
+}
@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// InventoryCacheStats summarizes how effective an
+// InventoryCache has been.
+type InventoryCacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// InventoryCache keeps the last Inventory gathered around
+// for a given TTL so that frequent read-only calls (like the
+// ones Docker does to 'Get', 'Path' and 'List') don't fork
+// LVM processes every time.
+// The inventories handed out are shared and must not be
+// modified.
+type InventoryCache struct {
+	ttl  time.Duration
+	load func() (*Inventory, error)
+	now  func() time.Time
+
+	inv       *Inventory
+	fetchedAt time.Time
+	stats     InventoryCacheStats
+
+	sync.Mutex
+}
+
+// NewInventoryCache instantiates a cache that keeps
+// inventories retrieved by 'load' for 'ttl'.
+func NewInventoryCache(ttl time.Duration, load func() (*Inventory, error)) (cache *InventoryCache, err error) {
+	if ttl <= 0 {
+		err = errors.Errorf("ttl must be positive")
+		return
+	}
+
+	if load == nil {
+		err = errors.Errorf("load must be specified")
+		return
+	}
+
+	cache = &InventoryCache{
+		ttl:  ttl,
+		load: load,
+		now:  time.Now,
+	}
+
+	return
+}
+
+// Get retrieves the cached inventory if it's still valid,
+// otherwise loading a new one. Setting 'fresh' forces the
+// inventory to be loaded (and cached) regardless of its
+// age.
+func (c *InventoryCache) Get(fresh bool) (inv *Inventory, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !fresh && c.inv != nil && c.now().Sub(c.fetchedAt) < c.ttl {
+		c.stats.Hits++
+		inv = c.inv
+		return
+	}
+
+	c.stats.Misses++
+
+	inv, err = c.load()
+	if err != nil {
+		c.inv = nil
+		return
+	}
+
+	c.inv = inv
+	c.fetchedAt = c.now()
+	return
+}
+
+// Invalidate drops the cached inventory such that the next
+// retrieval loads a new one.
+func (c *InventoryCache) Invalidate() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.inv = nil
+}
+
+// Stats returns the number of hits and misses so far.
+func (c *InventoryCache) Stats() InventoryCacheStats {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.stats
+}
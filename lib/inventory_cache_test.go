@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInventoryCache(t *testing.T) {
+	var load = func() (*Inventory, error) { return new(Inventory), nil }
+
+	_, err := NewInventoryCache(0, load)
+	assert.Error(t, err)
+
+	_, err = NewInventoryCache(time.Second, nil)
+	assert.Error(t, err)
+
+	_, err = NewInventoryCache(time.Second, load)
+	assert.NoError(t, err)
+}
+
+func TestInventoryCache(t *testing.T) {
+	var (
+		loads   int
+		failing bool
+		now     = time.Unix(0, 0)
+	)
+
+	cache, err := NewInventoryCache(5*time.Second, func() (*Inventory, error) {
+		loads++
+		if failing {
+			return nil, errors.Errorf("failed")
+		}
+
+		return new(Inventory), nil
+	})
+	require.NoError(t, err)
+	cache.now = func() time.Time { return now }
+
+	first, err := cache.Get(false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, loads)
+
+	second, err := cache.Get(false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, loads)
+	assert.True(t, first == second)
+
+	now = now.Add(5 * time.Second)
+	_, err = cache.Get(false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loads)
+
+	_, err = cache.Get(true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, loads)
+
+	cache.Invalidate()
+	_, err = cache.Get(false)
+	require.NoError(t, err)
+	assert.Equal(t, 4, loads)
+
+	failing = true
+	cache.Invalidate()
+	_, err = cache.Get(false)
+	assert.Error(t, err)
+
+	failing = false
+	_, err = cache.Get(false)
+	require.NoError(t, err)
+	assert.Equal(t, 6, loads)
+
+	assert.Equal(t, InventoryCacheStats{Hits: 1, Misses: 6}, cache.Stats())
+}
@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadInventory(t *testing.T) *Inventory {
+	output, err := ioutil.ReadFile("testdata/2.03.11/fullreport.json")
+	require.NoError(t, err)
+
+	inv, err := DecodeFullReportResponse(output)
+	require.NoError(t, err)
+
+	return inv
+}
+
+func mustGetLogicalVolume(t *testing.T, inv *Inventory, name string) *LogicalVolume {
+	vol, err := inv.LogicalVolume(name)
+	require.NoError(t, err)
+	require.NotNil(t, vol)
+
+	return vol
+}
+
+func TestDecodeFullReportResponse(t *testing.T) {
+	var inv = loadInventory(t)
+
+	assert.Len(t, inv.VolumeGroups, 1)
+	assert.Len(t, inv.PhysicalVolumes, 3)
+	assert.Len(t, inv.AllLogicalVolumes, 4)
+	assert.Len(t, inv.Segments, 4)
+
+	_, err := DecodeFullReportResponse(nil)
+	assert.Error(t, err)
+
+	_, err = DecodeFullReportResponse([]byte(""))
+	assert.Error(t, err)
+}
+
+func TestInventoryLookups(t *testing.T) {
+	var inv = loadInventory(t)
+
+	vols := inv.LogicalVolumes()
+	require.Len(t, vols, 2)
+	assert.Equal(t, "lv1", vols[0].LvName)
+	assert.Equal(t, "mirror", vols[1].LvName)
+
+	assert.Equal(t, "mirror", mustGetLogicalVolume(t, inv, "mirror").LvName)
+	assert.Equal(t, "mirror", mustGetLogicalVolume(t, inv, "myvg/mirror").LvName)
+
+	for _, name := range []string{"[mirror_rimage_0]", "inexistent", "othervg/mirror"} {
+		vol, err := inv.LogicalVolume(name)
+		assert.NoError(t, err)
+		assert.Nil(t, vol)
+	}
+
+	_, err := inv.LogicalVolume("a/b/c")
+	assert.Error(t, err)
+
+	vg := inv.VolumeGroup("myvg")
+	require.NotNil(t, vg)
+	assert.Equal(t, Count(2), vg.PvCount)
+	assert.Nil(t, inv.VolumeGroup("inexistent"))
+
+	orphan := inv.PhysicalVolume("/dev/loop2")
+	require.NotNil(t, orphan)
+	assert.Equal(t, "", orphan.VolumeGroup)
+
+	assert.Len(t, inv.PhysicalVolumesIn("myvg"), 2)
+	assert.Len(t, inv.LogicalVolumesIn("myvg"), 2)
+	assert.Len(t, inv.SegmentsOf(mustGetLogicalVolume(t, inv, "lv1")), 1)
+}
+
+func TestInventoryPhysicalVolumes(t *testing.T) {
+	var inv = loadInventory(t)
+
+	pvs, err := inv.PhysicalVolumesOf(mustGetLogicalVolume(t, inv, "mirror"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/loop0", "/dev/loop1"}, pvs)
+
+	pvs, err = inv.PhysicalVolumesAvoiding(mustGetLogicalVolume(t, inv, "lv1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/loop1"}, pvs)
+}
+
+func TestInventoryLogicalVolume_ambiguousNames(t *testing.T) {
+	var inv = &Inventory{
+		AllLogicalVolumes: []*LogicalVolume{
+			{LvName: "data", VgName: "vg0"},
+			{LvName: "data", VgName: "vg1"},
+		},
+	}
+
+	_, err := inv.LogicalVolume("data")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "vg0/data, vg1/data")
+
+	vol, err := inv.LogicalVolume("vg1/data")
+	require.NoError(t, err)
+	require.NotNil(t, vol)
+	assert.Equal(t, "vg1", vol.VgName)
+}
+
+func TestInventoryThinPool(t *testing.T) {
+	var inv = &Inventory{
+		AllLogicalVolumes: []*LogicalVolume{
+			{LvName: "pool", VgName: "vg0", LvAttr: "twi-aotz--"},
+			{LvName: "[pool_tdata]", VgName: "vg0", LvAttr: "Twi-ao----"},
+			{LvName: "thin", VgName: "vg0", LvAttr: "Vwi-a-tz--", PoolLv: "pool"},
+			{LvName: "pool", VgName: "vg1", LvAttr: "twi-a-tz--"},
+			{LvName: "other", VgName: "vg1", LvAttr: "twi-a-tz--"},
+		},
+	}
+
+	pool, err := inv.ThinPool("other")
+	require.NoError(t, err)
+	assert.Equal(t, "vg1", pool.VgName)
+
+	pool, err = inv.ThinPool("vg0/pool")
+	require.NoError(t, err)
+	assert.Equal(t, "vg0", pool.VgName)
+
+	for _, name := range []string{"pool", "thin", "inexistent", "[pool_tdata]"} {
+		_, err = inv.ThinPool(name)
+		assert.Error(t, err, name)
+	}
+}
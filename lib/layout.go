@@ -0,0 +1,268 @@
+package lib
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	LayoutRaid1  = "raid1"
+	LayoutRaid5  = "raid5"
+	LayoutRaid10 = "raid10"
+)
+
+var (
+	supportedLayoutTypes = map[string]bool{
+		LayoutRaid1:  true,
+		LayoutRaid5:  true,
+		LayoutRaid10: true,
+	}
+)
+
+// hasLayout indicates whether the configuration asks for
+// anything other than a plain linear volume.
+func hasLayout(cfg LvCreationConfig) bool {
+	return cfg.Type != "" ||
+		cfg.Stripes > 1 ||
+		cfg.StripeSize != "" ||
+		cfg.Mirrors > 0 ||
+		len(cfg.PhysicalVolumes) > 0
+}
+
+// effectiveStripes returns the number of stripes that lvm
+// would use for the given configuration, taking into account
+// the defaults that `lvcreate` applies to raid5 and raid10.
+func effectiveStripes(cfg LvCreationConfig) uint64 {
+	switch cfg.Type {
+	case LayoutRaid5, LayoutRaid10:
+		if cfg.Stripes == 0 {
+			return 2
+		}
+	}
+
+	if cfg.Stripes == 0 {
+		return 1
+	}
+
+	return cfg.Stripes
+}
+
+// effectiveMirrors returns the number of mirrors that lvm
+// would use for the given configuration.
+func effectiveMirrors(cfg LvCreationConfig) uint64 {
+	switch cfg.Type {
+	case LayoutRaid1, LayoutRaid10:
+		if cfg.Mirrors == 0 {
+			return 1
+		}
+	}
+
+	return cfg.Mirrors
+}
+
+// ValidateLayoutOptions verifies that the striping and raid
+// options of a creation configuration are consistent with
+// each other. It doesn't check them against a volume group,
+// for that, see ValidateLogicalVolumeLayout.
+func ValidateLayoutOptions(cfg LvCreationConfig) (err error) {
+	if !hasLayout(cfg) {
+		return
+	}
+
+	if cfg.Snapshot != "" || cfg.ThinPool != "" {
+		err = errors.Errorf(
+			"striping, raid and pv options can't be used " +
+				"with snapshots or thin volumes")
+		return
+	}
+
+	if cfg.Type != "" && !supportedLayoutTypes[cfg.Type] {
+		err = errors.Errorf(
+			"unsupported type %s - must be one of raid1, raid5 or raid10",
+			cfg.Type)
+		return
+	}
+
+	switch cfg.Type {
+	case LayoutRaid1:
+		if cfg.Stripes > 1 {
+			err = errors.Errorf("raid1 volumes can't be striped")
+			return
+		}
+	case LayoutRaid5:
+		if cfg.Mirrors > 0 {
+			err = errors.Errorf("raid5 volumes can't have mirrors")
+			return
+		}
+
+		if cfg.Stripes == 1 {
+			err = errors.Errorf("raid5 volumes require at least 2 stripes")
+			return
+		}
+	case LayoutRaid10:
+		if cfg.Stripes == 1 {
+			err = errors.Errorf("raid10 volumes require at least 2 stripes")
+			return
+		}
+	default:
+		if cfg.Mirrors > 0 {
+			err = errors.Errorf(
+				"mirrors can only be specified for raid1 and raid10")
+			return
+		}
+	}
+
+	if cfg.StripeSize != "" && effectiveStripes(cfg) < 2 {
+		err = errors.Errorf(
+			"stripesize requires at least 2 stripes")
+		return
+	}
+
+	return
+}
+
+// RequiredPhysicalVolumes computes the minimum number of
+// physical volumes that a volume group must have in order
+// to accomodate the layout of the volume being created.
+func RequiredPhysicalVolumes(cfg LvCreationConfig) uint64 {
+	var (
+		stripes = effectiveStripes(cfg)
+		mirrors = effectiveMirrors(cfg)
+	)
+
+	switch cfg.Type {
+	case LayoutRaid1:
+		return mirrors + 1
+	case LayoutRaid5:
+		return stripes + 1
+	case LayoutRaid10:
+		return stripes * (mirrors + 1)
+	}
+
+	return stripes
+}
+
+// ValidateLogicalVolumeLayout verifies whether the layout
+// requested by a creation configuration can be satisfied by
+// a given volume group.
+// 'pvs' is the list of physical volumes known to LVM. When
+// non-nil, the explicit list of physical volumes from the
+// configuration is checked against it to make sure that all
+// of them belong to the volume group.
+func ValidateLogicalVolumeLayout(cfg LvCreationConfig, vg *VolumeGroup, pvs []*PhysicalVolume) (err error) {
+	var (
+		required uint64
+		problems []string
+	)
+
+	if vg == nil {
+		err = errors.Errorf("vg must be non-nil")
+		return
+	}
+
+	err = ValidateLayoutOptions(cfg)
+	if err != nil {
+		return
+	}
+
+	problems, err = VolumeGroupProblems(vg)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't check volume group %s", vg.Name)
+		return
+	}
+
+	if len(problems) > 0 {
+		err = errors.Errorf(
+			"volume group %s can't receive new volumes: %s",
+			vg.Name, strings.Join(problems, ", "))
+		return
+	}
+
+	required = RequiredPhysicalVolumes(cfg)
+	if uint64(vg.PvCount) < required {
+		err = errors.Errorf(
+			"volume group %s has %d physical volumes but the "+
+				"requested layout needs at least %d",
+			vg.Name, vg.PvCount, required)
+		return
+	}
+
+	if len(cfg.PhysicalVolumes) == 0 {
+		return
+	}
+
+	if uint64(len(cfg.PhysicalVolumes)) < required {
+		err = errors.Errorf(
+			"%d physical volumes specified but the "+
+				"requested layout needs at least %d",
+			len(cfg.PhysicalVolumes), required)
+		return
+	}
+
+	if pvs == nil {
+		return
+	}
+
+	var members = make(map[string]*PhysicalVolume)
+
+	for _, pv := range pvs {
+		if pv.VolumeGroup == vg.Name {
+			members[pv.PhysicalVolume] = pv
+		}
+	}
+
+	for _, pv := range cfg.PhysicalVolumes {
+		if members[pv] == nil {
+			err = errors.Errorf(
+				"physical volume %s doesn't belong to volume group %s",
+				pv, vg.Name)
+			return
+		}
+
+		problems, err = PhysicalVolumeProblems(members[pv])
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't check physical volume %s", pv)
+			return
+		}
+
+		if len(problems) > 0 {
+			err = errors.Errorf(
+				"physical volume %s can't be allocated from: %s",
+				pv, strings.Join(problems, ", "))
+			return
+		}
+	}
+
+	return
+}
+
+// buildLayoutArgs builds the portion of the 'lvcreate'
+// arguments that define the type, striping and mirroring
+// of a volume.
+func buildLayoutArgs(cfg LvCreationConfig) (args []string) {
+	args = []string{}
+
+	if cfg.Type != "" {
+		args = append(args, "--type", cfg.Type)
+	}
+
+	if cfg.Type == LayoutRaid1 || cfg.Type == LayoutRaid10 {
+		args = append(args, "--mirrors",
+			strconv.FormatUint(effectiveMirrors(cfg), 10))
+	}
+
+	if cfg.Stripes > 1 {
+		args = append(args, "--stripes",
+			strconv.FormatUint(cfg.Stripes, 10))
+	}
+
+	if cfg.StripeSize != "" {
+		args = append(args, "--stripesize", cfg.StripeSize)
+	}
+
+	return
+}
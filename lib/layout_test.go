@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredPhysicalVolumes(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		cfg      LvCreationConfig
+		expected uint64
+	}{
+		{
+			desc:     "linear needs a single pv",
+			cfg:      LvCreationConfig{},
+			expected: 1,
+		},
+		{
+			desc:     "striped needs one pv per stripe",
+			cfg:      LvCreationConfig{Stripes: 3},
+			expected: 3,
+		},
+		{
+			desc:     "raid1 needs mirrors + 1",
+			cfg:      LvCreationConfig{Type: "raid1", Mirrors: 2},
+			expected: 3,
+		},
+		{
+			desc:     "raid5 defaults to 2 stripes plus parity",
+			cfg:      LvCreationConfig{Type: "raid5"},
+			expected: 3,
+		},
+		{
+			desc:     "raid10 needs stripes * (mirrors + 1)",
+			cfg:      LvCreationConfig{Type: "raid10", Stripes: 3},
+			expected: 6,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, RequiredPhysicalVolumes(tc.cfg))
+		})
+	}
+}
+
+func TestValidateLogicalVolumeLayout(t *testing.T) {
+	var (
+		vg = &VolumeGroup{
+			Name:    "vg1",
+			PvCount: 2,
+		}
+		pvs = []*PhysicalVolume{
+			{PhysicalVolume: "/dev/sdb", VolumeGroup: "vg1"},
+			{PhysicalVolume: "/dev/sdc", VolumeGroup: "vg1"},
+			{PhysicalVolume: "/dev/sdd", VolumeGroup: "vg2"},
+			{PhysicalVolume: "/dev/sde", VolumeGroup: "vg1", Attr: "u--"},
+		}
+	)
+
+	var testCases = []struct {
+		desc        string
+		cfg         LvCreationConfig
+		vg          *VolumeGroup
+		shouldError bool
+	}{
+		{
+			desc:        "nil vg should fail",
+			cfg:         LvCreationConfig{},
+			vg:          nil,
+			shouldError: true,
+		},
+		{
+			desc:        "linear fits",
+			cfg:         LvCreationConfig{},
+			vg:          vg,
+			shouldError: false,
+		},
+		{
+			desc:        "raid1 fits with two pvs",
+			cfg:         LvCreationConfig{Type: "raid1"},
+			vg:          vg,
+			shouldError: false,
+		},
+		{
+			desc:        "raid5 doesn't fit with two pvs",
+			cfg:         LvCreationConfig{Type: "raid5"},
+			vg:          vg,
+			shouldError: true,
+		},
+		{
+			desc: "not enough pvs listed should fail",
+			cfg: LvCreationConfig{
+				Stripes:         2,
+				PhysicalVolumes: []string{"/dev/sdb"},
+			},
+			vg:          vg,
+			shouldError: true,
+		},
+		{
+			desc: "pv from another vg should fail",
+			cfg: LvCreationConfig{
+				PhysicalVolumes: []string{"/dev/sdd"},
+			},
+			vg:          vg,
+			shouldError: true,
+		},
+		{
+			desc: "non-allocatable pv should fail",
+			cfg: LvCreationConfig{
+				PhysicalVolumes: []string{"/dev/sde"},
+			},
+			vg:          vg,
+			shouldError: true,
+		},
+		{
+			desc: "partial vg should fail",
+			cfg:  LvCreationConfig{},
+			vg: &VolumeGroup{
+				Name:    "vg1",
+				Attr:    "wz-pn-",
+				PvCount: 2,
+			},
+			shouldError: true,
+		},
+		{
+			desc: "pvs from the vg work",
+			cfg: LvCreationConfig{
+				Stripes:         2,
+				PhysicalVolumes: []string{"/dev/sdb", "/dev/sdc"},
+			},
+			vg:          vg,
+			shouldError: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := ValidateLogicalVolumeLayout(tc.cfg, tc.vg, pvs)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
@@ -2,11 +2,10 @@ package lib
 
 import (
 	"os"
-	"os/exec"
-	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
 )
 
 // NewLvm instantiates a new LVm controller instance.
@@ -15,169 +14,298 @@ func NewLvm(cfg LvmConfig) (l Lvm, err error) {
 		Str("from", "lvm").
 		Logger()
 
+	l.runner = cfg.Runner
+	if l.runner == nil {
+		l.runner = ExecRunner{}
+	}
+
+	l.freezer = IoctlFreezer{}
+
+	l.mountInfoFile = cfg.MountInfoFile
+	if l.mountInfoFile == "" {
+		l.mountInfoFile = "/proc/self/mountinfo"
+	}
+
+	err = validateReportFormat(cfg.ReportFormat)
+	if err != nil {
+		return
+	}
+
+	switch cfg.ReportFormat {
+	case "":
+		l.reportFormat = ReportFormatJson
+	case ReportFormatAuto:
+		l.reportFormat = l.DetectReportFormat()
+	default:
+		l.reportFormat = cfg.ReportFormat
+	}
+
+	if cfg.InventoryTTL > 0 {
+		l.cache, err = NewInventoryCache(cfg.InventoryTTL, l.loadInventory)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't create inventory cache")
+			return
+		}
+	}
+
+	l.logger.Debug().
+		Str("report-format", l.reportFormat).
+		Msg("lvm helper initialized")
+
 	return
 }
 
-// GetLogicalVolume retrieves a single logical volume
-// by its `lv_name`.
-// Note.:	if the same `lv_name` exists in two volume groups,
-//		the first found is returned.
+// ReportFormat returns the report format used when listing
+// volumes.
+func (l Lvm) ReportFormat() string {
+	return l.reportFormat
+}
+
+// GetLogicalVolume retrieves a single logical volume either
+// by its `lv_name` or by `vg_name/lv_name`.
+// If the bare `lv_name` exists in more than one volume group,
+// an error is returned. If no volume is found, a nil volume
+// is returned with no errors.
 func (l Lvm) GetLogicalVolume(name string) (vol *LogicalVolume, err error) {
-	vols, err := l.ListLogicalVolumes()
+	var (
+		q    LvQuery
+		vols []*LogicalVolume
+	)
+
+	q, err = ParseLvQueryName(name)
+	if err != nil {
+		return
+	}
+
+	vols, err = l.FindLogicalVolumes(q)
 	if err != nil {
 		err = errors.Wrapf(err,
-			"couldn't list logical volumes")
+			"couldn't look up volume %s", name)
 		return
 	}
 
-	for _, vol = range vols {
-		if vol.LvName != name {
-			continue
+	vol, err = singleLogicalVolume(name, vols)
+	return
+}
+
+// FindLogicalVolumes retrieves the (visible) logical volumes
+// that match a query. If caching is enabled, the query is
+// evaluated against the cached inventory, otherwise lvm is
+// asked to do the selection.
+func (l Lvm) FindLogicalVolumes(q LvQuery) (vols []*LogicalVolume, err error) {
+	var selection string
+
+	if l.cache != nil {
+		var inv *Inventory
+
+		inv, err = l.cache.Get(false)
+		if err != nil {
+			return
 		}
 
+		vols = inv.FindLogicalVolumes(q)
 		return
 	}
 
-	vol = nil
+	selection, err = q.Select()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't compile query")
+		return
+	}
+
+	vols, err = l.listLogicalVolumes(selection)
 	return
 }
 
-// ListPhysicalVolumes gathers a list of all the physical
-// volumes that can be found by the LVM controller.
-// It parses the output from the `pvs` command and returns
-// a list of PhysicalVolume structs.
-func (l Lvm) ListPhysicalVolumes() (vols []*PhysicalVolume, err error) {
+// GetInventory retrieves the inventory of physical volumes,
+// volume groups, logical volumes and segments. If caching is
+// enabled, a cached inventory might be returned.
+func (l Lvm) GetInventory() (inv *Inventory, err error) {
+	if l.cache == nil {
+		return l.loadInventory()
+	}
+
+	return l.cache.Get(false)
+}
+
+// GetFreshInventory retrieves the inventory bypassing the
+// cache. The inventory retrieved replaces the cached one.
+func (l Lvm) GetFreshInventory() (inv *Inventory, err error) {
+	if l.cache == nil {
+		return l.loadInventory()
+	}
+
+	return l.cache.Get(true)
+}
+
+// InvalidateInventory drops the cached inventory (if any).
+func (l Lvm) InvalidateInventory() {
+	if l.cache == nil {
+		return
+	}
+
+	l.cache.Invalidate()
+}
+
+// InventoryStats returns the hits and misses of the
+// inventory cache. Without caching, both are zero.
+func (l Lvm) InventoryStats() (stats InventoryCacheStats) {
+	if l.cache == nil {
+		return
+	}
+
+	return l.cache.Stats()
+}
+
+// loadInventory gathers physical volumes, volume groups,
+// logical volumes (including hidden ones) and their segments
+// from a single 'lvm fullreport' execution.
+func (l Lvm) loadInventory() (inv *Inventory, err error) {
 	var output []byte
 
 	l.logger.Debug().
-		Msg("listing physical volumes")
+		Msg("retrieving inventory")
 
-	output, err = l.Run("pvs",
-		"--units=m",
+	output, err = l.Run("lvm", "fullreport",
+		"--units=b",
 		"--nosuffix",
 		"--noheadings",
-		"--report-format=json")
+		"--configreport", "vg", reportOptions(&[]*VolumeGroup{}),
+		"--configreport", "pv", reportOptions(&[]*PhysicalVolume{}),
+		"--configreport", "lv", reportOptions(&[]*LogicalVolume{}),
+		"--configreport", "seg", reportOptions(&[]*LogicalVolumeSegment{}),
+		"--configreport", "pvseg", "--options=pvseg_start",
+		"--report-format="+l.reportFormat)
 	if err != nil {
 		err = errors.Wrapf(err,
-			"failed to retrieve physical volumes")
+			"failed to retrieve lvm fullreport")
 		return
 	}
 
-	vols, err = DecodePhysicalVolumesResponse(output)
+	inv, err = DecodeFullReportResponse(output)
 	if err != nil {
 		err = errors.Wrapf(err,
-			"failed to decode physical volumes response")
+			"failed to decode fullreport response")
 		return
 	}
 
 	return
 }
 
+// ListPhysicalVolumes gathers a list of all the physical
+// volumes that can be found by the LVM controller.
+// It parses the output from the `pvs` command and returns
+// a list of PhysicalVolume structs.
+func (l Lvm) ListPhysicalVolumes() (vols []*PhysicalVolume, err error) {
+	l.logger.Debug().
+		Msg("listing physical volumes")
+
+	err = l.Report(ReportPhysicalVolumes, "", &vols)
+	return
+}
+
 // ListVolumeGroups lists all groups that can be reached
 // by the LVM controller. As a result it parses the response
 // of the 'vgs' command and returns a list of VolumeGroup structs.
 func (l Lvm) ListVolumeGroups() (vols []*VolumeGroup, err error) {
-	var output []byte
-
 	l.logger.Debug().
 		Msg("listing volume groups")
 
-	output, err = l.Run("vgs",
-		"--units=m",
-		"--nosuffix",
-		"--noheadings",
-		"--report-format=json")
+	err = l.Report(ReportVolumeGroups, "", &vols)
+	return
+}
+
+// FormatDevice format a `device` with a filesystem of
+// a particular `fstype` using the formatter registered for it
+// (see GetFormatter) with the tuning options provided.
+func (l Lvm) FormatDevice(device, fsType string, opts FormatOptions) (err error) {
+	var (
+		formatter Formatter
+		argv      []string
+	)
+
+	formatter, err = GetFormatter(fsType)
 	if err != nil {
-		err = errors.Wrapf(err,
-			"failed to retrieve volume groups")
 		return
 	}
 
-	vols, err = DecodeVolumeGroupsResponse(output)
+	argv, err = formatter.Args(device, opts)
 	if err != nil {
 		err = errors.Wrapf(err,
-			"failed to devoce volume groups response")
+			"couldn't build args for formatting device")
 		return
 	}
 
+	if len(argv) == 0 {
+		return
+	}
+
+	_, err = l.Run(argv[0], argv[1:]...)
 	return
 }
 
-// FormatDevice format a `device` with a filesystem of
-// a particular `fstype`.
-// Allowed `fsType`s are:
-//	-	ext4
-//	-	xfs
-func (l Lvm) FormatDevice(device, fsType string) (err error) {
-	var args []string
-
-	args, err = BuildMakeFsArgs(fsType, device)
+// DeviceSignature probes the superblock of 'device' (see
+// ProbeDevice), logging what it finds.
+func (l Lvm) DeviceSignature(device string) (sig *FsSignature, err error) {
+	sig, err = ProbeDevice(device)
 	if err != nil {
-		err = errors.Wrapf(err,
-			"couldn't build args for formatting device")
 		return
 	}
 
-	_, err = l.Run("mkfs", args...)
+	if sig != nil {
+		l.logger.Debug().
+			Str("device", device).
+			Str("type", sig.Type).
+			Str("uuid", sig.UUID).
+			Str("label", sig.Label).
+			Msg("found filesystem signature")
+	}
+
 	return
 }
 
 // IsDeviceFormatted checks whether a given `device`
-// is already formatted with a filesystem.
+// already holds a filesystem (or any other known signature,
+// like LUKS or swap) by probing its superblock.
 func (l Lvm) IsDeviceFormatted(device string) (isFormatted bool, err error) {
-	var response []byte
+	var sig *FsSignature
 
-	args, err := BuildGetDeviceFormatArgs(device)
+	sig, err = l.DeviceSignature(device)
 	if err != nil {
 		return
 	}
 
-	response, err = l.Run("lsblk", args...)
-	if err != nil {
-		return
-	}
-
-	isFormatted = string(response) == ""
+	isFormatted = sig != nil
 	return
 }
 
 // ListLogicalVolumes retrieves a list of LogicalVolume structs
 // from the result of parsing the response of the 'lvs' command.
 func (l Lvm) ListLogicalVolumes() (vols []*LogicalVolume, err error) {
-	var output []byte
+	return l.listLogicalVolumes("")
+}
 
+// listLogicalVolumes runs 'lvs', restricting the volumes
+// reported to the ones matching 'selection' if not empty.
+func (l Lvm) listLogicalVolumes(selection string) (vols []*LogicalVolume, err error) {
 	l.logger.Debug().
+		Str("select", selection).
 		Msg("retrieving logical volumes")
 
-	output, err = l.Run("lvs",
-		"--units=m",
-		"--nosuffix",
-		"--noheadings",
-		"--options=lv_all",
-		"--report-format=json")
-	if err != nil {
-		err = errors.Wrapf(err,
-			"failed to retrieve logical volumes")
-		return
-	}
-
-	vols, err = DecodeLogicalVolumesResponse(output)
-	if err != nil {
-		err = errors.Wrapf(err,
-			"failed to devoce logical volumes response")
-		return
-	}
+	err = l.Report(ReportLogicalVolumes, selection, &vols)
+	return
+}
 
-	for _, vol := range vols {
-		if vol.VgName == "" && vol.LvFullName != "" {
-			parts := strings.SplitN(vol.LvFullName, "/", 2)
-			if len(parts) != 2 {
-				continue
-			}
-			vol.VgName = parts[0]
-		}
-	}
+// ListLogicalVolumeSegments retrieves the segments of all the
+// logical volumes (including hidden ones like raid images) from
+// the result of parsing the response of 'lvs --segments'.
+func (l Lvm) ListLogicalVolumeSegments() (segs []*LogicalVolumeSegment, err error) {
+	l.logger.Debug().
+		Msg("retrieving logical volume segments")
 
+	err = l.Report(ReportLogicalVolumeSegments, "", &segs)
 	return
 }
 
@@ -216,7 +344,7 @@ func (l Lvm) LuksClose(vol *LogicalVolume) (err error) {
 
 	var args = []string{
 		"luksClose",
-		"luks-" + vol.LvName,
+		LuksMappingName(vol),
 	}
 
 	_, err = l.Run("cryptsetup", args...)
@@ -261,32 +389,79 @@ func (l Lvm) LuksOpen(key string, vol *LogicalVolume) (err error) {
 		"--key-file=" + key,
 		"luksOpen",
 		vol.LvDmPath,
-		"luks-" + vol.LvName,
+		LuksMappingName(vol),
 	}
 
 	_, err = l.Run("cryptsetup", args...)
 	return
 }
 
-// Mount runs the 'mount' command with the arguments provided.
-func (l Lvm) Mount(device, location string) (err error) {
+// Mount mounts the filesystem of 'device' at 'location'
+// using mount(2) with the options provided.
+func (l Lvm) Mount(device, location string, opts MountOptions) (err error) {
 	if device == "" || location == "" {
 		err = errors.Errorf("device and location must be non-empty")
 		return
 	}
 
-	_, err = l.Run("mount", device, location)
+	if opts.FsType == "" {
+		err = errors.Errorf("a fs type must be specified")
+		return
+	}
+
+	l.logger.Debug().
+		Str("device", device).
+		Str("location", location).
+		Str("fstype", opts.FsType).
+		Str("options", opts.String()).
+		Msg("mounting")
+
+	err = unix.Mount(device, location, opts.FsType,
+		opts.MountFlags(), opts.MountData())
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to mount %s at %s with options '%s'",
+			device, location, opts)
+		return
+	}
+
 	return
 }
 
-// Unmount runs the 'umount' command with the arguments provided.
-func (l Lvm) Unmount(location string) (err error) {
+// Unmount unmounts the filesystem mounted at 'location'
+// using umount2(2). If the filesystem is busy, the unmount
+// is retried with the flags that 'policy' allows.
+func (l Lvm) Unmount(location string, policy UnmountPolicy) (err error) {
 	if location == "" {
 		err = errors.Errorf("location can't be empty")
 		return
 	}
 
-	_, err = l.Run("umount", location)
+	l.logger.Debug().
+		Str("location", location).
+		Str("policy", string(policy)).
+		Msg("unmounting")
+
+	err = unix.Unmount(location, 0)
+	if err == unix.EBUSY {
+		flags, allowed := policy.flags()
+		if allowed {
+			l.logger.Warn().
+				Str("location", location).
+				Str("policy", string(policy)).
+				Msg("filesystem busy - retrying unmount")
+
+			err = unix.Unmount(location, flags)
+		}
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to unmount %s (policy %s)",
+			location, policy)
+		return
+	}
+
 	return
 }
 
@@ -302,6 +477,7 @@ func (l Lvm) RemoveLv(cfg LvRemovalConfig) (err error) {
 	}
 
 	_, err = l.Run("lvremove", args...)
+	l.InvalidateInventory()
 	return
 }
 
@@ -317,39 +493,76 @@ func (l Lvm) CreateLv(cfg LvCreationConfig) (err error) {
 	}
 
 	_, err = l.Run("lvcreate", args...)
+	l.InvalidateInventory()
 	return
 }
 
 // GetVolumeMountInfo retrieve volume mounting information
-// about a specific volume.
+// about a specific volume (`lv_name` or `vg_name/lv_name`).
+// Mounts of the volume's luks mapping count as mounts of
+// the volume.
 // If it's not mounted, a nil MountInfo is returned with no
-// errors.
+// errors. If it's mounted in more than one location, the
+// first mount is returned.
 func (l Lvm) GetVolumeMountInfo(name string) (info *MountInfo, err error) {
+	var (
+		vol     *LogicalVolume
+		devices []DeviceNumber
+		table   *MountTable
+		mounts  []*MountInfo
+	)
+
+	vol, err = l.GetLogicalVolume(name)
+	if err != nil {
+		return
+	}
+
+	if vol == nil {
+		err = errors.Errorf("volume %s not found", name)
+		return
+	}
+
+	// inactive volumes have no device to be mounted
+	attr, attrErr := ParseLvAttr(vol.LvAttr)
+	if attrErr == nil && !attr.IsActive() {
+		return
+	}
+
+	devices, err = l.VolumeDeviceNumbers(vol)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't retrieve device numbers of volume %s",
+			name)
+		return
+	}
+
+	table, err = l.GetMountTable()
+	if err != nil {
+		return
+	}
+
+	mounts = table.OfDevices(devices)
+	if len(mounts) > 0 {
+		info = mounts[0]
+	}
+
 	return
 }
 
-// run executes a given command whose executable
-// is 'name' and whose arguments are 'args'.
-// The executed command inherits the parent environment
-// with the addition of LC_NUMERIC set to en_US.UTF-8 in
-// order to prevent the use of commas as the floating point
-// separator.
+// Run executes a given command whose executable is 'name'
+// and whose arguments are 'args' using the configured
+// Runner.
+// Sizes are always requested in bytes (`--units=b`) so
+// that the output doesn't depend on the locale.
 func (l Lvm) Run(name string, args ...string) (out []byte, err error) {
 	l.logger.Debug().
 		Str("cmd", name).
 		Strs("args", args).
 		Msg("executing command")
 
-	cmd := exec.Command(name, args...)
-	cmd.Env = append(os.Environ(), "LC_NUMERIC=en_US.UTF-8")
-
-	out, err = cmd.CombinedOutput()
-	if err != nil {
-		err = errors.Wrapf(err,
-			"failed to execute command '%s' with args '%+v'. Output:\n%s\n",
-			name, args, string(out))
-		return
+	if l.runner == nil {
+		return ExecRunner{}.Run(name, args...)
 	}
 
-	return
+	return l.runner.Run(name, args...)
 }
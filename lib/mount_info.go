@@ -3,11 +3,54 @@ package lib
 import (
 	"bufio"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
+// UnescapeMountField decodes the octal escapes (e.g., '\040'
+// for a space) that the kernel uses in the path fields of
+// mounts and mountinfo files.
+func UnescapeMountField(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+
+	var buf = make([]byte, 0, len(field))
+
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) && isOctalEscape(field[i+1:i+4]) {
+			value, _ := strconv.ParseUint(field[i+1:i+4], 8, 8)
+			buf = append(buf, byte(value))
+			i += 3
+			continue
+		}
+
+		buf = append(buf, field[i])
+	}
+
+	return string(buf)
+}
+
+// isOctalEscape checks whether the three characters that
+// follow a backslash form a valid octal byte.
+func isOctalEscape(digits string) bool {
+	if len(digits) != 3 || digits[0] > '3' {
+		return false
+	}
+
+	for _, c := range []byte(digits) {
+		if c < '0' || c > '7' {
+			return false
+		}
+	}
+
+	return true
+}
+
 // ParseMountLine parses a line from /proc/mounts
 // and returns a *MountInfo struct.
 func ParseMountLine(line string) (info *MountInfo, err error) {
@@ -25,15 +68,159 @@ func ParseMountLine(line string) (info *MountInfo, err error) {
 	}
 
 	info = &MountInfo{
-		Device:   parts[0],
-		Location: parts[1],
+		Device:   UnescapeMountField(parts[0]),
+		Location: UnescapeMountField(parts[1]),
 		Format:   parts[2],
 		Options:  parts[3],
 	}
 	return
 }
 
+// ParseMountInfoLine parses a line from /proc/<pid>/mountinfo
+// and returns a *MountInfo struct. Lines look like:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+// where the fields before the '-' separator are the mount id,
+// the parent id, the major:minor of the device, the root of
+// the mount, the mount point, the mount options and zero or
+// more optional fields; after it come the filesystem type,
+// the mount source and the super block options.
+func ParseMountInfoLine(line string) (info *MountInfo, err error) {
+	var (
+		parts     []string
+		separator = -1
+		numbers   []string
+		value     uint64
+	)
+
+	if line == "" {
+		err = errors.Errorf("can't parse empty line")
+		return
+	}
+
+	parts = strings.Fields(line)
+	for ndx, part := range parts {
+		if ndx >= 6 && part == "-" {
+			separator = ndx
+			break
+		}
+	}
+
+	if separator == -1 || len(parts) < separator+3 {
+		err = errors.Errorf("not enough info in mountinfo line")
+		return
+	}
+
+	info = &MountInfo{
+		Root:           UnescapeMountField(parts[3]),
+		Location:       UnescapeMountField(parts[4]),
+		Options:        parts[5],
+		OptionalFields: parts[6:separator],
+		Format:         parts[separator+1],
+		Device:         UnescapeMountField(parts[separator+2]),
+	}
+
+	if len(parts) > separator+3 {
+		info.SuperOptions = parts[separator+3]
+	}
+
+	info.MountId, err = strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed mount id %s", parts[0])
+		return
+	}
+
+	info.ParentId, err = strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed parent id %s", parts[1])
+		return
+	}
+
+	numbers = strings.Split(parts[2], ":")
+	if len(numbers) != 2 {
+		err = errors.Errorf("malformed device numbers %s", parts[2])
+		return
+	}
+
+	value, err = strconv.ParseUint(numbers[0], 10, 32)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed major %s", numbers[0])
+		return
+	}
+	info.Major = uint32(value)
+
+	value, err = strconv.ParseUint(numbers[1], 10, 32)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed minor %s", numbers[1])
+		return
+	}
+	info.Minor = uint32(value)
+
+	return
+}
+
+// ParseMountInfoFile parses a mountinfo file (e.g.,
+// /proc/self/mountinfo).
+func ParseMountInfoFile(filename string) (infos []*MountInfo, err error) {
+	return parseMountsFile(filename, ParseMountInfoLine)
+}
+
+// DeviceNumbers retrieves the major and minor numbers of a
+// block device (following symlinks like the ones under
+// /dev/mapper).
+func DeviceNumbers(device string) (major, minor uint32, err error) {
+	var stat unix.Stat_t
+
+	err = unix.Stat(device, &stat)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't stat device %s", device)
+		return
+	}
+
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		err = errors.Errorf("%s is not a block device", device)
+		return
+	}
+
+	major = unix.Major(uint64(stat.Rdev))
+	minor = unix.Minor(uint64(stat.Rdev))
+	return
+}
+
+// FindMountsOfDevice filters the mounts whose device numbers
+// match 'major:minor'. If 'location' is non-empty, only
+// mounts at that location are kept.
+func FindMountsOfDevice(infos []*MountInfo, major, minor uint32, location string) (found []*MountInfo) {
+	found = make([]*MountInfo, 0)
+
+	if location != "" {
+		location = filepath.Clean(location)
+	}
+
+	for _, info := range infos {
+		if info.Major != major || info.Minor != minor {
+			continue
+		}
+
+		if location != "" && filepath.Clean(info.Location) != location {
+			continue
+		}
+
+		found = append(found, info)
+	}
+
+	return
+}
+
+// ParseMountsFile parses a mounts file (e.g., /proc/mounts).
 func ParseMountsFile(filename string) (infos []*MountInfo, err error) {
+	return parseMountsFile(filename, ParseMountLine)
+}
+
+// parseMountsFile parses each of the lines of 'filename' with
+// a given line parser.
+func parseMountsFile(filename string, parse func(string) (*MountInfo, error)) (infos []*MountInfo, err error) {
 	var (
 		line string
 		file *os.File
@@ -58,7 +245,7 @@ func ParseMountsFile(filename string) (infos []*MountInfo, err error) {
 			continue
 		}
 
-		info, err = ParseMountLine(line)
+		info, err = parse(line)
 		if err != nil {
 			err = errors.Wrapf(err,
 				"failed to parse line '%s' from mounts file %s",
@@ -123,3 +123,168 @@ efivarfs /sys/firmware/efi/efivars efivarfs rw,nosuid,nodev,noexec,relatime 0 0
 	assert.Equal(t, "proc", infos[0].Device)
 	assert.Equal(t, "efivarfs", infos[5].Device)
 }
+
+func TestUnescapeMountField(t *testing.T) {
+	var testCases = []struct {
+		input    string
+		expected string
+	}{
+		{"/mnt/abc", "/mnt/abc"},
+		{`/mnt/with\040space`, "/mnt/with space"},
+		{`/mnt/tab\011and\012newline`, "/mnt/tab\tand\nnewline"},
+		{`/mnt/back\134slash`, `/mnt/back\slash`},
+		{`/mnt/end\040`, "/mnt/end "},
+		{`/mnt/invalid\08`, `/mnt/invalid\08`},
+		{`/mnt/short\04`, `/mnt/short\04`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.expected, UnescapeMountField(tc.input))
+		})
+	}
+}
+
+func TestParseMountLine_escapes(t *testing.T) {
+	info, err := ParseMountLine(`/dev/mapper/vg-lv /mnt/my\040volume ext4 rw 0 0`)
+	require.NoError(t, err)
+	assert.Equal(t, "/mnt/my volume", info.Location)
+}
+
+func TestParseMountInfoLine_mountinfoFormat(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    *MountInfo
+		shouldError bool
+	}{
+		{
+			desc:        "empty should err",
+			input:       "",
+			shouldError: true,
+		},
+		{
+			desc:        "missing separator should err",
+			input:       "36 35 98:0 /mnt1 /mnt2 rw,noatime ext3 /dev/root rw",
+			shouldError: true,
+		},
+		{
+			desc:        "missing fields after separator should err",
+			input:       "36 35 98:0 /mnt1 /mnt2 rw,noatime - ext3",
+			shouldError: true,
+		},
+		{
+			desc:        "malformed device numbers should err",
+			input:       "36 35 98 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw",
+			shouldError: true,
+		},
+		{
+			desc:        "malformed mount id should err",
+			input:       "a 35 98:0 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw",
+			shouldError: true,
+		},
+		{
+			desc:  "proc(5) example",
+			input: "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue",
+			expected: &MountInfo{
+				MountId:        36,
+				ParentId:       35,
+				Major:          98,
+				Minor:          0,
+				Root:           "/mnt1",
+				Location:       "/mnt2",
+				Options:        "rw,noatime",
+				OptionalFields: []string{"master:1"},
+				Format:         "ext3",
+				Device:         "/dev/root",
+				SuperOptions:   "rw,errors=continue",
+			},
+		},
+		{
+			desc:  "no optional fields and escaped location",
+			input: `120 24 253:3 / /mnt/lvmvol/volumes/my\040vol rw,relatime - ext4 /dev/mapper/vg-my\040vol rw,data=ordered`,
+			expected: &MountInfo{
+				MountId:        120,
+				ParentId:       24,
+				Major:          253,
+				Minor:          3,
+				Root:           "/",
+				Location:       "/mnt/lvmvol/volumes/my vol",
+				Options:        "rw,relatime",
+				OptionalFields: []string{},
+				Format:         "ext4",
+				Device:         "/dev/mapper/vg-my vol",
+				SuperOptions:   "rw,data=ordered",
+			},
+		},
+		{
+			desc:  "multiple optional fields",
+			input: "25 1 0:22 / /sys rw,nosuid shared:7 master:2 - sysfs sysfs rw",
+			expected: &MountInfo{
+				MountId:        25,
+				ParentId:       1,
+				Major:          0,
+				Minor:          22,
+				Root:           "/",
+				Location:       "/sys",
+				Options:        "rw,nosuid",
+				OptionalFields: []string{"shared:7", "master:2"},
+				Format:         "sysfs",
+				Device:         "sysfs",
+				SuperOptions:   "rw",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseMountInfoLine(tc.input)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestParseMountInfoFile(t *testing.T) {
+	var fileContent = []byte(`
+22 27 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:13 - proc proc rw
+120 24 253:3 / /mnt/lvmvol/volumes/abc rw,relatime shared:60 - ext4 /dev/mapper/vg-abc rw,data=ordered
+121 24 253:3 / /mnt/other rw,relatime shared:60 - ext4 /dev/mapper/vg-abc rw,data=ordered
+`)
+	file, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	filename := file.Name()
+
+	defer os.Remove(filename)
+
+	_, err = file.Write(fileContent)
+	require.NoError(t, err)
+	file.Close()
+
+	infos, err := ParseMountInfoFile(filename)
+	require.NoError(t, err)
+	require.Len(t, infos, 3)
+
+	assert.Len(t, FindMountsOfDevice(infos, 253, 3, ""), 2)
+	assert.Len(t, FindMountsOfDevice(infos, 253, 3, "/mnt/lvmvol/volumes/abc/"), 1)
+	assert.Len(t, FindMountsOfDevice(infos, 253, 4, ""), 0)
+	assert.Len(t, FindMountsOfDevice(infos, 253, 3, "/mnt/inexistent"), 0)
+}
+
+func TestDeviceNumbers_failsWithRegularFiles(t *testing.T) {
+	file, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.Close()
+
+	_, _, err = DeviceNumbers(file.Name())
+	assert.Error(t, err)
+
+	_, _, err = DeviceNumbers("/inexistent/device")
+	assert.Error(t, err)
+}
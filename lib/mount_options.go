@@ -0,0 +1,354 @@
+package lib
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultFsType is the filesystem used for volumes that
+	// didn't specify one at creation time.
+	DefaultFsType = "ext4"
+
+	// FsTypeTagPrefix prefixes the tag that records the
+	// filesystem of a volume.
+	FsTypeTagPrefix = "golvm/fstype="
+
+	// MountOptionTagPrefix prefixes the tags that record
+	// each of the mount options of a volume. As lvm doesn't
+	// allow commas in tags, each option gets its own tag.
+	MountOptionTagPrefix = "golvm/mountopt="
+)
+
+var (
+	// mountFlags maps the generic options to the flags
+	// passed to mount(2).
+	mountFlags = map[string]uintptr{
+		"noatime": unix.MS_NOATIME,
+		"nodev":   unix.MS_NODEV,
+		"nosuid":  unix.MS_NOSUID,
+		"noexec":  unix.MS_NOEXEC,
+		"ro":      unix.MS_RDONLY,
+	}
+
+	// fsDataOptions maps the options that each filesystem
+	// accepts as mount(2) data to a pattern that validates
+	// their values. An empty pattern means that the option
+	// takes no value.
+	fsDataOptions = map[string]map[string]*regexp.Regexp{
+		"ext4": {
+			"discard":          nil,
+			"nodiscard":        nil,
+			"barrier":          nil,
+			"nobarrier":        nil,
+			"journal_checksum": nil,
+			"data":             regexp.MustCompile(`^(journal|ordered|writeback)$`),
+			"commit":           regexp.MustCompile(`^[0-9]+$`),
+			"errors":           regexp.MustCompile(`^(continue|remount-ro|panic)$`),
+			"stripe":           regexp.MustCompile(`^[0-9]+$`),
+		},
+		"xfs": {
+			"discard":   nil,
+			"nodiscard": nil,
+			"inode64":   nil,
+			"largeio":   nil,
+			"noquota":   nil,
+			"nouuid":    nil,
+			"wsync":     nil,
+			"allocsize": regexp.MustCompile(`^[0-9]+[kmg]?$`),
+			"logbufs":   regexp.MustCompile(`^[0-9]+$`),
+			"logbsize":  regexp.MustCompile(`^[0-9]+[k]?$`),
+		},
+		"btrfs": {
+			"discard":      nil,
+			"nodiscard":    nil,
+			"ssd":          nil,
+			"nossd":        nil,
+			"autodefrag":   nil,
+			"noautodefrag": nil,
+			"compress":     regexp.MustCompile(`^(no|lzo|zlib|zstd)$`),
+			"commit":       regexp.MustCompile(`^[0-9]+$`),
+		},
+		FsTypeNone: {},
+	}
+
+	// validTag matches the characters that lvm accepts in
+	// tags.
+	validTag = regexp.MustCompile(`^[A-Za-z0-9_+.\-/=!:&#]+$`)
+)
+
+// MountOptions holds the validated options to mount the
+// filesystem of a volume with.
+type MountOptions struct {
+	FsType string
+
+	// Flags are the generic options (e.g., 'noatime')
+	// while Data holds the filesystem-specific ones
+	// (e.g., 'data=ordered').
+	Flags []string
+	Data  []string
+}
+
+// ParseMountOptions validates a comma-separated list of mount
+// options against the options that 'fsType' supports.
+// Options are normalized such that the same set of options
+// always produces the same MountOptions.
+func ParseMountOptions(fsType, opts string) (parsed MountOptions, err error) {
+	var (
+		supported map[string]*regexp.Regexp
+		found     bool
+		seen      = map[string]bool{}
+	)
+
+	if fsType == "" {
+		fsType = DefaultFsType
+	}
+
+	supported, found = fsDataOptions[fsType]
+	if !found {
+		err = errors.Errorf("unsupported fs type %s", fsType)
+		return
+	}
+
+	parsed.FsType = fsType
+
+	for _, opt := range strings.Split(opts, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" || seen[opt] {
+			continue
+		}
+		seen[opt] = true
+
+		if _, isFlag := mountFlags[opt]; isFlag {
+			parsed.Flags = append(parsed.Flags, opt)
+			continue
+		}
+
+		var (
+			parts   = strings.SplitN(opt, "=", 2)
+			pattern *regexp.Regexp
+		)
+
+		pattern, found = supported[parts[0]]
+		if !found {
+			err = errors.Errorf(
+				"mount option %s is not supported by %s",
+				parts[0], fsType)
+			return
+		}
+
+		switch {
+		case pattern == nil && len(parts) == 2:
+			err = errors.Errorf(
+				"mount option %s doesn't take a value", parts[0])
+			return
+		case pattern != nil && (len(parts) != 2 || !pattern.MatchString(parts[1])):
+			err = errors.Errorf(
+				"mount option %s requires a value matching %s",
+				parts[0], pattern)
+			return
+		}
+
+		parsed.Data = append(parsed.Data, opt)
+	}
+
+	if fsType == FsTypeNone && len(parsed.Flags) > 0 {
+		err = errors.Errorf(
+			"volumes without a filesystem take no mount options")
+		return
+	}
+
+	sort.Strings(parsed.Flags)
+	sort.Strings(parsed.Data)
+	return
+}
+
+// MountFlags computes the flags to pass to mount(2).
+func (o MountOptions) MountFlags() (flags uintptr) {
+	for _, opt := range o.Flags {
+		flags |= mountFlags[opt]
+	}
+
+	return
+}
+
+// MountData computes the filesystem-specific data to pass to
+// mount(2).
+func (o MountOptions) MountData() string {
+	return strings.Join(o.Data, ",")
+}
+
+// String gives back the comma-separated list of options.
+func (o MountOptions) String() string {
+	return strings.Join(append(append([]string{}, o.Flags...), o.Data...), ",")
+}
+
+// Tags gives the tags that persist the filesystem and the
+// mount options with a volume.
+func (o MountOptions) Tags() (tags []string) {
+	tags = []string{FsTypeTagPrefix + o.FsType}
+
+	for _, opt := range append(append([]string{}, o.Flags...), o.Data...) {
+		tags = append(tags, MountOptionTagPrefix+opt)
+	}
+
+	return
+}
+
+// WithFsType gives the options for mounting a filesystem of
+// type 'fsType' instead. Filesystems that golvm doesn't create
+// (e.g., ext3) only take the generic flags.
+func (o MountOptions) WithFsType(fsType string) (opts MountOptions, err error) {
+	if _, found := fsDataOptions[fsType]; !found && len(o.Data) == 0 {
+		opts = o
+		opts.FsType = fsType
+		return
+	}
+
+	opts, err = ParseMountOptions(fsType, o.String())
+	return
+}
+
+// VolumeFsType retrieves the filesystem persisted in the tags
+// of a volume. If there's none (e.g., the volume wasn't
+// created by golvm), 'found' is false.
+func VolumeFsType(vol *LogicalVolume) (fsType string, found bool) {
+	for _, tag := range vol.LvTags {
+		if strings.HasPrefix(tag, FsTypeTagPrefix) {
+			fsType = strings.TrimPrefix(tag, FsTypeTagPrefix)
+			found = true
+			return
+		}
+	}
+
+	return
+}
+
+// VolumeMountOptions retrieves the mount options persisted
+// in the tags of a volume. Volumes without tags (e.g., those
+// not created by golvm) get the default filesystem with no
+// options, which only suits blank devices (see
+// ProbedMountOptions).
+func VolumeMountOptions(vol *LogicalVolume) (opts MountOptions, err error) {
+	var (
+		fsType  string
+		options = []string{}
+	)
+
+	for _, tag := range vol.LvTags {
+		switch {
+		case strings.HasPrefix(tag, FsTypeTagPrefix):
+			fsType = strings.TrimPrefix(tag, FsTypeTagPrefix)
+		case strings.HasPrefix(tag, MountOptionTagPrefix):
+			options = append(options,
+				strings.TrimPrefix(tag, MountOptionTagPrefix))
+		}
+	}
+
+	opts, err = ParseMountOptions(fsType, strings.Join(options, ","))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"invalid mount options in tags of volume %s",
+			vol.LvName)
+		return
+	}
+
+	return
+}
+
+// ValidateTag checks whether lvm accepts 'tag' as a tag.
+func ValidateTag(tag string) (err error) {
+	if !validTag.MatchString(tag) || strings.HasPrefix(tag, "-") {
+		err = errors.Errorf(
+			"tag '%s' must be made of letters, numbers and '_+.-/=!:&#' "+
+				"and not start with '-'", tag)
+		return
+	}
+
+	return
+}
+
+// UnmountPolicy determines how far unmounting goes when a
+// filesystem is busy.
+type UnmountPolicy string
+
+const (
+	// UnmountNormal fails if the filesystem is busy.
+	UnmountNormal UnmountPolicy = "normal"
+
+	// UnmountDetach lazily detaches a busy filesystem
+	// (MNT_DETACH), which is cleaned up once it's no
+	// longer busy.
+	UnmountDetach UnmountPolicy = "detach"
+
+	// UnmountForce forces the unmount of a busy
+	// filesystem (MNT_FORCE), aborting pending requests.
+	UnmountForce UnmountPolicy = "force"
+)
+
+// ParseUnmountPolicy validates an unmount policy, defaulting
+// to UnmountNormal.
+func ParseUnmountPolicy(policy string) (parsed UnmountPolicy, err error) {
+	switch UnmountPolicy(policy) {
+	case "", UnmountNormal:
+		parsed = UnmountNormal
+	case UnmountDetach, UnmountForce:
+		parsed = UnmountPolicy(policy)
+	default:
+		err = errors.Errorf(
+			"unknown unmount policy %s - must be normal, detach or force",
+			policy)
+	}
+
+	return
+}
+
+// flags gives the flags to pass to umount2(2) when a plain
+// unmount found the filesystem busy.
+func (p UnmountPolicy) flags() (flags int, allowed bool) {
+	switch p {
+	case UnmountDetach:
+		return unix.MNT_DETACH, true
+	case UnmountForce:
+		return unix.MNT_FORCE, true
+	}
+
+	return
+}
+
+// ProbedMountOptions reconciles the mount options of a volume
+// with the signature found in its device. Volumes whose tags
+// don't record a filesystem get the probed one; those that do
+// must hold it. Blank devices (a nil signature) keep the
+// options as they are.
+func ProbedMountOptions(vol *LogicalVolume, opts MountOptions, sig *FsSignature) (probed MountOptions, err error) {
+	var _, tagged = VolumeFsType(vol)
+
+	probed = opts
+	if sig == nil {
+		return
+	}
+
+	switch {
+	case !sig.IsFilesystem():
+		err = errors.Errorf(
+			"volume %s holds %s, not a filesystem", vol.LvName, sig.Type)
+	case tagged && sig.Type != opts.FsType:
+		err = errors.Errorf(
+			"volume %s should hold %s but holds %s",
+			vol.LvName, opts.FsType, sig.Type)
+	case !tagged:
+		probed, err = opts.WithFsType(sig.Type)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"can't mount the %s filesystem of volume %s",
+				sig.Type, vol.LvName)
+		}
+	}
+
+	return
+}
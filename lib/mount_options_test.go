@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseMountOptions(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		fsType      string
+		opts        string
+		expected    string
+		flags       uintptr
+		data        string
+		shouldError bool
+	}{
+		{
+			desc:     "empty defaults to ext4",
+			fsType:   "",
+			opts:     "",
+			expected: "",
+		},
+		{
+			desc:     "generic flags are sorted and deduplicated",
+			fsType:   "ext4",
+			opts:     "nosuid, noatime,nodev,noatime",
+			expected: "noatime,nodev,nosuid",
+			flags:    unix.MS_NOATIME | unix.MS_NODEV | unix.MS_NOSUID,
+		},
+		{
+			desc:     "ext4 data options",
+			fsType:   "ext4",
+			opts:     "ro,data=ordered,discard,commit=30",
+			expected: "ro,commit=30,data=ordered,discard",
+			flags:    unix.MS_RDONLY,
+			data:     "commit=30,data=ordered,discard",
+		},
+		{
+			desc:     "xfs data options",
+			fsType:   "xfs",
+			opts:     "noexec,nouuid,allocsize=64k",
+			expected: "noexec,allocsize=64k,nouuid",
+			flags:    unix.MS_NOEXEC,
+			data:     "allocsize=64k,nouuid",
+		},
+		{
+			desc:        "unknown fs type fails",
+			fsType:      "zfs",
+			opts:        "noatime",
+			shouldError: true,
+		},
+		{
+			desc:        "options of other filesystems fail",
+			fsType:      "xfs",
+			opts:        "data=ordered",
+			shouldError: true,
+		},
+		{
+			desc:        "invalid values fail",
+			fsType:      "ext4",
+			opts:        "data=fast",
+			shouldError: true,
+		},
+		{
+			desc:        "values for options without them fail",
+			fsType:      "ext4",
+			opts:        "discard=yes",
+			shouldError: true,
+		},
+		{
+			desc:        "unknown options fail",
+			fsType:      "ext4",
+			opts:        "suid",
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts, err := ParseMountOptions(tc.fsType, tc.opts)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, opts.String())
+			assert.Equal(t, tc.flags, opts.MountFlags())
+			assert.Equal(t, tc.data, opts.MountData())
+		})
+	}
+}
+
+func TestVolumeMountOptions(t *testing.T) {
+	opts, err := ParseMountOptions("xfs", "nodev,discard")
+	require.NoError(t, err)
+
+	tags := opts.Tags()
+	assert.Equal(t, []string{
+		"golvm/fstype=xfs",
+		"golvm/mountopt=nodev",
+		"golvm/mountopt=discard",
+	}, tags)
+
+	for _, tag := range tags {
+		assert.NoError(t, ValidateTag(tag))
+	}
+
+	vol := &LogicalVolume{
+		LvName: "vol",
+		LvTags: append(StringList{"other"}, tags...),
+	}
+
+	persisted, err := VolumeMountOptions(vol)
+	require.NoError(t, err)
+	assert.Equal(t, opts, persisted)
+
+	fsType, found := VolumeFsType(vol)
+	assert.True(t, found)
+	assert.Equal(t, "xfs", fsType)
+
+	_, found = VolumeFsType(&LogicalVolume{LvName: "untagged"})
+	assert.False(t, found)
+
+	persisted, err = VolumeMountOptions(&LogicalVolume{LvName: "untagged"})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultFsType, persisted.FsType)
+	assert.Empty(t, persisted.String())
+
+	_, err = VolumeMountOptions(&LogicalVolume{
+		LvName: "tampered",
+		LvTags: StringList{"golvm/fstype=ext4", "golvm/mountopt=inode64"},
+	})
+	assert.Error(t, err)
+}
+
+func TestParseUnmountPolicy(t *testing.T) {
+	policy, err := ParseUnmountPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, UnmountNormal, policy)
+
+	_, allowed := policy.flags()
+	assert.False(t, allowed)
+
+	policy, err = ParseUnmountPolicy("detach")
+	require.NoError(t, err)
+
+	flags, allowed := policy.flags()
+	assert.True(t, allowed)
+	assert.Equal(t, unix.MNT_DETACH, flags)
+
+	policy, err = ParseUnmountPolicy("force")
+	require.NoError(t, err)
+
+	flags, _ = policy.flags()
+	assert.Equal(t, unix.MNT_FORCE, flags)
+
+	_, err = ParseUnmountPolicy("lazy")
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DeviceNumber identifies a block device by its major and
+// minor numbers.
+type DeviceNumber struct {
+	Major uint32
+	Minor uint32
+}
+
+// MountTable answers questions about a snapshot of the mounts
+// of the system.
+type MountTable struct {
+	Mounts []*MountInfo
+}
+
+// OfDevices lists the mounts of any of the devices.
+func (t *MountTable) OfDevices(devices []DeviceNumber) (mounts []*MountInfo) {
+	mounts = make([]*MountInfo, 0)
+
+	for _, device := range devices {
+		mounts = append(mounts,
+			FindMountsOfDevice(t.Mounts, device.Major, device.Minor, "")...)
+	}
+
+	return
+}
+
+// At lists the mounts whose mount point is 'location'. More
+// than one mount can be stacked on the same location.
+func (t *MountTable) At(location string) (mounts []*MountInfo) {
+	mounts = make([]*MountInfo, 0)
+	location = filepath.Clean(location)
+
+	for _, info := range t.Mounts {
+		if filepath.Clean(info.Location) == location {
+			mounts = append(mounts, info)
+		}
+	}
+
+	return
+}
+
+// VolumeMountStatus describes how the devices of a volume
+// relate to the location where we expect them to be mounted.
+type VolumeMountStatus struct {
+	// Mounts lists all the mounts of the volume's devices.
+	Mounts []*MountInfo
+
+	// MountedAt indicates whether one of the volume's
+	// devices is mounted at the expected location.
+	MountedAt bool
+
+	// Elsewhere lists the mounts of the volume's devices
+	// at locations other than the expected one.
+	Elsewhere []*MountInfo
+
+	// Foreign lists the mounts of other devices at the
+	// expected location.
+	Foreign []*MountInfo
+}
+
+// VolumeStatus computes the VolumeMountStatus of the devices
+// of a volume with respect to 'location'.
+func (t *MountTable) VolumeStatus(devices []DeviceNumber, location string) (status *VolumeMountStatus) {
+	var ours = make(map[DeviceNumber]bool)
+
+	for _, device := range devices {
+		ours[device] = true
+	}
+
+	status = &VolumeMountStatus{
+		Mounts:    t.OfDevices(devices),
+		Elsewhere: make([]*MountInfo, 0),
+		Foreign:   make([]*MountInfo, 0),
+	}
+
+	location = filepath.Clean(location)
+	for _, info := range status.Mounts {
+		if filepath.Clean(info.Location) == location {
+			status.MountedAt = true
+			continue
+		}
+
+		status.Elsewhere = append(status.Elsewhere, info)
+	}
+
+	for _, info := range t.At(location) {
+		if !ours[DeviceNumber{info.Major, info.Minor}] {
+			status.Foreign = append(status.Foreign, info)
+		}
+	}
+
+	return
+}
+
+// LuksMappingName is the name of the device mapper mapping
+// created when opening the luks device of a volume.
+func LuksMappingName(vol *LogicalVolume) string {
+	return "luks-" + vol.LvName
+}
+
+// LuksMappingPath is the path of the device created when
+// opening the luks device of a volume.
+func LuksMappingPath(vol *LogicalVolume) string {
+	return "/dev/mapper/" + LuksMappingName(vol)
+}
+
+// GetMountTable parses the configured mountinfo file.
+func (l Lvm) GetMountTable() (table *MountTable, err error) {
+	var infos []*MountInfo
+
+	infos, err = ParseMountInfoFile(l.mountInfoFile)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to parse mounts from file %s",
+			l.mountInfoFile)
+		return
+	}
+
+	table = &MountTable{
+		Mounts: infos,
+	}
+	return
+}
+
+// VolumeDeviceNumbers retrieves the device numbers of a
+// volume's device and, if opened, of its luks mapping.
+func (l Lvm) VolumeDeviceNumbers(vol *LogicalVolume) (devices []DeviceNumber, err error) {
+	var major, minor uint32
+
+	if vol == nil || vol.LvDmPath == "" {
+		err = errors.Errorf("volume must have a device")
+		return
+	}
+
+	major, minor, err = DeviceNumbers(vol.LvDmPath)
+	if err != nil {
+		return
+	}
+
+	devices = append(devices, DeviceNumber{major, minor})
+
+	major, minor, err = DeviceNumbers(LuksMappingPath(vol))
+	if err != nil {
+		if _, statErr := os.Stat(LuksMappingPath(vol)); os.IsNotExist(statErr) {
+			err = nil
+			return
+		}
+
+		return
+	}
+
+	devices = append(devices, DeviceNumber{major, minor})
+	return
+}
+
+// GetVolumeMountStatus tells where the devices of a volume
+// (or of its luks mapping) are mounted with respect to the
+// location where they're expected to be.
+func (l Lvm) GetVolumeMountStatus(vol *LogicalVolume, location string) (status *VolumeMountStatus, err error) {
+	var (
+		devices []DeviceNumber
+		table   *MountTable
+	)
+
+	devices, err = l.VolumeDeviceNumbers(vol)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't retrieve device numbers of volume %s",
+			vol.LvName)
+		return
+	}
+
+	table, err = l.GetMountTable()
+	if err != nil {
+		return
+	}
+
+	status = table.VolumeStatus(devices, location)
+	return
+}
@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mountTableFixture = &MountTable{
+	Mounts: []*MountInfo{
+		{Device: "/dev/mapper/vg0-data", Location: "/mnt/volumes/data", Major: 253, Minor: 1},
+		{Device: "/dev/mapper/vg0-data", Location: "/srv/data/", Major: 253, Minor: 1},
+		{Device: "/dev/mapper/luks-secret", Location: "/mnt/volumes/secret", Major: 253, Minor: 4},
+		{Device: "tmpfs", Location: "/mnt/volumes/other", Major: 0, Minor: 42},
+		{Device: "/dev/mapper/vg0-other", Location: "/mnt/volumes/other", Major: 253, Minor: 2},
+	},
+}
+
+func TestMountTable_VolumeStatus(t *testing.T) {
+	var testCases = []struct {
+		desc      string
+		devices   []DeviceNumber
+		location  string
+		mounts    int
+		mountedAt bool
+		elsewhere []string
+		foreign   []string
+	}{
+		{
+			desc:      "not mounted anywhere",
+			devices:   []DeviceNumber{{253, 9}},
+			location:  "/mnt/volumes/none",
+			elsewhere: []string{},
+			foreign:   []string{},
+		},
+		{
+			desc:      "mounted at location and elsewhere",
+			devices:   []DeviceNumber{{253, 1}},
+			location:  "/mnt/volumes/data/",
+			mounts:    2,
+			mountedAt: true,
+			elsewhere: []string{"/srv/data/"},
+			foreign:   []string{},
+		},
+		{
+			desc:      "mounted through the luks mapping",
+			devices:   []DeviceNumber{{253, 3}, {253, 4}},
+			location:  "/mnt/volumes/secret",
+			mounts:    1,
+			mountedAt: true,
+			elsewhere: []string{},
+			foreign:   []string{},
+		},
+		{
+			desc:      "location taken by other devices",
+			devices:   []DeviceNumber{{253, 2}},
+			location:  "/mnt/volumes/other",
+			mounts:    1,
+			mountedAt: true,
+			elsewhere: []string{},
+			foreign:   []string{"tmpfs"},
+		},
+		{
+			desc:      "only mounted elsewhere",
+			devices:   []DeviceNumber{{253, 1}},
+			location:  "/mnt/volumes/other",
+			mounts:    2,
+			elsewhere: []string{"/mnt/volumes/data", "/srv/data/"},
+			foreign:   []string{"tmpfs", "/dev/mapper/vg0-other"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var (
+				elsewhere = []string{}
+				foreign   = []string{}
+			)
+
+			status := mountTableFixture.VolumeStatus(tc.devices, tc.location)
+			assert.Len(t, status.Mounts, tc.mounts)
+			assert.Equal(t, tc.mountedAt, status.MountedAt)
+
+			for _, info := range status.Elsewhere {
+				elsewhere = append(elsewhere, info.Location)
+			}
+
+			for _, info := range status.Foreign {
+				foreign = append(foreign, info.Device)
+			}
+
+			assert.Equal(t, tc.elsewhere, elsewhere)
+			assert.Equal(t, tc.foreign, foreign)
+		})
+	}
+}
+
+func TestLvm_GetMountTable(t *testing.T) {
+	file, err := ioutil.TempFile("", "mountinfo")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(
+		"36 35 253:1 / /mnt/volumes/data rw,noatime - ext4 /dev/mapper/vg0-data rw\n")
+	require.NoError(t, err)
+	file.Close()
+
+	l := Lvm{mountInfoFile: file.Name()}
+
+	table, err := l.GetMountTable()
+	require.NoError(t, err)
+	require.Len(t, table.Mounts, 1)
+	assert.Len(t, table.OfDevices([]DeviceNumber{{253, 1}}), 1)
+	assert.Len(t, table.At("/mnt/volumes/data"), 1)
+
+	l.mountInfoFile = file.Name() + "-inexistent"
+	_, err = l.GetMountTable()
+	assert.Error(t, err)
+}
+
+func TestLuksMappingPath(t *testing.T) {
+	vol := &LogicalVolume{LvName: "secret"}
+
+	assert.Equal(t, "luks-secret", LuksMappingName(vol))
+	assert.Equal(t, "/dev/mapper/luks-secret", LuksMappingPath(vol))
+}
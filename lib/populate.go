@@ -0,0 +1,342 @@
+package lib
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// ResolvePopulateSource resolves the path of the content that a
+// new volume gets populated with (a directory or a tarball),
+// which must live under 'root'. Relative paths are relative to
+// 'root' and symlinks are followed before checking.
+func ResolvePopulateSource(root, source string) (resolved string, err error) {
+	if root == "" {
+		err = errors.Errorf("populating volumes is disabled")
+		return
+	}
+
+	if source == "" {
+		err = errors.Errorf("a source to populate from must be specified")
+		return
+	}
+
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't resolve populate root")
+		return
+	}
+
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(root, source)
+	}
+
+	resolved, err = filepath.EvalSymlinks(source)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't resolve source %s", source)
+		return
+	}
+
+	if resolved == root ||
+		!strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		err = errors.Errorf(
+			"source %s is not under %s", source, root)
+		resolved = ""
+		return
+	}
+
+	return
+}
+
+// tarballPath computes where the entry 'name' of a tarball goes
+// under 'root'. Leading slashes and './' are dropped while names
+// with '..' are refused.
+func tarballPath(root, name string) (target string, err error) {
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			err = errors.Errorf("entry %s escapes %s", name, root)
+			return
+		}
+	}
+
+	target = filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+	return
+}
+
+// PopulateFromTarball extracts the tarball (optionally gzipped)
+// in 'r' under 'root', keeping ownership, permissions, xattrs
+// and hard links.
+func PopulateFromTarball(r io.Reader, root string) (err error) {
+	var (
+		tr        *tar.Reader
+		hdr       *tar.Header
+		extractor *treeExtractor
+	)
+
+	tr, err = newTarReader(r)
+	if err != nil {
+		return
+	}
+
+	extractor, err = newTreeExtractor(root, tarballPath)
+	if err != nil {
+		return
+	}
+
+	for {
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't read tarball")
+			return
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeRegA:
+			hdr.Typeflag = tar.TypeReg
+		}
+
+		err = extractor.extract(hdr, tr)
+		if err != nil {
+			return
+		}
+	}
+
+	extractor.finish()
+	return
+}
+
+// readXattrs records the extended attributes of 'file' in the
+// pax records of 'hdr'. Filesystems without xattrs support
+// have none.
+func readXattrs(file string, hdr *tar.Header) (err error) {
+	var (
+		names []byte
+		value []byte
+		size  int
+	)
+
+	size, err = unix.Llistxattr(file, nil)
+	if err == unix.ENOTSUP || size == 0 {
+		err = nil
+		return
+	}
+
+	if err == nil {
+		names = make([]byte, size)
+		size, err = unix.Llistxattr(file, names)
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't list xattrs of %s", file)
+		return
+	}
+
+	for _, name := range strings.Split(strings.TrimRight(string(names[:size]), "\x00"), "\x00") {
+		size, err = unix.Lgetxattr(file, name, nil)
+		if err == nil {
+			value = make([]byte, size)
+			size, err = unix.Lgetxattr(file, name, value)
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't read xattr %s of %s", name, file)
+			return
+		}
+
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = map[string]string{}
+		}
+
+		hdr.PAXRecords[paxXattrPrefix+name] = string(value[:size])
+	}
+
+	return
+}
+
+// PopulateFromDirectory copies the tree under 'src' to 'root',
+// keeping ownership, permissions, xattrs and hard links (within
+// the tree). Sockets are skipped.
+func PopulateFromDirectory(src, root string) (err error) {
+	var (
+		extractor *treeExtractor
+		links     = map[[2]uint64]string{}
+	)
+
+	extractor, err = newTreeExtractor(root, tarballPath)
+	if err != nil {
+		return
+	}
+
+	err = filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		var (
+			rel  string
+			link string
+			hdr  *tar.Header
+			f    *os.File
+		)
+
+		if err != nil {
+			return err
+		}
+
+		rel, err = filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(file)
+			if err != nil {
+				return err
+			}
+		}
+
+		hdr, err = tar.FileInfoHeader(info, link)
+		if err != nil {
+			return errors.Wrapf(err, "can't copy %s", file)
+		}
+
+		hdr.Name = filepath.ToSlash(rel)
+
+		err = readXattrs(file, hdr)
+		if err != nil {
+			return err
+		}
+
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && info.Mode().IsRegular() && st.Nlink > 1 {
+			key := [2]uint64{uint64(st.Dev), uint64(st.Ino)}
+			if first, found := links[key]; found {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				return extractor.extract(hdr, nil)
+			}
+
+			links[key] = hdr.Name
+		}
+
+		if !info.Mode().IsRegular() {
+			return extractor.extract(hdr, nil)
+		}
+
+		f, err = os.Open(file)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't open %s", file)
+		}
+		defer f.Close()
+
+		return extractor.extract(hdr, f)
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed to copy %s", src)
+		return
+	}
+
+	extractor.finish()
+	return
+}
+
+// PopulateVolume fills the filesystem of the freshly created
+// 'vol' with the contents of 'source' (see
+// ResolvePopulateSource): a directory to copy or a tarball to
+// extract. The volume is formatted if needed and mounted at a
+// temporary directory while populated.
+func (l Lvm) PopulateVolume(vol *LogicalVolume, source string) (err error) {
+	var (
+		opts        MountOptions
+		formatOpts  FormatOptions
+		isFormatted bool
+		info        os.FileInfo
+	)
+
+	if vol.LvDmPath == "" {
+		err = errors.Errorf(
+			"can't find the device of volume %s", vol.LvName)
+		return
+	}
+
+	opts, err = VolumeMountOptions(vol)
+	if err != nil {
+		return
+	}
+
+	if opts.FsType == FsTypeNone {
+		err = errors.Errorf(
+			"volume %s has no filesystem to populate", vol.LvName)
+		return
+	}
+
+	info, err = os.Stat(source)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't stat source %s", source)
+		return
+	}
+
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		err = errors.Errorf(
+			"source %s must be a directory or a tarball", source)
+		return
+	}
+
+	isFormatted, err = l.IsDeviceFormatted(vol.LvDmPath)
+	if err != nil {
+		return
+	}
+
+	if !isFormatted {
+		formatOpts, err = VolumeFormatOptions(vol)
+		if err != nil {
+			return
+		}
+
+		err = l.FormatDevice(vol.LvDmPath, opts.FsType, formatOpts)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't format device %s as %s",
+				vol.LvDmPath, opts.FsType)
+			return
+		}
+	}
+
+	err = l.withMountedDevice(vol.LvDmPath, opts, func(dir string) (err error) {
+		var f *os.File
+
+		if info.IsDir() {
+			return PopulateFromDirectory(source, dir)
+		}
+
+		f, err = os.Open(source)
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't open %s", source)
+			return
+		}
+		defer f.Close()
+
+		return PopulateFromTarball(f, dir)
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to populate volume %s from %s", vol.LvName, source)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,272 @@
+package lib
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+type tarEntry struct {
+	hdr     tar.Header
+	content string
+}
+
+func writeTarball(t *testing.T, entries []tarEntry, compress bool) []byte {
+	var (
+		buf bytes.Buffer
+		gz  *gzip.Writer
+		tw  *tar.Writer
+	)
+
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+
+	for _, entry := range entries {
+		hdr := entry.hdr
+		hdr.Size = int64(len(entry.content))
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	if gz != nil {
+		require.NoError(t, gz.Close())
+	}
+
+	return buf.Bytes()
+}
+
+func TestResolvePopulateSource(t *testing.T) {
+	root, err := ioutil.TempDir("", "golvm-populate-root")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	root, err = filepath.EvalSymlinks(root)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "content"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "data.tar"), nil, 0644))
+	require.NoError(t, os.Symlink("/etc", filepath.Join(root, "escape")))
+	require.NoError(t, os.Symlink("content", filepath.Join(root, "inside")))
+
+	var testCases = []struct {
+		desc        string
+		root        string
+		source      string
+		expected    string
+		shouldError bool
+	}{
+		{desc: "relative directory", root: root, source: "content",
+			expected: filepath.Join(root, "content")},
+		{desc: "absolute tarball", root: root, source: filepath.Join(root, "data.tar"),
+			expected: filepath.Join(root, "data.tar")},
+		{desc: "symlink inside root", root: root, source: "inside",
+			expected: filepath.Join(root, "content")},
+		{desc: "symlink outside of root", root: root, source: "escape", shouldError: true},
+		{desc: "dot-dot", root: root, source: "../", shouldError: true},
+		{desc: "root itself", root: root, source: root, shouldError: true},
+		{desc: "outside of root", root: root, source: "/etc", shouldError: true},
+		{desc: "inexistent", root: root, source: "nope", shouldError: true},
+		{desc: "disabled", root: "", source: "content", shouldError: true},
+		{desc: "empty source", root: root, source: "", shouldError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			resolved, err := ResolvePopulateSource(tc.root, tc.source)
+			if tc.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, resolved)
+		})
+	}
+}
+
+func TestTarballPath(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		expected    string
+		shouldError bool
+	}{
+		{"./", "/root", false},
+		{"./dir/file", "/root/dir/file", false},
+		{"dir/", "/root/dir", false},
+		{"/abs/file", "/root/abs/file", false},
+		{"../etc/passwd", "", true},
+		{"dir/../../x", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := tarballPath("/root", tc.name)
+			if tc.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, target)
+		})
+	}
+}
+
+func TestPopulateFromTarball(t *testing.T) {
+	var entries = []tarEntry{
+		{hdr: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0750}},
+		{hdr: tar.Header{Name: "./dir/file", Typeflag: tar.TypeReg, Mode: 0640}, content: "content"},
+		{hdr: tar.Header{Name: "./hardlink", Typeflag: tar.TypeLink, Linkname: "./dir/file"}},
+		{hdr: tar.Header{Name: "./link", Typeflag: tar.TypeSymlink, Linkname: "dir/file"}},
+	}
+
+	for _, compress := range []bool{false, true} {
+		dst, err := ioutil.TempDir("", "golvm-populate-dst")
+		require.NoError(t, err)
+		defer os.RemoveAll(dst)
+
+		tarball := writeTarball(t, entries, compress)
+		require.NoError(t, PopulateFromTarball(bytes.NewReader(tarball), dst))
+
+		content, err := ioutil.ReadFile(filepath.Join(dst, "dir", "file"))
+		require.NoError(t, err)
+		assert.Equal(t, "content", string(content))
+
+		info, err := os.Stat(dst)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+		file, err := os.Stat(filepath.Join(dst, "dir", "file"))
+		require.NoError(t, err)
+		hardlink, err := os.Stat(filepath.Join(dst, "hardlink"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(file, hardlink))
+
+		link, err := os.Readlink(filepath.Join(dst, "link"))
+		require.NoError(t, err)
+		assert.Equal(t, "dir/file", link)
+	}
+}
+
+func TestPopulateFromTarball_refusesEscapes(t *testing.T) {
+	var testCases = []struct {
+		desc    string
+		entries []tarEntry
+	}{
+		{
+			desc: "dot-dot",
+			entries: []tarEntry{
+				{hdr: tar.Header{Name: "../x", Typeflag: tar.TypeReg, Mode: 0644}},
+			},
+		},
+		{
+			desc: "through symlink",
+			entries: []tarEntry{
+				{hdr: tar.Header{Name: "out", Typeflag: tar.TypeSymlink, Linkname: "/tmp"}},
+				{hdr: tar.Header{Name: "out/golvm-escaped", Typeflag: tar.TypeReg, Mode: 0644}},
+			},
+		},
+		{
+			desc: "hard link to the outside",
+			entries: []tarEntry{
+				{hdr: tar.Header{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			dst, err := ioutil.TempDir("", "golvm-populate-dst")
+			require.NoError(t, err)
+			defer os.RemoveAll(dst)
+
+			err = PopulateFromTarball(bytes.NewReader(writeTarball(t, tc.entries, false)), dst)
+			assert.Error(t, err)
+
+			_, err = os.Lstat("/tmp/golvm-escaped")
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestPopulateFromTarball_replacesSymlinks(t *testing.T) {
+	var entries = []tarEntry{
+		{hdr: tar.Header{Name: "file", Typeflag: tar.TypeSymlink, Linkname: "/tmp/golvm-escaped"}},
+		{hdr: tar.Header{Name: "file", Typeflag: tar.TypeReg, Mode: 0644}, content: "content"},
+	}
+
+	dst, err := ioutil.TempDir("", "golvm-populate-dst")
+	require.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	require.NoError(t, PopulateFromTarball(bytes.NewReader(writeTarball(t, entries, false)), dst))
+
+	info, err := os.Lstat(filepath.Join(dst, "file"))
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+
+	_, err = os.Lstat("/tmp/golvm-escaped")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPopulateFromDirectory(t *testing.T) {
+	src, err := ioutil.TempDir("", "golvm-populate-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "golvm-populate-dst")
+	require.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "dir", "sub"), 0750))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("content"), 0640))
+	require.NoError(t, os.Link(filepath.Join(src, "dir", "file"), filepath.Join(src, "hardlink")))
+	require.NoError(t, os.Symlink("dir/file", filepath.Join(src, "link")))
+
+	xattrs := unix.Lsetxattr(filepath.Join(src, "dir", "file"), "user.golvm", []byte("value"), 0) == nil
+
+	require.NoError(t, PopulateFromDirectory(src, dst))
+
+	content, err := ioutil.ReadFile(filepath.Join(dst, "dir", "file"))
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+
+	info, err := os.Stat(filepath.Join(dst, "dir", "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+	file, err := os.Stat(filepath.Join(dst, "dir", "file"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), file.Mode().Perm())
+	assert.Equal(t, uint64(2), uint64(file.Sys().(*syscall.Stat_t).Nlink))
+
+	hardlink, err := os.Stat(filepath.Join(dst, "hardlink"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(file, hardlink))
+
+	link, err := os.Readlink(filepath.Join(dst, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "dir/file", link)
+
+	if xattrs {
+		value := make([]byte, 16)
+		size, err := unix.Lgetxattr(filepath.Join(dst, "dir", "file"), "user.golvm", value)
+		require.NoError(t, err)
+		assert.Equal(t, "value", string(value[:size]))
+	}
+}
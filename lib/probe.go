@@ -0,0 +1,283 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// FsSignature describes the filesystem (or container, like
+// LUKS and swap) found in a device.
+type FsSignature struct {
+	// Type follows the names used by blkid (e.g., 'ext4',
+	// 'xfs', 'crypto_LUKS' and 'swap').
+	Type  string
+	UUID  string
+	Label string
+}
+
+// IsFilesystem indicates whether the signature is of a
+// filesystem rather than a container (LUKS) or swap.
+func (s FsSignature) IsFilesystem() bool {
+	return s.Type != "crypto_LUKS" && s.Type != "swap"
+}
+
+// fsProber looks for a given signature in a device, returning
+// nil if it's not there.
+type fsProber func(r io.ReaderAt) (*FsSignature, error)
+
+const (
+	extSuperblockOffset   = 1024
+	btrfsSuperblockOffset = 0x10000
+
+	extFeatureCompatHasJournal = 0x4
+
+	// extFeatureIncompatExt4 groups the incompatible features
+	// that only ext4 has (extents, 64bit, mmp, flex_bg,
+	// large xattrs in inodes, inline data and others).
+	extFeatureIncompatExt4 = 0x40 | 0x80 | 0x100 | 0x200 |
+		0x400 | 0x1000 | 0x2000 | 0x8000 | 0x10000
+
+	// extFeatureRoCompatExt4 groups the read-only compatible
+	// features that only ext4 has (huge_file, gdt_csum,
+	// dir_nlink, extra_isize and metadata_csum amongst
+	// others).
+	extFeatureRoCompatExt4 = 0x8 | 0x10 | 0x20 | 0x40 | 0x400
+)
+
+var (
+	// probers are tried in order. Signatures that live at
+	// the start of the device come first as they might
+	// overwrite the superblocks of the others.
+	probers = []fsProber{
+		probeLuks,
+		probeXfs,
+		probeExt,
+		probeBtrfs,
+		probeSwap,
+	}
+
+	// swapPageSizes are the page sizes whose last bytes
+	// might hold the swap signature.
+	swapPageSizes = []int64{4096, 8192, 16384, 65536}
+)
+
+// ProbeDevice reads the superblock of a device looking for a
+// known filesystem signature. If none is found, a nil
+// signature is returned with no errors.
+func ProbeDevice(device string) (sig *FsSignature, err error) {
+	var file *os.File
+
+	if device == "" {
+		err = errors.Errorf("a device must be specified")
+		return
+	}
+
+	file, err = os.Open(device)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't open device %s for probing", device)
+		return
+	}
+	defer file.Close()
+
+	sig, err = ProbeFilesystem(file)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to probe device %s", device)
+		return
+	}
+
+	return
+}
+
+// ProbeFilesystem looks for the signatures of ext2/3/4, XFS,
+// btrfs, LUKS and swap in 'r'.
+func ProbeFilesystem(r io.ReaderAt) (sig *FsSignature, err error) {
+	for _, probe := range probers {
+		sig, err = probe(r)
+		if err != nil || sig != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// readAt reads 'size' bytes at 'offset'. Devices smaller than
+// the region read yield a nil slice with no errors such that
+// they're treated as not having the signature.
+func readAt(r io.ReaderAt, offset, size int64) (buf []byte, err error) {
+	buf = make([]byte, size)
+
+	_, err = r.ReadAt(buf, offset)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		buf, err = nil, nil
+		return
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't read %d bytes at offset %d", size, offset)
+		return
+	}
+
+	return
+}
+
+// formatUUID formats 16 raw bytes as a UUID string. All-zero
+// UUIDs are considered unset.
+func formatUUID(raw []byte) string {
+	if bytes.Equal(raw, make([]byte, len(raw))) {
+		return ""
+	}
+
+	var h = hex.EncodeToString(raw)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// cString trims a NUL-padded string.
+func cString(raw []byte) string {
+	if i := bytes.IndexByte(raw, 0); i >= 0 {
+		raw = raw[:i]
+	}
+
+	return string(raw)
+}
+
+// probeExt checks for the 0xEF53 magic of the ext superblock,
+// telling the versions apart by their feature flags.
+func probeExt(r io.ReaderAt) (sig *FsSignature, err error) {
+	sb, err := readAt(r, extSuperblockOffset, 1024)
+	if err != nil || sb == nil {
+		return
+	}
+
+	if binary.LittleEndian.Uint16(sb[0x38:]) != 0xEF53 {
+		return
+	}
+
+	var (
+		compat   = binary.LittleEndian.Uint32(sb[0x5C:])
+		incompat = binary.LittleEndian.Uint32(sb[0x60:])
+		roCompat = binary.LittleEndian.Uint32(sb[0x64:])
+	)
+
+	sig = &FsSignature{
+		Type:  "ext2",
+		UUID:  formatUUID(sb[0x68:0x78]),
+		Label: cString(sb[0x78:0x88]),
+	}
+
+	switch {
+	case incompat&extFeatureIncompatExt4 != 0 || roCompat&extFeatureRoCompatExt4 != 0:
+		sig.Type = "ext4"
+	case compat&extFeatureCompatHasJournal != 0:
+		sig.Type = "ext3"
+	}
+
+	return
+}
+
+// probeXfs checks for the 'XFSB' magic at the start of the
+// device.
+func probeXfs(r io.ReaderAt) (sig *FsSignature, err error) {
+	sb, err := readAt(r, 0, 120)
+	if err != nil || sb == nil {
+		return
+	}
+
+	if !bytes.Equal(sb[0:4], []byte("XFSB")) {
+		return
+	}
+
+	sig = &FsSignature{
+		Type:  "xfs",
+		UUID:  formatUUID(sb[32:48]),
+		Label: cString(sb[108:120]),
+	}
+	return
+}
+
+// probeBtrfs checks for the '_BHRfS_M' magic of the primary
+// superblock, which lives at 64KiB.
+func probeBtrfs(r io.ReaderAt) (sig *FsSignature, err error) {
+	sb, err := readAt(r, btrfsSuperblockOffset, 0x22b)
+	if err != nil || sb == nil {
+		return
+	}
+
+	if !bytes.Equal(sb[0x40:0x48], []byte("_BHRfS_M")) {
+		return
+	}
+
+	sig = &FsSignature{
+		Type:  "btrfs",
+		UUID:  formatUUID(sb[0x20:0x30]),
+		Label: cString(sb[0x12b:0x22b]),
+	}
+	return
+}
+
+// probeLuks checks for the 'LUKS\xba\xbe' magic of the LUKS
+// header. Both LUKS1 and LUKS2 store the UUID as a string;
+// only LUKS2 has a label.
+func probeLuks(r io.ReaderAt) (sig *FsSignature, err error) {
+	hdr, err := readAt(r, 0, 208)
+	if err != nil || hdr == nil {
+		return
+	}
+
+	if !bytes.Equal(hdr[0:6], []byte("LUKS\xba\xbe")) {
+		return
+	}
+
+	sig = &FsSignature{
+		Type: "crypto_LUKS",
+		UUID: cString(hdr[168:208]),
+	}
+
+	if binary.BigEndian.Uint16(hdr[6:8]) == 2 {
+		sig.Label = cString(hdr[24:72])
+	}
+
+	return
+}
+
+// probeSwap checks for the 'SWAPSPACE2' magic at the end of
+// the first page, whose size depends on the architecture.
+func probeSwap(r io.ReaderAt) (sig *FsSignature, err error) {
+	var magic, hdr []byte
+
+	for _, pageSize := range swapPageSizes {
+		magic, err = readAt(r, pageSize-10, 10)
+		if err != nil || magic == nil {
+			return
+		}
+
+		if !bytes.Equal(magic, []byte("SWAPSPACE2")) {
+			continue
+		}
+
+		// the header follows the first 1KiB, reserved for
+		// boot bits: version, last page and number of bad
+		// pages precede the UUID and the label.
+		hdr, err = readAt(r, 1024, 44)
+		if err != nil || hdr == nil {
+			return
+		}
+
+		sig = &FsSignature{
+			Type:  "swap",
+			UUID:  formatUUID(hdr[12:28]),
+			Label: cString(hdr[28:44]),
+		}
+		return
+	}
+
+	return
+}
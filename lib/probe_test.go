@@ -0,0 +1,162 @@
+package lib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gunzipImage decompresses a filesystem image from
+// 'testdata/fs' into a temporary file, returning its path.
+// The ext and swap images were made with mkfs and mkswap
+// against small sparse files. The xfs, btrfs and LUKS ones
+// only hold the superblocks (and LUKS2's secondary header),
+// laid out as mkfs.xfs, mkfs.btrfs and cryptsetup write them.
+func gunzipImage(t *testing.T, name string) string {
+	compressed, err := os.Open(filepath.Join("testdata", "fs", name+".img.gz"))
+	require.NoError(t, err)
+	defer compressed.Close()
+
+	reader, err := gzip.NewReader(compressed)
+	require.NoError(t, err)
+
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+
+	return writeImage(t, content)
+}
+
+// writeImage writes the content of an image to a temporary
+// file, returning its path.
+func writeImage(t *testing.T, content []byte) string {
+	file, err := ioutil.TempFile("", "golvm-probe")
+	require.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.Write(content)
+	require.NoError(t, err)
+
+	return file.Name()
+}
+
+func TestProbeDevice(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		image    func(t *testing.T) string
+		expected *FsSignature
+	}{
+		{
+			desc:  "ext2",
+			image: func(t *testing.T) string { return gunzipImage(t, "ext2") },
+			expected: &FsSignature{
+				Type:  "ext2",
+				UUID:  "0e3a1d2c-5b4f-4a6e-9c8d-7f1e2d3c4b52",
+				Label: "vol-ext2",
+			},
+		},
+		{
+			desc:  "ext3",
+			image: func(t *testing.T) string { return gunzipImage(t, "ext3") },
+			expected: &FsSignature{
+				Type:  "ext3",
+				UUID:  "0e3a1d2c-5b4f-4a6e-9c8d-7f1e2d3c4b53",
+				Label: "vol-ext3",
+			},
+		},
+		{
+			desc:  "ext4",
+			image: func(t *testing.T) string { return gunzipImage(t, "ext4") },
+			expected: &FsSignature{
+				Type:  "ext4",
+				UUID:  "0e3a1d2c-5b4f-4a6e-9c8d-7f1e2d3c4b54",
+				Label: "vol-ext4",
+			},
+		},
+		{
+			desc:  "swap",
+			image: func(t *testing.T) string { return gunzipImage(t, "swap") },
+			expected: &FsSignature{
+				Type:  "swap",
+				UUID:  "6a1e2f3d-4c5b-4a69-8d7e-1f2e3d4c5b6a",
+				Label: "myswap",
+			},
+		},
+		{
+			desc:  "xfs",
+			image: func(t *testing.T) string { return gunzipImage(t, "xfs") },
+			expected: &FsSignature{
+				Type:  "xfs",
+				UUID:  "7b1c2d3e-4f50-4612-8a3b-4c5d6e7f8091",
+				Label: "vol-xfs",
+			},
+		},
+		{
+			desc:  "btrfs",
+			image: func(t *testing.T) string { return gunzipImage(t, "btrfs") },
+			expected: &FsSignature{
+				Type:  "btrfs",
+				UUID:  "7b1c2d3e-4f50-4612-8a3b-4c5d6e7f8092",
+				Label: "vol-btrfs",
+			},
+		},
+		{
+			desc:  "luks1 has no label",
+			image: func(t *testing.T) string { return gunzipImage(t, "luks1") },
+			expected: &FsSignature{
+				Type: "crypto_LUKS",
+				UUID: "7b1c2d3e-4f50-4612-8a3b-4c5d6e7f8093",
+			},
+		},
+		{
+			desc:  "luks2",
+			image: func(t *testing.T) string { return gunzipImage(t, "luks2") },
+			expected: &FsSignature{
+				Type:  "crypto_LUKS",
+				UUID:  "7b1c2d3e-4f50-4612-8a3b-4c5d6e7f8094",
+				Label: "vol-luks2",
+			},
+		},
+		{
+			desc:     "blank device",
+			image:    func(t *testing.T) string { return writeImage(t, make([]byte, 1<<20)) },
+			expected: nil,
+		},
+		{
+			desc:     "device smaller than superblocks",
+			image:    func(t *testing.T) string { return writeImage(t, []byte("tiny")) },
+			expected: nil,
+		},
+		{
+			desc: "data that doesn't hold a signature",
+			image: func(t *testing.T) string {
+				return writeImage(t, bytes.Repeat([]byte("golvm"), 1<<16))
+			},
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			device := tc.image(t)
+			defer os.Remove(device)
+
+			sig, err := ProbeDevice(device)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, sig)
+		})
+	}
+}
+
+func TestProbeDevice_failsWithInexistentDevice(t *testing.T) {
+	_, err := ProbeDevice("/inexistent/device")
+	assert.Error(t, err)
+
+	_, err = ProbeDevice("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LvQuery describes the logical volumes to look up. Empty
+// fields match any volume; all the non-empty ones must match.
+type LvQuery struct {
+	Name        string
+	VolumeGroup string
+
+	// Tags that the volume must have (it might have others).
+	Tags []string
+
+	Pool   string
+	Origin string
+}
+
+// ParseLvQueryName builds a query out of a volume reference.
+// References can either be a bare 'lv' name or a 'vg/lv'
+// name, which matches a single volume.
+func ParseLvQueryName(name string) (q LvQuery, err error) {
+	var parts = strings.Split(name, "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		q.Name = parts[0]
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		q.VolumeGroup = parts[0]
+		q.Name = parts[1]
+	default:
+		err = errors.Errorf(
+			"malformed volume name '%s' - must be 'lv' or 'vg/lv'", name)
+		return
+	}
+
+	return
+}
+
+// quoteSelectValue quotes a value to be used in a selection
+// criteria. As lvm doesn't support escaping, values that
+// contain both types of quotes are rejected.
+func quoteSelectValue(value string) (quoted string, err error) {
+	switch {
+	case !strings.Contains(value, `"`):
+		quoted = `"` + value + `"`
+	case !strings.Contains(value, "'"):
+		quoted = "'" + value + "'"
+	default:
+		err = errors.Errorf(
+			"value '%s' can't contain both types of quotes", value)
+	}
+
+	return
+}
+
+// Select compiles the query into an lvm2 selection criteria
+// (see lvmreport(7)) to be passed to '--select'. An empty
+// query compiles to an empty criteria.
+func (q LvQuery) Select() (selection string, err error) {
+	var (
+		criteria = []string{}
+		fields   = []struct {
+			field string
+			value string
+		}{
+			{"lv_name", q.Name},
+			{"vg_name", q.VolumeGroup},
+			{"pool_lv", q.Pool},
+			{"origin", q.Origin},
+		}
+		quoted string
+	)
+
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+
+		quoted, err = quoteSelectValue(f.value)
+		if err != nil {
+			return
+		}
+
+		criteria = append(criteria, f.field+"="+quoted)
+	}
+
+	if len(q.Tags) > 0 {
+		var tags = make([]string, 0, len(q.Tags))
+
+		for _, tag := range q.Tags {
+			quoted, err = quoteSelectValue(tag)
+			if err != nil {
+				return
+			}
+
+			tags = append(tags, quoted)
+		}
+
+		// curly braces perform a subset match while square
+		// brackets would require the exact set of tags.
+		criteria = append(criteria,
+			"lv_tags={"+strings.Join(tags, " && ")+"}")
+	}
+
+	selection = strings.Join(criteria, " && ")
+	return
+}
+
+// Matches evaluates the query against a logical volume in
+// the same way that lvm evaluates the compiled selection.
+func (q LvQuery) Matches(vol *LogicalVolume) bool {
+	if q.Name != "" && vol.LvName != q.Name {
+		return false
+	}
+
+	if q.VolumeGroup != "" && vol.VgName != q.VolumeGroup {
+		return false
+	}
+
+	if q.Pool != "" && vol.PoolLv != q.Pool {
+		return false
+	}
+
+	if q.Origin != "" && vol.Origin != q.Origin {
+		return false
+	}
+
+	for _, tag := range q.Tags {
+		if !vol.LvTags.Contains(tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// singleLogicalVolume picks the only volume found by a
+// lookup, erroring if the name is ambiguous.
+func singleLogicalVolume(name string, vols []*LogicalVolume) (vol *LogicalVolume, err error) {
+	switch len(vols) {
+	case 0:
+		return
+	case 1:
+		vol = vols[0]
+		return
+	}
+
+	var names = make([]string, 0, len(vols))
+	for _, candidate := range vols {
+		names = append(names, candidate.VgName+"/"+candidate.LvName)
+	}
+
+	err = errors.Errorf(
+		"volume name '%s' is ambiguous (%s) - use 'vg/lv' instead",
+		name, strings.Join(names, ", "))
+	return
+}
@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLvQueryName(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    LvQuery
+		shouldError bool
+	}{
+		{
+			desc:        "empty name should fail",
+			input:       "",
+			shouldError: true,
+		},
+		{
+			desc:     "bare name",
+			input:    "lv",
+			expected: LvQuery{Name: "lv"},
+		},
+		{
+			desc:     "vg/lv name",
+			input:    "vg/lv",
+			expected: LvQuery{Name: "lv", VolumeGroup: "vg"},
+		},
+		{
+			desc:        "missing lv should fail",
+			input:       "vg/",
+			shouldError: true,
+		},
+		{
+			desc:        "too many components should fail",
+			input:       "a/b/c",
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseLvQueryName(tc.input)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestLvQuerySelect(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		query       LvQuery
+		expected    string
+		shouldError bool
+	}{
+		{
+			desc:     "empty query",
+			query:    LvQuery{},
+			expected: "",
+		},
+		{
+			desc:     "name only",
+			query:    LvQuery{Name: "lv1"},
+			expected: `lv_name="lv1"`,
+		},
+		{
+			desc: "all fields",
+			query: LvQuery{
+				Name:        "lv1",
+				VolumeGroup: "vg",
+				Pool:        "pool",
+				Origin:      "origin",
+				Tags:        []string{"a", "b"},
+			},
+			expected: `lv_name="lv1" && vg_name="vg" && pool_lv="pool" && ` +
+				`origin="origin" && lv_tags={"a" && "b"}`,
+		},
+		{
+			desc:     "value with double quotes",
+			query:    LvQuery{Name: `l"v`},
+			expected: `lv_name='l"v'`,
+		},
+		{
+			desc:        "value with both quotes should fail",
+			query:       LvQuery{Tags: []string{`'"`}},
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := tc.query.Select()
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestLvQueryMatches(t *testing.T) {
+	var vol = &LogicalVolume{
+		LvName: "lv1",
+		VgName: "vg",
+		PoolLv: "pool",
+		Origin: "origin",
+		LvTags: StringList{"a", "b", "c"},
+	}
+
+	assert.True(t, LvQuery{}.Matches(vol))
+	assert.True(t, LvQuery{Name: "lv1", VolumeGroup: "vg"}.Matches(vol))
+	assert.True(t, LvQuery{Tags: []string{"a", "c"}}.Matches(vol))
+	assert.True(t, LvQuery{Pool: "pool", Origin: "origin"}.Matches(vol))
+	assert.False(t, LvQuery{Name: "lv2"}.Matches(vol))
+	assert.False(t, LvQuery{VolumeGroup: "vg2"}.Matches(vol))
+	assert.False(t, LvQuery{Tags: []string{"a", "d"}}.Matches(vol))
+	assert.False(t, LvQuery{Pool: "other"}.Matches(vol))
+	assert.False(t, LvQuery{Origin: "other"}.Matches(vol))
+}
@@ -0,0 +1,232 @@
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReportKind describes one of lvm's reports: the command that
+// produces it and the key under which its rows show up in the
+// JSON output.
+type ReportKind struct {
+	Command string
+	Args    []string
+
+	// Keys are tried in order as some versions of lvm2 put
+	// the rows of a report under different keys (e.g.,
+	// 'lvs --segments' under either 'seg' or 'lv').
+	Keys []string
+}
+
+var (
+	ReportPhysicalVolumes = ReportKind{
+		Command: "pvs",
+		Keys:    []string{"pv"},
+	}
+
+	ReportVolumeGroups = ReportKind{
+		Command: "vgs",
+		Keys:    []string{"vg"},
+	}
+
+	ReportLogicalVolumes = ReportKind{
+		Command: "lvs",
+		Keys:    []string{"lv"},
+	}
+
+	ReportLogicalVolumeSegments = ReportKind{
+		Command: "lvs",
+		Args:    []string{"--all", "--segments"},
+		Keys:    []string{"seg", "lv"},
+	}
+)
+
+// reportRowType retrieves the struct type of the rows that
+// 'out' (a pointer to a slice of structs or of pointers to
+// structs) holds.
+func reportRowType(out interface{}) (rowType reflect.Type, err error) {
+	var t = reflect.TypeOf(out)
+
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice {
+		err = errors.Errorf(
+			"out must be a pointer to a slice - got %T", out)
+		return
+	}
+
+	rowType = t.Elem().Elem()
+	if rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+
+	if rowType.Kind() != reflect.Struct {
+		err = errors.Errorf(
+			"out must be a pointer to a slice of structs - got %T", out)
+		return
+	}
+
+	return
+}
+
+// collectReportFields gathers the json tags of a struct,
+// descending into embedded structs.
+func collectReportFields(t reflect.Type, seen map[string]bool, fields []string) []string {
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			field = t.Field(i)
+			name  = strings.Split(field.Tag.Get("json"), ",")[0]
+		)
+
+		if field.Anonymous && name == "" {
+			var embedded = field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				fields = collectReportFields(embedded, seen, fields)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" || name == "" || name == "-" || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		fields = append(fields, name)
+	}
+
+	return fields
+}
+
+// ReportFields derives the list of lvm fields to request
+// (the '--options' of a report) from the json tags of the
+// rows that 'out' holds. For instance, a
+// '*[]struct{ Uuid string `json:"lv_uuid"` }' requests
+// 'lv_uuid'.
+func ReportFields(out interface{}) (fields []string, err error) {
+	var rowType reflect.Type
+
+	rowType, err = reportRowType(out)
+	if err != nil {
+		return
+	}
+
+	fields = collectReportFields(rowType, map[string]bool{}, []string{})
+	if len(fields) == 0 {
+		err = errors.Errorf(
+			"%s has no json-tagged fields", rowType)
+		return
+	}
+
+	return
+}
+
+// reportOptions builds the '--options' argument for the
+// built-in row types, whose fields are known to be valid.
+func reportOptions(out interface{}) string {
+	fields, _ := ReportFields(out)
+	return "--options=" + strings.Join(fields, ",")
+}
+
+// DecodeReport decodes the rows of a report into 'out', a
+// pointer to a slice of (pointers to) structs, looking for
+// them under each of 'keys'.
+func DecodeReport(response []byte, keys []string, out interface{}) (err error) {
+	var report struct {
+		Report []map[string]json.RawMessage `json:"report"`
+	}
+
+	if len(response) == 0 {
+		err = errors.Errorf("can't decode empty response")
+		return
+	}
+
+	_, err = reportRowType(out)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &report)
+	if err != nil {
+		err = errors.Wrapf(err, "errored decoding report")
+		return
+	}
+
+	if len(report.Report) != 1 {
+		err = errors.Errorf(
+			"unexpected number of responses decoded - %s",
+			response)
+		return
+	}
+
+	for _, key := range keys {
+		rows, found := report.Report[0][key]
+		if !found {
+			continue
+		}
+
+		err = json.Unmarshal(rows, out)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"errored decoding report rows under '%s'", key)
+			return
+		}
+
+		return
+	}
+
+	err = errors.Errorf(
+		"report doesn't contain any of the keys %v", keys)
+	return
+}
+
+// Report runs the report of a given kind requesting the
+// fields derived from the struct tags of 'out' (see
+// ReportFields) and decodes the rows into it.
+// Sizes are reported in bytes, such that fields of type
+// ByteSize decode properly. If 'selection' is non-empty, only
+// the objects matching it are reported (see LvQuery.Select).
+func (l Lvm) Report(kind ReportKind, selection string, out interface{}) (err error) {
+	var (
+		fields []string
+		output []byte
+		args   []string
+	)
+
+	fields, err = ReportFields(out)
+	if err != nil {
+		return
+	}
+
+	args = append(args, kind.Args...)
+	args = append(args,
+		"--units=b",
+		"--nosuffix",
+		"--noheadings",
+		"--options="+strings.Join(fields, ","),
+		"--report-format="+l.reportFormat)
+
+	if selection != "" {
+		args = append(args, "--select", selection)
+	}
+
+	output, err = l.Run(kind.Command, args...)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to retrieve %s report", kind.Command)
+		return
+	}
+
+	err = DecodeReport(output, kind.Keys, out)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to decode %s report", kind.Command)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	// ReportFormatJson is the original JSON report format
+	// (lvm2 >= 2.02.158) where every value is a string.
+	ReportFormatJson = "json"
+
+	// ReportFormatJsonStd is the standard-conforming JSON
+	// report format (lvm2 >= 2.03.17) where numbers are
+	// reported as JSON numbers and undefined values as null.
+	ReportFormatJsonStd = "json_std"
+
+	// ReportFormatAuto makes NewLvm probe the installed lvm2
+	// for the best report format it supports.
+	ReportFormatAuto = "auto"
+)
+
+// validateReportFormat makes sure that the report format
+// specified in the configuration is one we know how to
+// decode.
+func validateReportFormat(format string) (err error) {
+	switch format {
+	case "", ReportFormatJson, ReportFormatJsonStd, ReportFormatAuto:
+		return
+	}
+
+	err = errors.Errorf(
+		"unsupported report format %s - must be one of %s, %s or %s",
+		format, ReportFormatJson, ReportFormatJsonStd, ReportFormatAuto)
+	return
+}
+
+// DetectReportFormat probes the installed lvm2 for the best
+// report format it supports. As older versions reject the
+// 'json_std' format right away, a cheap 'lvs' invocation is
+// enough to tell them apart.
+func (l Lvm) DetectReportFormat() (format string) {
+	_, err := l.Run("lvs",
+		"--noheadings",
+		"--options=lv_name",
+		"--report-format="+ReportFormatJsonStd)
+	if err != nil {
+		l.logger.Debug().
+			Err(err).
+			Msg("json_std report format not supported")
+		format = ReportFormatJson
+		return
+	}
+
+	format = ReportFormatJsonStd
+	return
+}
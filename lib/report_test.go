@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type customLvRow struct {
+	Uuid string     `json:"lv_uuid"`
+	Time string     `json:"lv_time"`
+	Tags StringList `json:"lv_tags"`
+}
+
+type customVgRow struct {
+	customLvRow
+	ExtentSize ByteSize `json:"vg_extent_size"`
+	Uuid       string   `json:"lv_uuid"`
+	Ignored    string   `json:"-"`
+	Untagged   string
+}
+
+// cannedRunner returns a fixed output, recording the last
+// command executed.
+type cannedRunner struct {
+	output []byte
+	name   string
+	args   []string
+}
+
+func (r *cannedRunner) Run(name string, args ...string) ([]byte, error) {
+	r.name = name
+	r.args = args
+	return r.output, nil
+}
+
+func TestReportFields(t *testing.T) {
+	fields, err := ReportFields(&[]*customLvRow{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lv_uuid", "lv_time", "lv_tags"}, fields)
+
+	fields, err = ReportFields(&[]customVgRow{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lv_uuid", "lv_time", "lv_tags", "vg_extent_size"}, fields)
+
+	fields, err = ReportFields(&[]*LogicalVolumeSegment{})
+	require.NoError(t, err)
+	assert.Contains(t, fields, "seg_pe_ranges")
+
+	for _, out := range []interface{}{
+		nil,
+		[]customLvRow{},
+		&customLvRow{},
+		&[]string{},
+		&[]struct{ A string }{},
+	} {
+		_, err = ReportFields(out)
+		assert.Error(t, err)
+	}
+}
+
+func TestDecodeReport(t *testing.T) {
+	var (
+		rows     []*customLvRow
+		response = []byte(`{"report": [{"seg": [{"lv_uuid": "abc", "lv_time": "2018-01-01 10:00:00 +0000", "lv_tags": "a,b"}]}]}`)
+	)
+
+	err := DecodeReport(response, []string{"lv"}, &rows)
+	assert.Error(t, err)
+
+	err = DecodeReport(response, []string{"lv", "seg"}, &rows)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "abc", rows[0].Uuid)
+	assert.Equal(t, "2018-01-01 10:00:00 +0000", rows[0].Time)
+	assert.Equal(t, StringList{"a", "b"}, rows[0].Tags)
+
+	err = DecodeReport(nil, []string{"lv"}, &rows)
+	assert.Error(t, err)
+
+	err = DecodeReport(response, []string{"seg"}, rows)
+	assert.Error(t, err)
+}
+
+func TestLvmReport(t *testing.T) {
+	var (
+		rows   []customVgRow
+		runner = &cannedRunner{
+			output: []byte(`{"report": [{"vg": [{"vg_extent_size": 4194304, "lv_uuid": "abc"}]}]}`),
+		}
+		l = Lvm{
+			logger:       zerolog.Nop(),
+			runner:       runner,
+			reportFormat: ReportFormatJsonStd,
+		}
+	)
+
+	err := l.Report(ReportVolumeGroups, `vg_name="vg"`, &rows)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, ByteSize(4194304), rows[0].ExtentSize)
+	assert.Equal(t, "abc", rows[0].Uuid)
+
+	assert.Equal(t, "vgs", runner.name)
+	assert.Equal(t, []string{
+		"--units=b",
+		"--nosuffix",
+		"--noheadings",
+		"--options=lv_uuid,lv_time,lv_tags,vg_extent_size",
+		"--report-format=json_std",
+		"--select", `vg_name="vg"`,
+	}, runner.args)
+}
@@ -0,0 +1,36 @@
+package lib
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Runner executes the commands that the Lvm helper needs
+// (lvm2 tools, cryptsetup, mkfs and friends).
+type Runner interface {
+	// Run executes the command 'name' with arguments
+	// 'args' and returns its output.
+	Run(name string, args ...string) (out []byte, err error)
+}
+
+// ExecRunner runs each command in its own process.
+// The executed commands inherit the parent environment.
+type ExecRunner struct{}
+
+// Run forks and executes a given command whose executable is
+// 'name' and whose arguments are 'args', returning both its
+// standard output and standard error.
+func (r ExecRunner) Run(name string, args ...string) (out []byte, err error) {
+	cmd := exec.Command(name, args...)
+
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to execute command '%s' with args '%+v'. Output:\n%s\n",
+			name, args, string(out))
+		return
+	}
+
+	return
+}
@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// splitList splits the list-like fields that lvm reports
+// for segments. Depending on the version, items come
+// separated by commas or by spaces.
+func splitList(list string) (items []string) {
+	items = strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	return
+}
+
+// ParsePeRanges parses the 'seg_pe_ranges' field of a segment
+// (e.g., "/dev/sdb:0-255 /dev/sdc:0-255") into a list of
+// PeRange structs.
+func ParsePeRanges(ranges string) (parsed []*PeRange, err error) {
+	var (
+		colon  int
+		bounds []string
+		rng    *PeRange
+	)
+
+	parsed = make([]*PeRange, 0)
+	for _, item := range splitList(ranges) {
+		colon = strings.LastIndex(item, ":")
+		if colon <= 0 {
+			err = errors.Errorf(
+				"malformed pe range '%s'", item)
+			return
+		}
+
+		bounds = strings.SplitN(item[colon+1:], "-", 2)
+		if len(bounds) != 2 {
+			err = errors.Errorf(
+				"malformed pe range '%s' - expected start-end",
+				item)
+			return
+		}
+
+		rng = &PeRange{
+			Device: item[:colon],
+		}
+
+		rng.Start, err = strconv.ParseUint(bounds[0], 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"malformed start of pe range '%s'", item)
+			return
+		}
+
+		rng.End, err = strconv.ParseUint(bounds[1], 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"malformed end of pe range '%s'", item)
+			return
+		}
+
+		parsed = append(parsed, rng)
+	}
+
+	return
+}
+
+// ParseSegmentDevices parses the 'devices' field of a segment
+// (e.g., "/dev/sdb(0),/dev/sdc(0)") into a list of SegmentDevice
+// structs.
+func ParseSegmentDevices(devices string) (parsed []*SegmentDevice, err error) {
+	var (
+		paren int
+		dev   *SegmentDevice
+	)
+
+	parsed = make([]*SegmentDevice, 0)
+	for _, item := range splitList(devices) {
+		paren = strings.LastIndex(item, "(")
+		if paren <= 0 || !strings.HasSuffix(item, ")") {
+			err = errors.Errorf(
+				"malformed segment device '%s'", item)
+			return
+		}
+
+		dev = &SegmentDevice{
+			Device: item[:paren],
+		}
+
+		dev.StartExtent, err = strconv.ParseUint(
+			item[paren+1:len(item)-1], 10, 64)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"malformed extent of segment device '%s'",
+				item)
+			return
+		}
+
+		parsed = append(parsed, dev)
+	}
+
+	return
+}
+
+// normalizeLvName removes the brackets that lvm puts
+// around the names of hidden (internal) logical volumes.
+func normalizeLvName(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, "["), "]")
+}
+
+// PhysicalVolumesOf resolves the set of physical volumes that
+// back a given logical volume. Segments that map to internal
+// logical volumes (raid images, thin pool data, ...) are
+// followed recursively (thin volumes through their pool), so
+// 'segs' should contain the segments of hidden volumes as well
+// (see ListLogicalVolumeSegments).
+// The result is sorted and free of duplicates.
+func PhysicalVolumesOf(segs []*LogicalVolumeSegment, vgName, lvName string) (pvs []string, err error) {
+	var (
+		found   = make(map[string]bool)
+		visited = make(map[string]bool)
+	)
+
+	err = collectPhysicalVolumes(segs, vgName, normalizeLvName(lvName), found, visited)
+	if err != nil {
+		return
+	}
+
+	pvs = make([]string, 0, len(found))
+	for pv := range found {
+		pvs = append(pvs, pv)
+	}
+	sort.Strings(pvs)
+
+	return
+}
+
+func collectPhysicalVolumes(segs []*LogicalVolumeSegment, vgName, lvName string, found, visited map[string]bool) (err error) {
+	var (
+		devices []*SegmentDevice
+		hasSegs bool
+	)
+
+	if visited[lvName] {
+		return
+	}
+	visited[lvName] = true
+
+	for _, seg := range segs {
+		if seg.VgName != vgName || normalizeLvName(seg.LvName) != lvName {
+			continue
+		}
+
+		hasSegs = true
+
+		// thin volumes map to the data of their pool
+		if seg.SegType == "thin" {
+			if seg.PoolLv == "" {
+				err = errors.Errorf(
+					"can't find the thin pool of %s/%s",
+					vgName, lvName)
+				return
+			}
+
+			err = collectPhysicalVolumes(segs, vgName,
+				normalizeLvName(seg.PoolLv), found, visited)
+			if err != nil {
+				return
+			}
+
+			continue
+		}
+
+		devices, err = ParseSegmentDevices(seg.Devices)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't parse devices of %s/%s",
+				vgName, lvName)
+			return
+		}
+
+		for _, dev := range devices {
+			if strings.HasPrefix(dev.Device, "/") {
+				found[dev.Device] = true
+				continue
+			}
+
+			err = collectPhysicalVolumes(segs, vgName,
+				normalizeLvName(dev.Device), found, visited)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if !hasSegs {
+		err = errors.Errorf(
+			"no segments found for %s/%s",
+			vgName, lvName)
+		return
+	}
+
+	return
+}
+
+// PhysicalVolumesAvoiding lists the physical volumes of a volume
+// group that don't back the logical volume 'avoidLv'. It allows
+// placing a volume in a different failure domain than another.
+func PhysicalVolumesAvoiding(pvs []*PhysicalVolume, segs []*LogicalVolumeSegment, vgName, avoidLv string) (candidates []string, err error) {
+	var (
+		used     []string
+		usedByLv = make(map[string]bool)
+	)
+
+	used, err = PhysicalVolumesOf(segs, vgName, avoidLv)
+	if err != nil {
+		return
+	}
+
+	for _, pv := range used {
+		usedByLv[pv] = true
+	}
+
+	candidates = make([]string, 0)
+	for _, pv := range pvs {
+		if pv.VolumeGroup != vgName || usedByLv[pv.PhysicalVolume] {
+			continue
+		}
+
+		candidates = append(candidates, pv.PhysicalVolume)
+	}
+
+	return
+}
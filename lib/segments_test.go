@@ -0,0 +1,223 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeRanges(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    []*PeRange
+		shouldError bool
+	}{
+		{
+			desc:     "empty gives no ranges",
+			input:    "",
+			expected: []*PeRange{},
+		},
+		{
+			desc:  "space separated ranges",
+			input: "/dev/sdb:0-255 /dev/sdc:10-20",
+			expected: []*PeRange{
+				{Device: "/dev/sdb", Start: 0, End: 255},
+				{Device: "/dev/sdc", Start: 10, End: 20},
+			},
+		},
+		{
+			desc:  "comma separated ranges of sub lvs",
+			input: "lv_rimage_0:0-24,lv_rimage_1:0-24",
+			expected: []*PeRange{
+				{Device: "lv_rimage_0", Start: 0, End: 24},
+				{Device: "lv_rimage_1", Start: 0, End: 24},
+			},
+		},
+		{
+			desc:        "missing device should fail",
+			input:       ":0-24",
+			shouldError: true,
+		},
+		{
+			desc:        "missing end should fail",
+			input:       "/dev/sdb:0",
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParsePeRanges(tc.input)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestParseSegmentDevices(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    []*SegmentDevice
+		shouldError bool
+	}{
+		{
+			desc:     "empty gives no devices",
+			input:    "",
+			expected: []*SegmentDevice{},
+		},
+		{
+			desc:  "multiple devices",
+			input: "/dev/sdb(0),/dev/sdc(128)",
+			expected: []*SegmentDevice{
+				{Device: "/dev/sdb", StartExtent: 0},
+				{Device: "/dev/sdc", StartExtent: 128},
+			},
+		},
+		{
+			desc:        "missing extent should fail",
+			input:       "/dev/sdb",
+			shouldError: true,
+		},
+		{
+			desc:        "non numeric extent should fail",
+			input:       "/dev/sdb(a)",
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseSegmentDevices(tc.input)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+var raidSegments = []*LogicalVolumeSegment{
+	{
+		LvName:  "linear",
+		VgName:  "vg",
+		SegType: "linear",
+		Devices: "/dev/sdd(0)",
+	},
+	{
+		LvName:  "mirrored",
+		VgName:  "vg",
+		SegType: "raid1",
+		Devices: "mirrored_rimage_0(0),mirrored_rimage_1(0)",
+	},
+	{
+		LvName:  "[mirrored_rimage_0]",
+		VgName:  "vg",
+		SegType: "linear",
+		Devices: "/dev/sdb(1)",
+	},
+	{
+		LvName:  "[mirrored_rimage_1]",
+		VgName:  "vg",
+		SegType: "linear",
+		Devices: "/dev/sdc(1)",
+	},
+	{
+		LvName:  "[mirrored_rmeta_0]",
+		VgName:  "vg",
+		SegType: "linear",
+		Devices: "/dev/sdb(0)",
+	},
+}
+
+func TestPhysicalVolumesOf(t *testing.T) {
+	pvs, err := PhysicalVolumesOf(raidSegments, "vg", "mirrored")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/sdb", "/dev/sdc"}, pvs)
+
+	pvs, err = PhysicalVolumesOf(raidSegments, "vg", "linear")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/sdd"}, pvs)
+
+	_, err = PhysicalVolumesOf(raidSegments, "othervg", "linear")
+	require.Error(t, err)
+}
+
+var thinSegments = []*LogicalVolumeSegment{
+	{
+		LvName:  "thinvol",
+		VgName:  "vg",
+		SegType: "thin",
+		PoolLv:  "pool",
+	},
+	{
+		LvName:  "orphanthin",
+		VgName:  "vg",
+		SegType: "thin",
+	},
+	{
+		LvName:  "pool",
+		VgName:  "vg",
+		SegType: "thin-pool",
+		Devices: "pool_tdata(0)",
+	},
+	{
+		LvName:  "[pool_tdata]",
+		VgName:  "vg",
+		SegType: "linear",
+		Devices: "/dev/sdb(10)",
+	},
+	{
+		LvName:  "[pool_tmeta]",
+		VgName:  "vg",
+		SegType: "linear",
+		Devices: "/dev/sdc(0)",
+	},
+}
+
+func TestPhysicalVolumesOf_thin(t *testing.T) {
+	pvs, err := PhysicalVolumesOf(thinSegments, "vg", "thinvol")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/sdb"}, pvs)
+
+	_, err = PhysicalVolumesOf(thinSegments, "vg", "orphanthin")
+	require.Error(t, err)
+}
+
+func TestPhysicalVolumesAvoiding(t *testing.T) {
+	var pvs = []*PhysicalVolume{
+		{PhysicalVolume: "/dev/sdb", VolumeGroup: "vg"},
+		{PhysicalVolume: "/dev/sdc", VolumeGroup: "vg"},
+		{PhysicalVolume: "/dev/sdd", VolumeGroup: "vg"},
+		{PhysicalVolume: "/dev/sde", VolumeGroup: "othervg"},
+	}
+
+	candidates, err := PhysicalVolumesAvoiding(pvs, raidSegments, "vg", "mirrored")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/sdd"}, candidates)
+}
+
+func TestPhysicalVolumesAvoiding_thin(t *testing.T) {
+	var pvs = []*PhysicalVolume{
+		{PhysicalVolume: "/dev/sdb", VolumeGroup: "vg"},
+		{PhysicalVolume: "/dev/sdc", VolumeGroup: "vg"},
+		{PhysicalVolume: "/dev/sdd", VolumeGroup: "vg"},
+	}
+
+	candidates, err := PhysicalVolumesAvoiding(pvs, thinSegments, "vg", "thinvol")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/sdc", "/dev/sdd"}, candidates)
+
+	_, err = PhysicalVolumesAvoiding(pvs, thinSegments, "vg", "orphanthin")
+	require.Error(t, err)
+}
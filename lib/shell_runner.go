@@ -0,0 +1,466 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// shellPrompt is what lvm's shell prints when it's ready
+	// to take the next command.
+	shellPrompt = "lvm> "
+
+	// shellConfig makes every command report its status in
+	// the JSON document written to the report descriptor.
+	shellConfig = `log{report_command_log=1 command_log_selection="all"} ` +
+		`report{output_format="json"}`
+
+	// ecmdProcessed is the return code lvm uses for commands
+	// that succeeded.
+	ecmdProcessed = 1
+
+	// shellReportTimeout is how long to wait for the report
+	// of a command after the prompt shows up. lvm writes the
+	// report before printing the prompt, so it should be
+	// there already.
+	shellReportTimeout = 5 * time.Second
+)
+
+var (
+	// shellCommands lists the commands that are handled by
+	// lvm's shell. Everything else goes to the fallback
+	// runner.
+	shellCommands = map[string]bool{
+		"fullreport": true,
+		"lvchange":   true,
+		"lvconvert":  true,
+		"lvcreate":   true,
+		"lvextend":   true,
+		"lvreduce":   true,
+		"lvremove":   true,
+		"lvrename":   true,
+		"lvresize":   true,
+		"lvs":        true,
+		"pvchange":   true,
+		"pvs":        true,
+		"segtypes":   true,
+		"vgchange":   true,
+		"vgs":        true,
+		"version":    true,
+	}
+)
+
+// ShellRunnerConfig provides the configuration of a
+// ShellRunner.
+type ShellRunnerConfig struct {
+	// Path to the lvm binary. Defaults to 'lvm'.
+	Path string
+
+	// Timeout is the maximum time a command can take
+	// before the shell is considered stuck and gets
+	// restarted. Defaults to 2 minutes.
+	Timeout time.Duration
+
+	// Fallback runs the commands that are not lvm
+	// commands (e.g., mount and cryptsetup). Defaults
+	// to an ExecRunner.
+	Fallback Runner
+}
+
+// ShellRunner runs lvm commands over a long-lived 'lvm'
+// shell session instead of forking a process per command.
+// Reports and command statuses are read from the JSON
+// documents that lvm writes to the descriptor specified in
+// LVM_REPORT_FD.
+// Commands are serialized over the single session. If the
+// session dies or gets stuck, it's restarted on the next
+// command.
+type ShellRunner struct {
+	cfg    ShellRunnerConfig
+	logger zerolog.Logger
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	outputs chan []byte
+	reports chan json.RawMessage
+
+	sync.Mutex
+}
+
+type shellLogEntry struct {
+	Type    string `json:"log_type"`
+	Message string `json:"log_message"`
+	RetCode Count  `json:"log_ret_code"`
+}
+
+type shellDocument struct {
+	Report json.RawMessage  `json:"report"`
+	Log    []*shellLogEntry `json:"log"`
+}
+
+// NewShellRunner instantiates a ShellRunner. The shell is
+// only started when the first command is issued.
+func NewShellRunner(cfg ShellRunnerConfig) (r *ShellRunner) {
+	if cfg.Path == "" {
+		cfg.Path = "lvm"
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 2 * time.Minute
+	}
+
+	if cfg.Fallback == nil {
+		cfg.Fallback = ExecRunner{}
+	}
+
+	r = &ShellRunner{
+		cfg: cfg,
+		logger: zerolog.New(os.Stdout).With().
+			Str("from", "shell-runner").
+			Logger(),
+	}
+
+	return
+}
+
+// Run executes the lvm command 'name' in the shell session.
+// 'name' can either be an lvm command (e.g., 'lvs') or 'lvm'
+// followed by the command in 'args'.
+// For reporting commands the JSON report is returned,
+// otherwise the output printed by the command.
+func (r *ShellRunner) Run(name string, args ...string) (out []byte, err error) {
+	var (
+		command     = name
+		commandArgs = args
+	)
+
+	if name == "lvm" && len(args) > 0 {
+		command, commandArgs = args[0], args[1:]
+	}
+
+	if !shellCommands[command] {
+		return r.cfg.Fallback.Run(name, args...)
+	}
+
+	line, err := buildShellLine(command, commandArgs)
+	if err != nil {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.cmd == nil {
+		err = r.start()
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't start lvm shell")
+			return
+		}
+	}
+
+	out, err = r.execute(line)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to execute command '%s' with args '%+v' in lvm shell",
+			command, commandArgs)
+		return
+	}
+
+	return
+}
+
+// Close terminates the shell session (if any).
+func (r *ShellRunner) Close() (err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.cmd == nil {
+		return
+	}
+
+	io.WriteString(r.stdin, "exit\n")
+	r.stop()
+	return
+}
+
+// buildShellLine quotes the arguments in a way that lvm's
+// shell splits them back. As the shell doesn't support
+// escaping, arguments containing both types of quotes or
+// newlines can't be passed.
+func buildShellLine(command string, args []string) (line string, err error) {
+	var parts = []string{command}
+
+	for _, arg := range append(args, "--config", shellConfig) {
+		switch {
+		case strings.ContainsAny(arg, "\n\r"):
+			err = errors.Errorf(
+				"argument '%s' can't contain newlines", arg)
+			return
+		case arg == "":
+			parts = append(parts, `""`)
+		case !strings.ContainsAny(arg, " \t#'\""):
+			parts = append(parts, arg)
+		case !strings.Contains(arg, "'"):
+			parts = append(parts, "'"+arg+"'")
+		case !strings.Contains(arg, `"`):
+			parts = append(parts, `"`+arg+`"`)
+		default:
+			err = errors.Errorf(
+				"argument '%s' can't contain both types of quotes", arg)
+			return
+		}
+	}
+
+	line = strings.Join(parts, " ") + "\n"
+	return
+}
+
+// start spawns the lvm shell with a pipe for the reports and
+// waits for its first prompt.
+func (r *ShellRunner) start() (err error) {
+	var (
+		stdout       io.ReadCloser
+		reportReader *os.File
+		reportWriter *os.File
+	)
+
+	reportReader, reportWriter, err = os.Pipe()
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't create report pipe")
+		return
+	}
+	defer reportWriter.Close()
+
+	cmd := exec.Command(r.cfg.Path)
+	cmd.Env = append(os.Environ(), "LVM_REPORT_FD=3", "LC_ALL=C")
+	cmd.ExtraFiles = []*os.File{reportWriter}
+
+	r.stdin, err = cmd.StdinPipe()
+	if err != nil {
+		reportReader.Close()
+		return
+	}
+
+	stdout, err = cmd.StdoutPipe()
+	if err != nil {
+		reportReader.Close()
+		return
+	}
+	cmd.Stderr = cmd.Stdout
+
+	err = cmd.Start()
+	if err != nil {
+		reportReader.Close()
+		return
+	}
+
+	r.cmd = cmd
+	r.outputs = make(chan []byte, 16)
+	r.reports = make(chan json.RawMessage, 16)
+
+	go readOutputs(stdout, r.outputs)
+	go readReports(reportReader, r.reports)
+
+	r.logger.Debug().
+		Int("pid", cmd.Process.Pid).
+		Msg("lvm shell started")
+
+	_, err = r.waitPrompt()
+	if err != nil {
+		r.stop()
+		err = errors.Wrapf(err, "lvm shell didn't become ready")
+		return
+	}
+
+	return
+}
+
+// stop kills the shell process and releases its resources.
+func (r *ShellRunner) stop() {
+	r.stdin.Close()
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	r.cmd = nil
+
+	go drain(r.outputs, r.reports)
+
+	r.logger.Debug().
+		Msg("lvm shell stopped")
+}
+
+// execute sends a command line to the shell and waits for
+// its output and status. Any failure to communicate with the
+// shell stops it so that the next command starts a new one.
+func (r *ShellRunner) execute(line string) (out []byte, err error) {
+	var (
+		output []byte
+		doc    shellDocument
+	)
+
+	_, err = io.WriteString(r.stdin, line)
+	if err != nil {
+		r.stop()
+		err = errors.Wrapf(err, "couldn't write to lvm shell")
+		return
+	}
+
+	output, err = r.waitPrompt()
+	if err != nil {
+		r.stop()
+		return
+	}
+
+	select {
+	case report, ok := <-r.reports:
+		if !ok {
+			r.stop()
+			err = errors.Errorf("lvm shell closed its report descriptor")
+			return
+		}
+
+		// a report that can't be decoded leaves the session
+		// out of sync, so it's not reused.
+		err = json.Unmarshal(report, &doc)
+		if err != nil {
+			r.stop()
+			err = errors.Wrapf(err, "malformed lvm shell report")
+			return
+		}
+
+		err = shellStatus(doc.Log)
+		if err != nil {
+			err = errors.Wrapf(err, "Output:\n%s\n", output)
+			return
+		}
+
+		if doc.Report != nil {
+			out = report
+			return
+		}
+	case <-time.After(shellReportTimeout):
+		r.stop()
+		err = errors.Errorf("timed out waiting for lvm shell report")
+		return
+	}
+
+	out = output
+	return
+}
+
+// waitPrompt gathers the output of the shell until it prints
+// its prompt, returning what came before it.
+func (r *ShellRunner) waitPrompt() (output []byte, err error) {
+	var (
+		buf     bytes.Buffer
+		timeout = time.After(r.cfg.Timeout)
+	)
+
+	for {
+		select {
+		case chunk, ok := <-r.outputs:
+			if !ok {
+				err = errors.Errorf(
+					"lvm shell exited. Output:\n%s\n", buf.String())
+				return
+			}
+
+			buf.Write(chunk)
+			if bytes.HasSuffix(buf.Bytes(), []byte(shellPrompt)) {
+				output = bytes.TrimSuffix(buf.Bytes(), []byte(shellPrompt))
+				return
+			}
+		case <-timeout:
+			err = errors.Errorf(
+				"timed out waiting for lvm shell prompt. Output:\n%s\n",
+				buf.String())
+			return
+		}
+	}
+}
+
+// shellStatus interprets the command log of a report,
+// erroring if the command didn't succeed.
+func shellStatus(log []*shellLogEntry) (err error) {
+	var messages = []string{}
+
+	for _, entry := range log {
+		if entry.Type == "error" {
+			messages = append(messages, entry.Message)
+		}
+	}
+
+	for _, entry := range log {
+		if entry.Type == "status" && entry.RetCode != ecmdProcessed {
+			messages = append(messages, entry.Message)
+			err = errors.Errorf(
+				"lvm command failed with code %d: %s",
+				entry.RetCode, strings.Join(messages, "; "))
+			return
+		}
+	}
+
+	if len(messages) > 0 {
+		err = errors.Errorf(
+			"lvm command failed: %s", strings.Join(messages, "; "))
+		return
+	}
+
+	return
+}
+
+// readOutputs forwards what the shell prints until it exits.
+func readOutputs(stdout io.Reader, outputs chan<- []byte) {
+	defer close(outputs)
+
+	for {
+		var buf = make([]byte, 4096)
+
+		n, err := stdout.Read(buf)
+		if n > 0 {
+			outputs <- buf[:n]
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readReports decodes the JSON documents written to the
+// report descriptor until it gets closed.
+func readReports(reader io.ReadCloser, reports chan<- json.RawMessage) {
+	defer close(reports)
+	defer reader.Close()
+
+	var decoder = json.NewDecoder(reader)
+
+	for {
+		var report json.RawMessage
+
+		err := decoder.Decode(&report)
+		if err != nil {
+			return
+		}
+
+		reports <- report
+	}
+}
+
+// drain discards whatever is left from a stopped shell so
+// that the readers can finish.
+func drain(outputs <-chan []byte, reports <-chan json.RawMessage) {
+	for range outputs {
+	}
+
+	for range reports {
+	}
+}
@@ -0,0 +1,234 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLvmShell mimics the behavior of 'lvm' when running as a
+// shell: it prints a prompt, reads commands from stdin and
+// writes a JSON document for each of them to LVM_REPORT_FD.
+const fakeLvmShell = `#!/bin/sh
+printf 'lvm> '
+while read -r line; do
+  set -- $line
+  case "$1" in
+    lvs)
+      printf '{"report":[{"lv":[{"lv_name":"lv1"}]}],"log":[{"log_type":"status","log_message":"success","log_ret_code":"1"}]}\n' >&3
+      ;;
+    version)
+      printf '  LVM version:     2.03.11(2)\n'
+      printf '{"log":[{"log_type":"status","log_message":"success","log_ret_code":1}]}\n' >&3
+      ;;
+    lvcreate)
+      printf '  Volume group not found\n'
+      printf '{"log":[{"log_type":"error","log_message":"Volume group not found","log_ret_code":"0"},{"log_type":"status","log_message":"failure","log_ret_code":"5"}]}\n' >&3
+      ;;
+    lvremove)
+      exit 1
+      ;;
+    lvrename)
+      printf '{"log":"garbled"}\n' >&3
+      ;;
+  esac
+  printf 'lvm> '
+done
+`
+
+type recordingRunner struct {
+	names []string
+	args  [][]string
+}
+
+func (r *recordingRunner) Run(name string, args ...string) ([]byte, error) {
+	r.names = append(r.names, name)
+	r.args = append(r.args, args)
+	return []byte(name), nil
+}
+
+func newFakeShellRunner(t *testing.T) (runner *ShellRunner, fallback *recordingRunner, cleanup func()) {
+	dir, err := ioutil.TempDir("", "shell-runner")
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "lvm")
+	err = ioutil.WriteFile(path, []byte(fakeLvmShell), 0755)
+	require.NoError(t, err)
+
+	fallback = new(recordingRunner)
+	runner = NewShellRunner(ShellRunnerConfig{
+		Path:     path,
+		Fallback: fallback,
+	})
+
+	cleanup = func() {
+		runner.Close()
+		os.RemoveAll(dir)
+	}
+
+	return
+}
+
+func TestShellRunner_reports(t *testing.T) {
+	runner, _, cleanup := newFakeShellRunner(t)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		out, err := runner.Run("lvs", "--options=lv_name", "--report-format=json")
+		require.NoError(t, err)
+
+		vols, err := DecodeLogicalVolumesResponse(out)
+		require.NoError(t, err)
+		require.Len(t, vols, 1)
+		assert.Equal(t, "lv1", vols[0].LvName)
+	}
+}
+
+func TestShellRunner_outputOfNonReportingCommands(t *testing.T) {
+	runner, _, cleanup := newFakeShellRunner(t)
+	defer cleanup()
+
+	out, err := runner.Run("lvm", "version")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "LVM version:     2.03.11(2)")
+}
+
+func TestShellRunner_failingCommand(t *testing.T) {
+	runner, _, cleanup := newFakeShellRunner(t)
+	defer cleanup()
+
+	_, err := runner.Run("lvcreate", "--name", "lv", "--size", "10M", "vg")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Volume group not found")
+
+	_, err = runner.Run("lvs")
+	assert.NoError(t, err)
+}
+
+func TestShellRunner_restartsAfterCrash(t *testing.T) {
+	runner, _, cleanup := newFakeShellRunner(t)
+	defer cleanup()
+
+	_, err := runner.Run("lvremove", "vg/lv")
+	require.Error(t, err)
+
+	_, err = runner.Run("lvs")
+	assert.NoError(t, err)
+}
+
+func TestShellRunner_fallback(t *testing.T) {
+	runner, fallback, cleanup := newFakeShellRunner(t)
+	defer cleanup()
+
+	out, err := runner.Run("cryptsetup", "luksClose", "luks-lv")
+	require.NoError(t, err)
+	assert.Equal(t, "cryptsetup", string(out))
+	assert.Equal(t, []string{"cryptsetup"}, fallback.names)
+	assert.Nil(t, runner.cmd)
+
+	_, err = runner.Run("lvm", "vgcfgbackup", "vg")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cryptsetup", "lvm"}, fallback.names)
+	assert.Equal(t, []string{"vgcfgbackup", "vg"}, fallback.args[1])
+}
+
+func TestShellRunner_restartsAfterMalformedReport(t *testing.T) {
+	runner, _, cleanup := newFakeShellRunner(t)
+	defer cleanup()
+
+	_, err := runner.Run("lvrename", "vg", "a", "b")
+	require.Error(t, err)
+	assert.Nil(t, runner.cmd)
+
+	out, err := runner.Run("lvs")
+	require.NoError(t, err)
+
+	vols, err := DecodeLogicalVolumesResponse(out)
+	require.NoError(t, err)
+	assert.Len(t, vols, 1)
+}
+
+func TestBuildShellLine(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		args        []string
+		expected    string
+		shouldError bool
+	}{
+		{
+			desc:     "plain arguments",
+			args:     []string{"--noheadings", "vg/lv"},
+			expected: "lvs --noheadings vg/lv --config '" + shellConfig + "'\n",
+		},
+		{
+			desc:     "argument with spaces",
+			args:     []string{"--select", "lv_name = lv1"},
+			expected: "lvs --select 'lv_name = lv1' --config '" + shellConfig + "'\n",
+		},
+		{
+			desc:     "argument with single quotes",
+			args:     []string{"--select", "lv_name='lv1'"},
+			expected: "lvs --select \"lv_name='lv1'\" --config '" + shellConfig + "'\n",
+		},
+		{
+			desc:        "argument with both quotes",
+			args:        []string{"'\""},
+			shouldError: true,
+		},
+		{
+			desc:        "argument with newlines",
+			args:        []string{"a\nb"},
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := buildShellLine("lvs", tc.args)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+// benchmarkRunner lists logical volumes with a real lvm2
+// installation, being skipped when there's none.
+func benchmarkRunner(b *testing.B, runner Runner) {
+	_, err := exec.LookPath("lvm")
+	if err != nil || os.Geteuid() != 0 {
+		b.Skip("lvm2 and root privileges are required")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = runner.Run("lvs",
+			"--units=b",
+			"--nosuffix",
+			"--options=lv_name",
+			"--report-format=json")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecRunner(b *testing.B) {
+	benchmarkRunner(b, ExecRunner{})
+}
+
+func BenchmarkShellRunner(b *testing.B) {
+	runner := NewShellRunner(ShellRunnerConfig{})
+	defer runner.Close()
+
+	benchmarkRunner(b, runner)
+}
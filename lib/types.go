@@ -1,19 +1,49 @@
 package lib
 
 import (
+	"time"
+
 	"github.com/rs/zerolog"
 )
 
 // Lvm encapsulates a series of methods for
 // dealing with LVM management.
-// It's mostly stateless except for a logger.
+// It's mostly stateless except for a logger and an
+// optional inventory cache.
 type Lvm struct {
-	logger zerolog.Logger
+	logger        zerolog.Logger
+	reportFormat  string
+	cache         *InventoryCache
+	runner        Runner
+	mountInfoFile string
+	freezer       Freezer
 }
 
 // LvmConfig provides the configuration details for
 // the Lvm helper.
-type LvmConfig struct{}
+type LvmConfig struct {
+	// ReportFormat is the format requested from lvm's
+	// reporting commands (ReportFormatJson or
+	// ReportFormatJsonStd). ReportFormatAuto makes the
+	// helper detect the best format supported by the
+	// installed lvm2. Defaults to ReportFormatJson.
+	ReportFormat string
+
+	// InventoryTTL is the time an inventory is kept cached
+	// for. Mutations performed through the helper
+	// invalidate the cache right away. Zero disables
+	// caching.
+	InventoryTTL time.Duration
+
+	// Runner executes the commands. Defaults to an
+	// ExecRunner, which forks a process per command.
+	Runner Runner
+
+	// MountInfoFile is the file describing the mounts of
+	// the system in the mountinfo format. Defaults to
+	// '/proc/self/mountinfo'.
+	MountInfoFile string
+}
 
 // LvCreationConfig is a simplified configuration
 // struct to be passed to logical volume creation
@@ -26,6 +56,21 @@ type LvCreationConfig struct {
 	ThinPool    string
 	VolumeGroup string
 	FsType      string
+
+	Type            string
+	Stripes         uint64
+	StripeSize      string
+	Mirrors         uint64
+	PhysicalVolumes []string
+
+	// ThinSnapshot indicates that the origin of the
+	// snapshot is a thin volume, in which case the
+	// snapshot lives in the same pool and takes no size.
+	ThinSnapshot bool
+
+	// Tags are added to the volume (e.g., the ones that
+	// persist its mount options - see MountOptions.Tags).
+	Tags []string
 }
 
 type PhysicalVolumesReport struct {
@@ -46,40 +91,92 @@ type LogicalVolumesReport struct {
 	} `json:"report"`
 }
 
+type LogicalVolumeSegmentsReport struct {
+	Report []struct {
+		Seg []*LogicalVolumeSegment `json:"seg"`
+		Lv  []*LogicalVolumeSegment `json:"lv"`
+	} `json:"report"`
+}
+
+// FullReport corresponds to the output of 'lvm fullreport',
+// which contains one entry per volume group (plus one for
+// orphan physical volumes) with all the objects related to it.
+type FullReport struct {
+	Report []struct {
+		Vg  []*VolumeGroup          `json:"vg"`
+		Pv  []*PhysicalVolume       `json:"pv"`
+		Lv  []*LogicalVolume        `json:"lv"`
+		Seg []*LogicalVolumeSegment `json:"seg"`
+	} `json:"report"`
+}
+
 type PhysicalVolume struct {
-	PhysicalVolume   string  `json:"pv_name"`
-	VolumeGroup      string  `json:"vg_name"`
-	Attr             string  `json:"pv_attr"`
-	Fmt              string  `json:"pv_fmt"`
-	PhysicalSize     float64 `json:"pv_size,string"`
-	PhysicalSizeFree float64 `json:"pv_free,string"`
+	PhysicalVolume   string   `json:"pv_name"`
+	VolumeGroup      string   `json:"vg_name"`
+	Attr             string   `json:"pv_attr"`
+	Fmt              string   `json:"pv_fmt"`
+	PhysicalSize     ByteSize `json:"pv_size"`
+	PhysicalSizeFree ByteSize `json:"pv_free"`
 }
 
 type VolumeGroup struct {
-	Attr      string  `json:"vg_attr"`
-	Name      string  `json:"vg_name"`
-	Free      float64 `json:"vg_free,string"`
-	Size      float64 `json:"vg_size,string"`
-	LvCount   uint64  `json:"lv_count,string"`
-	PvCount   uint64  `json:"pv_count,string"`
-	SnapCount uint64  `json:"snap_count,string"`
+	Attr       string   `json:"vg_attr"`
+	Name       string   `json:"vg_name"`
+	Free       ByteSize `json:"vg_free"`
+	Size       ByteSize `json:"vg_size"`
+	ExtentSize ByteSize `json:"vg_extent_size"`
+	LvCount    Count    `json:"lv_count"`
+	PvCount    Count    `json:"pv_count"`
+	SnapCount  Count    `json:"snap_count"`
 }
 
 type LogicalVolume struct {
-	ConvertLv       string  `json:"convert_lv"`
-	CopyPercent     string  `json:"copy_percent"`
-	DataPercent     string  `json:"data_percent"`
-	LvAttr          string  `json:"lv_attr"`
-	LvName          string  `json:"lv_name"`
-	LvFullName      string  `json:"lv_full_name"`
-	LvDmPath        string  `json:"lv_dm_path"`
-	LvSize          float64 `json:"lv_size,string"`
-	MetadataPercent string  `json:"metadata_percent"`
-	MirrorLog       string  `json:"mirror_log"`
-	MovePv          string  `json:"move_pv"`
-	Origin          string  `json:"origin"`
-	PoolLv          string  `json:"pool_lv"`
-	VgName          string  `json:"vg_name"`
+	ConvertLv       string     `json:"convert_lv"`
+	CopyPercent     Percent    `json:"copy_percent"`
+	DataPercent     Percent    `json:"data_percent"`
+	LvAttr          string     `json:"lv_attr"`
+	LvName          string     `json:"lv_name"`
+	LvFullName      string     `json:"lv_full_name"`
+	LvDmPath        string     `json:"lv_dm_path"`
+	LvLayout        string     `json:"lv_layout"`
+	LvSize          ByteSize   `json:"lv_size"`
+	LvTags          StringList `json:"lv_tags"`
+	MetadataPercent Percent    `json:"metadata_percent"`
+	MirrorLog       string     `json:"mirror_log"`
+	MovePv          string     `json:"move_pv"`
+	Origin          string     `json:"origin"`
+	PoolLv          string     `json:"pool_lv"`
+	ThinId          Count      `json:"thin_id"`
+	VgName          string     `json:"vg_name"`
+}
+
+type LogicalVolumeSegment struct {
+	LvName      string   `json:"lv_name"`
+	VgName      string   `json:"vg_name"`
+	SegType     string   `json:"segtype"`
+	SegStartPe  Count    `json:"seg_start_pe"`
+	SegSizePe   Count    `json:"seg_size_pe"`
+	Stripes     Count    `json:"stripes"`
+	StripeSize  ByteSize `json:"stripe_size"`
+	SegPeRanges string   `json:"seg_pe_ranges"`
+	Devices     string   `json:"devices"`
+	PoolLv      string   `json:"pool_lv"`
+}
+
+// PeRange represents a contiguous range of extents
+// of a device (physical volume or sub logical volume)
+// that backs a segment.
+type PeRange struct {
+	Device string
+	Start  uint64
+	End    uint64
+}
+
+// SegmentDevice represents a device that backs a segment
+// together with the first extent used from it.
+type SegmentDevice struct {
+	Device      string
+	StartExtent uint64
 }
 
 type LvRemovalConfig struct {
@@ -88,21 +185,48 @@ type LvRemovalConfig struct {
 }
 
 type LvAttr struct {
-	VolumeType                string
-	Permissions               string
-	AllocationPolicy          string
-	FixedMinor                string
-	State                     string
-	DeviceState               string
-	TargetType                string
-	OverrideNewBlocksWithZero string
-	VolumeHealth              string
-	SkipActivation            string
+	VolumeType                LvVolumeType
+	Permissions               LvPermissions
+	AllocationPolicy          AllocationPolicy
+	FixedMinor                LvFixedMinor
+	State                     LvState
+	DeviceState               LvDeviceState
+	TargetType                LvTargetType
+	OverrideNewBlocksWithZero LvZeroing
+	VolumeHealth              LvHealth
+	SkipActivation            LvSkipActivation
+}
+
+type VgAttr struct {
+	Permissions      VgPermissions
+	Resizeable       VgResizeable
+	Exported         VgExported
+	Partial          VgPartial
+	AllocationPolicy AllocationPolicy
+	Clustered        VgClustered
 }
 
+type PvAttr struct {
+	Allocation PvAllocation
+	Exported   PvExported
+	Missing    PvMissing
+}
+
+// MountInfo describes a mount as listed in /proc/mounts or,
+// with more details, in /proc/<pid>/mountinfo (see proc(5)).
 type MountInfo struct {
 	Device   string
 	Location string
 	Format   string
 	Options  string
+
+	// The fields below are only filled when parsing
+	// mountinfo files.
+	MountId        uint64
+	ParentId       uint64
+	Major          uint32
+	Minor          uint32
+	Root           string
+	OptionalFields []string
+	SuperOptions   string
 }
@@ -0,0 +1,188 @@
+package lib
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UuidPolicy determines how the filesystem UUID of a volume
+// that is a copy of another one (e.g., a snapshot) is dealt
+// with, as it's the same as the one of the original volume.
+type UuidPolicy string
+
+const (
+	// UuidAuto mounts copies of xfs volumes with 'nouuid'
+	// and regenerates the UUID of copies of ext volumes.
+	UuidAuto UuidPolicy = "auto"
+
+	// UuidKeep leaves the UUID untouched.
+	UuidKeep UuidPolicy = "keep"
+
+	// UuidNouuid mounts xfs volumes with the 'nouuid'
+	// option so that xfs doesn't refuse to mount a
+	// filesystem with the same UUID as a mounted one.
+	UuidNouuid UuidPolicy = "nouuid"
+
+	// UuidRegenerate gives the filesystem a new random
+	// UUID the first time it's mounted.
+	UuidRegenerate UuidPolicy = "regenerate"
+)
+
+const (
+	// UuidPolicyTagPrefix prefixes the tag that records
+	// the UUID policy of a volume.
+	UuidPolicyTagPrefix = "golvm/uuid="
+
+	// UuidRegeneratedTag marks the volumes whose UUID was
+	// already regenerated.
+	UuidRegeneratedTag = "golvm/uuid-regenerated"
+)
+
+// ParseUuidPolicy validates a UUID policy, defaulting to
+// UuidAuto.
+func ParseUuidPolicy(policy string) (parsed UuidPolicy, err error) {
+	switch UuidPolicy(policy) {
+	case "", UuidAuto:
+		parsed = UuidAuto
+	case UuidKeep, UuidNouuid, UuidRegenerate:
+		parsed = UuidPolicy(policy)
+	default:
+		err = errors.Errorf(
+			"unknown uuid policy %s - must be auto, keep, nouuid or regenerate",
+			policy)
+	}
+
+	return
+}
+
+// VolumeUuidPolicy retrieves the UUID policy persisted in the
+// tags of a volume, defaulting to UuidAuto.
+func VolumeUuidPolicy(vol *LogicalVolume) (policy UuidPolicy, err error) {
+	for _, tag := range vol.LvTags {
+		if strings.HasPrefix(tag, UuidPolicyTagPrefix) {
+			policy, err = ParseUuidPolicy(
+				strings.TrimPrefix(tag, UuidPolicyTagPrefix))
+			return
+		}
+	}
+
+	policy = UuidAuto
+	return
+}
+
+// IsVolumeCopy indicates whether a volume shares the contents
+// (and thus the filesystem UUID) of another one, either as a
+// snapshot or as a clone.
+func IsVolumeCopy(vol *LogicalVolume) bool {
+	_, isClone := CloneSource(vol)
+	return vol.Origin != "" || isClone
+}
+
+// ResolveUuidPolicy decides what to do with the UUID of a
+// volume with a filesystem of type 'fsType', turning UuidAuto
+// into one of the concrete policies. Volumes that are not
+// copies keep their UUIDs.
+func ResolveUuidPolicy(policy UuidPolicy, fsType string, isCopy bool) (resolved UuidPolicy, err error) {
+	if !isCopy {
+		resolved = UuidKeep
+		return
+	}
+
+	resolved = policy
+	if policy == UuidAuto {
+		switch fsType {
+		case "xfs":
+			resolved = UuidNouuid
+		case "ext2", "ext3", "ext4":
+			resolved = UuidRegenerate
+		default:
+			resolved = UuidKeep
+		}
+	}
+
+	if resolved == UuidNouuid && fsType != "xfs" {
+		err = errors.Errorf(
+			"the nouuid policy only applies to xfs - got %s", fsType)
+		return
+	}
+
+	return
+}
+
+// BuildRegenerateUuidArgs builds the command line (argv) that
+// gives the filesystem of 'device' a new random UUID.
+func BuildRegenerateUuidArgs(device, fsType string) (argv []string, err error) {
+	if device == "" {
+		err = errors.Errorf("a device must be specified")
+		return
+	}
+
+	switch fsType {
+	case "xfs":
+		argv = []string{"xfs_admin", "-U", "generate", device}
+	case "ext2", "ext3", "ext4":
+		argv = []string{"tune2fs", "-U", "random", device}
+	default:
+		err = errors.Errorf(
+			"can't regenerate the uuid of %s filesystems", fsType)
+	}
+
+	return
+}
+
+// RegenerateUuid gives the (unmounted) filesystem of 'device'
+// a new random UUID. ext filesystems get a forced check first
+// as tune2fs refuses to change the UUID of filesystems with
+// metadata checksums (but no checksum seed) that weren't
+// checked since they were last mounted.
+func (l Lvm) RegenerateUuid(device, fsType string) (err error) {
+	var (
+		argv   []string
+		result FsckResult
+	)
+
+	argv, err = BuildRegenerateUuidArgs(device, fsType)
+	if err != nil {
+		return
+	}
+
+	if argv[0] == "tune2fs" {
+		result, err = l.CheckFilesystem(device, fsType, FsckAlways)
+		if err != nil {
+			return
+		}
+
+		if !result.Mountable() {
+			err = errors.Errorf(
+				"filesystem of device %s has errors (%s) - "+
+					"can't regenerate its uuid. Output:\n%s\n",
+				device, result.Status, result.Output)
+			return
+		}
+	}
+
+	_, err = l.Run(argv[0], argv[1:]...)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't regenerate the uuid of device %s", device)
+		return
+	}
+
+	return
+}
+
+// WithNouuid gives back the options with 'nouuid' added to
+// the filesystem-specific ones.
+func (o MountOptions) WithNouuid() MountOptions {
+	for _, opt := range o.Data {
+		if opt == "nouuid" {
+			return o
+		}
+	}
+
+	o.Data = append(append([]string{}, o.Data...), "nouuid")
+	sort.Strings(o.Data)
+	return o
+}
@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveUuidPolicy(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		policy      UuidPolicy
+		fsType      string
+		isCopy      bool
+		expected    UuidPolicy
+		shouldError bool
+	}{
+		{
+			desc:     "originals keep their uuids",
+			policy:   UuidRegenerate,
+			fsType:   "ext4",
+			isCopy:   false,
+			expected: UuidKeep,
+		},
+		{
+			desc:     "auto mounts xfs copies with nouuid",
+			policy:   UuidAuto,
+			fsType:   "xfs",
+			isCopy:   true,
+			expected: UuidNouuid,
+		},
+		{
+			desc:     "auto regenerates the uuid of ext4 copies",
+			policy:   UuidAuto,
+			fsType:   "ext4",
+			isCopy:   true,
+			expected: UuidRegenerate,
+		},
+		{
+			desc:     "auto keeps the uuid of other filesystems",
+			policy:   UuidAuto,
+			fsType:   "btrfs",
+			isCopy:   true,
+			expected: UuidKeep,
+		},
+		{
+			desc:     "explicit regenerate for xfs",
+			policy:   UuidRegenerate,
+			fsType:   "xfs",
+			isCopy:   true,
+			expected: UuidRegenerate,
+		},
+		{
+			desc:        "nouuid fails for ext4",
+			policy:      UuidNouuid,
+			fsType:      "ext4",
+			isCopy:      true,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			resolved, err := ResolveUuidPolicy(tc.policy, tc.fsType, tc.isCopy)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, resolved)
+		})
+	}
+}
+
+func TestBuildRegenerateUuidArgs(t *testing.T) {
+	argv, err := BuildRegenerateUuidArgs("/dev/dev", "xfs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"xfs_admin", "-U", "generate", "/dev/dev"}, argv)
+
+	argv, err = BuildRegenerateUuidArgs("/dev/dev", "ext4")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tune2fs", "-U", "random", "/dev/dev"}, argv)
+
+	_, err = BuildRegenerateUuidArgs("/dev/dev", "btrfs")
+	assert.Error(t, err)
+
+	_, err = BuildRegenerateUuidArgs("", "xfs")
+	assert.Error(t, err)
+}
+
+func TestRegenerateUuid(t *testing.T) {
+	var testCases = []struct {
+		fsType   string
+		expected [][]string
+	}{
+		{
+			fsType: "ext4",
+			expected: [][]string{
+				{"e2fsck", "-p", "-f", "/dev/dev"},
+				{"tune2fs", "-U", "random", "/dev/dev"},
+			},
+		},
+		{
+			fsType: "xfs",
+			expected: [][]string{
+				{"xfs_admin", "-U", "generate", "/dev/dev"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fsType, func(t *testing.T) {
+			var (
+				runner = &recordingRunner{}
+				l      = Lvm{logger: zerolog.Nop(), runner: runner}
+				argvs  [][]string
+			)
+
+			require.NoError(t, l.RegenerateUuid("/dev/dev", tc.fsType))
+
+			for i, name := range runner.names {
+				argvs = append(argvs, append([]string{name}, runner.args[i]...))
+			}
+			assert.Equal(t, tc.expected, argvs)
+		})
+	}
+}
+
+func TestRegenerateUuid_uncorrectedErrors(t *testing.T) {
+	var (
+		runner = &exitingRunner{code: 4}
+		l      = Lvm{logger: zerolog.Nop(), runner: runner}
+	)
+
+	assert.Error(t, l.RegenerateUuid("/dev/dev", "ext4"))
+	assert.Equal(t, []string{"e2fsck", "-p", "-f", "/dev/dev"}, runner.argv)
+}
+
+func TestVolumeUuidPolicy(t *testing.T) {
+	policy, err := VolumeUuidPolicy(&LogicalVolume{})
+	require.NoError(t, err)
+	assert.Equal(t, UuidAuto, policy)
+
+	policy, err = VolumeUuidPolicy(&LogicalVolume{
+		LvTags: StringList{"golvm/uuid=keep"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, UuidKeep, policy)
+
+	_, err = VolumeUuidPolicy(&LogicalVolume{
+		LvTags: StringList{"golvm/uuid=whatever"},
+	})
+	assert.Error(t, err)
+}
+
+func TestMountOptions_WithNouuid(t *testing.T) {
+	opts, err := ParseMountOptions("xfs", "noatime,wsync,inode64")
+	require.NoError(t, err)
+
+	withNouuid := opts.WithNouuid()
+	assert.Equal(t, "noatime,inode64,nouuid,wsync", withNouuid.String())
+	assert.Equal(t, "noatime,inode64,wsync", opts.String())
+	assert.Equal(t, withNouuid, withNouuid.WithNouuid())
+}
@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Count represents a non-negative integer field of an lvm
+// report (e.g., 'lv_count' or 'seg_size_pe').
+type Count uint64
+
+// Percent represents a percentage field of an lvm report
+// (e.g., 'data_percent'). Fields that don't apply to a volume
+// are reported empty (or null) and decode to zero.
+type Percent float64
+
+// reportValue extracts the textual representation of a value
+// from an lvm report. The 'json' format quotes every value
+// while 'json_std' uses numbers and nulls.
+func reportValue(data []byte) (value string, err error) {
+	data = bytes.TrimSpace(data)
+
+	if bytes.Equal(data, []byte("null")) {
+		return
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		err = json.Unmarshal(data, &value)
+		if err != nil {
+			return
+		}
+
+		value = strings.TrimSpace(value)
+		return
+	}
+
+	value = string(data)
+	return
+}
+
+// decodeReportUint decodes an unsigned integer that might
+// come quoted, unquoted, empty or null, optionally followed
+// by 'suffix'.
+func decodeReportUint(data []byte, suffix string) (value uint64, err error) {
+	var str string
+
+	str, err = reportValue(data)
+	if err != nil {
+		return
+	}
+
+	str = strings.TrimSuffix(str, suffix)
+	if str == "" {
+		return
+	}
+
+	value, err = strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"malformed unsigned integer '%s'", str)
+		return
+	}
+
+	return
+}
+
+// UnmarshalJSON decodes a count from either the 'json' or the
+// 'json_std' report formats.
+func (c *Count) UnmarshalJSON(data []byte) (err error) {
+	var value uint64
+
+	value, err = decodeReportUint(data, "")
+	if err != nil {
+		err = errors.Wrapf(err, "malformed count")
+		return
+	}
+
+	*c = Count(value)
+	return
+}
+
+// UnmarshalJSON decodes a percentage from either the 'json'
+// or the 'json_std' report formats. As lvm formats numbers
+// according to the locale, a comma is accepted as the
+// decimal separator.
+func (p *Percent) UnmarshalJSON(data []byte) (err error) {
+	var (
+		str   string
+		value float64
+	)
+
+	str, err = reportValue(data)
+	if err != nil {
+		return
+	}
+
+	str = strings.TrimSuffix(str, "%")
+	if str == "" {
+		*p = 0
+		return
+	}
+
+	value, err = strconv.ParseFloat(strings.Replace(str, ",", ".", 1), 64)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"malformed percentage '%s'", str)
+		return
+	}
+
+	*p = Percent(value)
+	return
+}
+
+// StringList represents a list field of an lvm report (e.g.,
+// 'lv_tags'). Lists come as comma-separated strings in the
+// 'json' report format and might come as arrays in
+// 'json_std'.
+type StringList []string
+
+// UnmarshalJSON decodes a list from either a comma-separated
+// string or an array of strings.
+func (s *StringList) UnmarshalJSON(data []byte) (err error) {
+	var (
+		str   string
+		items []string
+	)
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &items)
+		if err != nil {
+			err = errors.Wrapf(err, "malformed list")
+			return
+		}
+
+		*s = StringList(items)
+		return
+	}
+
+	str, err = reportValue(data)
+	if err != nil {
+		return
+	}
+
+	items = []string{}
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	*s = StringList(items)
+	return
+}
+
+// Contains indicates whether 'item' is part of the list.
+func (s StringList) Contains(item string) bool {
+	for _, candidate := range s {
+		if candidate == item {
+			return true
+		}
+	}
+
+	return false
+}
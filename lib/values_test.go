@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountUnmarshalJSON(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    Count
+		shouldError bool
+	}{
+		{
+			desc:     "json string",
+			input:    `"3"`,
+			expected: 3,
+		},
+		{
+			desc:     "json_std number",
+			input:    `3`,
+			expected: 3,
+		},
+		{
+			desc:     "empty string is zero",
+			input:    `""`,
+			expected: 0,
+		},
+		{
+			desc:     "null is zero",
+			input:    `null`,
+			expected: 0,
+		},
+		{
+			desc:        "negative should fail",
+			input:       `-1`,
+			shouldError: true,
+		},
+		{
+			desc:        "garbage should fail",
+			input:       `"abc"`,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var actual Count
+
+			err := json.Unmarshal([]byte(tc.input), &actual)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestPercentUnmarshalJSON(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    Percent
+		shouldError bool
+	}{
+		{
+			desc:     "json string",
+			input:    `"12.50"`,
+			expected: 12.5,
+		},
+		{
+			desc:     "json string with comma separator",
+			input:    `"12,50"`,
+			expected: 12.5,
+		},
+		{
+			desc:     "json_std number",
+			input:    `12.5`,
+			expected: 12.5,
+		},
+		{
+			desc:     "empty string is zero",
+			input:    `""`,
+			expected: 0,
+		},
+		{
+			desc:     "null is zero",
+			input:    `null`,
+			expected: 0,
+		},
+		{
+			desc:        "garbage should fail",
+			input:       `"abc"`,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var actual Percent
+
+			err := json.Unmarshal([]byte(tc.input), &actual)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestStringListUnmarshalJSON(t *testing.T) {
+	var testCases = []struct {
+		desc        string
+		input       string
+		expected    StringList
+		shouldError bool
+	}{
+		{
+			desc:     "empty string",
+			input:    `""`,
+			expected: StringList{},
+		},
+		{
+			desc:     "comma separated string",
+			input:    `"a,b"`,
+			expected: StringList{"a", "b"},
+		},
+		{
+			desc:     "array",
+			input:    `["a","b"]`,
+			expected: StringList{"a", "b"},
+		},
+		{
+			desc:        "array of numbers should fail",
+			input:       `[1,2]`,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var actual StringList
+
+			err := json.Unmarshal([]byte(tc.input), &actual)
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
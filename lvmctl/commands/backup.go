@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cirocosta/golvm/lib"
+	"github.com/cirocosta/golvm/lvmctl/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var Backup = cli.Command{
+	Name:  "backup",
+	Usage: "backs a thin volume up to a directory, incrementally",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Thin volume (lv or vg/lv) to back up",
+		},
+		&cli.StringFlag{
+			Name:  "dir",
+			Usage: "Directory that holds the backups of the volume",
+		},
+		&cli.BoolFlag{
+			Name:  "full",
+			Usage: "Take a full backup, starting a new chain",
+		},
+		&cli.BoolFlag{
+			Name:  "list",
+			Usage: "List the backups in the directory instead of taking one",
+		},
+		&cli.DurationFlag{
+			Name:  "freeze-timeout",
+			Usage: "Maximum time to freeze the filesystem of a mounted volume (0 disables freezing)",
+			Value: lib.DefaultFreezeTimeout,
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		var (
+			name = c.String("name")
+			dir  = c.String("dir")
+			vol  *lib.LogicalVolume
+			list []*lib.BackupManifest
+		)
+
+		if dir == "" {
+			cli.ShowCommandHelp(c, "backup")
+			utils.Abort(errors.Errorf("Dir parameter not set."))
+		}
+
+		if c.Bool("list") {
+			list, err = lib.ListBackups(dir)
+			utils.Abort(err)
+
+			w := new(tabwriter.Writer)
+			w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+
+			fmt.Fprintln(w, "SEQUENCE\tPARENT\tVOLUME\tSIZE\tCHUNKS\tCREATED\t")
+			for _, backup := range list {
+				fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t%s\n",
+					backup.Sequence,
+					backup.Parent,
+					backup.Volume,
+					backup.Size,
+					len(backup.Chunks),
+					backup.CreatedAt)
+			}
+
+			w.Flush()
+			return
+		}
+
+		if name == "" {
+			cli.ShowCommandHelp(c, "backup")
+			utils.Abort(errors.Errorf("Name parameter not set."))
+		}
+
+		lvm, err := lib.NewLvm(lib.LvmConfig{})
+		utils.Abort(err)
+
+		caps := lvm.ProbeCapabilities()
+		if !caps.ThinTools.Found {
+			utils.Abort(errors.Errorf(
+				"thin_delta (thin-provisioning-tools) wasn't found"))
+		}
+
+		vol, err = lvm.GetLogicalVolume(name)
+		utils.Abort(err)
+
+		if vol == nil {
+			utils.Abort(errors.Errorf("volume %s not found", name))
+		}
+
+		backup, err := lvm.BackupVolume(vol, dir, lib.BackupConfig{
+			Full:          c.Bool("full"),
+			FreezeTimeout: c.Duration("freeze-timeout"),
+		})
+		utils.Abort(err)
+
+		fmt.Printf("backup %d of %s stored (%d chunks)\n",
+			backup.Sequence, backup.Volume, len(backup.Chunks))
+		return
+	},
+}
@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/cirocosta/golvm/lib"
@@ -20,18 +21,41 @@ var Check = cli.Command{
 		w := new(tabwriter.Writer)
 		w.Init(os.Stdout, 0, 8, 0, '\t', 0)
 
+		caps := lvm.ProbeCapabilities()
+
+		fmt.Println("TOOLS")
+		fmt.Fprintln(w, "NAME\tVERSION\t")
+		for _, tool := range caps.Tools() {
+			fmt.Fprintf(w, "%s\t%s\n",
+				tool.Tool,
+				tool)
+		}
+		w.Flush()
+
+		fmt.Println("")
+		fmt.Println("FEATURES")
+		fmt.Fprintln(w, "NAME\tSUPPORTED\t")
+		for _, feature := range caps.Features() {
+			fmt.Fprintf(w, "%s\t%t\n",
+				feature.Name,
+				feature.Supported)
+		}
+		w.Flush()
+
 		pvs, err := lvm.ListPhysicalVolumes()
 		utils.Abort(err)
 
 		fmt.Println("")
 		fmt.Println("PHYSICAL VOLUMES")
-		fmt.Fprintln(w, "NAME\tVG\tSIZE\tFREE\t")
+		fmt.Fprintln(w, "NAME\tVG\tSIZE\tFREE\tHEALTH\t")
 		for _, pv := range pvs {
-			fmt.Fprintf(w, "%s\t%s\t%.2f\t%.2f\n",
+			problems, err := lib.PhysicalVolumeProblems(pv)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
 				pv.PhysicalVolume,
 				pv.VolumeGroup,
 				pv.PhysicalSize,
-				pv.PhysicalSizeFree)
+				pv.PhysicalSizeFree,
+				healthStatus(problems, err))
 		}
 		w.Flush()
 
@@ -40,12 +64,14 @@ var Check = cli.Command{
 
 		fmt.Println("")
 		fmt.Println("VOLUME GROUPS")
-		fmt.Fprintln(w, "NAME\tSIZE\tFREE\t")
+		fmt.Fprintln(w, "NAME\tSIZE\tFREE\tHEALTH\t")
 		for _, vg := range vgs {
-			fmt.Fprintf(w, "%s\t%.2f\t%.2f\n",
+			problems, err := lib.VolumeGroupProblems(vg)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
 				vg.Name,
 				vg.Size,
-				vg.Free)
+				vg.Free,
+				healthStatus(problems, err))
 		}
 		w.Flush()
 
@@ -56,7 +82,7 @@ var Check = cli.Command{
 		fmt.Println("LOGICAL VOLUMES")
 		fmt.Fprintln(w, "NAME\tVG\tSIZE\tPOOL\tDEVICE\t")
 		for _, lv := range lvs {
-			fmt.Fprintf(w, "%s\t%s\t%.2f\t%s\t%s\n",
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
 				lv.LvName,
 				lv.VgName,
 				lv.LvSize,
@@ -68,3 +94,17 @@ var Check = cli.Command{
 		return
 	},
 }
+
+// healthStatus summarizes the problems found for a volume
+// group or physical volume in a single column.
+func healthStatus(problems []string, err error) string {
+	if err != nil {
+		return "unknown (" + err.Error() + ")"
+	}
+
+	if len(problems) == 0 {
+		return "ok"
+	}
+
+	return strings.Join(problems, ",")
+}
@@ -35,6 +35,47 @@ var Create = cli.Command{
 			Name:  "keyfile",
 			Usage: "Keyfile to encrypt the volume",
 		},
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "Raid type of the volume (raid1, raid5 or raid10)",
+		},
+		&cli.Uint64Flag{
+			Name:  "stripes",
+			Usage: "Number of stripes",
+		},
+		&cli.StringFlag{
+			Name:  "stripesize",
+			Usage: "Size of each stripe",
+		},
+		&cli.Uint64Flag{
+			Name:  "mirrors",
+			Usage: "Number of mirrors (raid1 and raid10)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "pv",
+			Usage: "Physical volume to allocate from (can be repeated)",
+		},
+		&cli.StringFlag{
+			Name:  "avoid",
+			Usage: "Volume whose physical volumes must not be used",
+		},
+		&cli.StringFlag{
+			Name:  "fstype",
+			Usage: "Filesystem to format the volume with (ext4, xfs, btrfs or none)",
+		},
+		&cli.StringFlag{
+			Name:  "mountopts",
+			Usage: "Comma-separated list of options to mount the volume with",
+		},
+		&cli.StringSliceFlag{
+			Name:  "mkfs",
+			Usage: "Format option as key=value, e.g. label=data (can be repeated)",
+		},
+		&cli.DurationFlag{
+			Name:  "freeze-timeout",
+			Usage: "Maximum time to freeze the filesystem of a snapshot's origin (0 disables freezing)",
+			Value: lib.DefaultFreezeTimeout,
+		},
 		&cli.StringFlag{
 			Name:  "root, r",
 			Usage: "Root of the volume creation",
@@ -48,8 +89,27 @@ var Create = cli.Command{
 			thinpool    = c.String("thinpool")
 			snapshot    = c.String("snapshot")
 			keyfile     = c.String("keyfile")
+			avoid       = c.String("avoid")
+			fstype      = c.String("fstype")
+			avoided     *lib.LogicalVolume
+			vg          *lib.VolumeGroup
+			created     *lib.LogicalVolume
+			origin      *lib.LogicalVolume
 		)
 
+		var cfg = lib.LvCreationConfig{
+			Name:            name,
+			Size:            size,
+			Snapshot:        snapshot,
+			ThinPool:        thinpool,
+			KeyFile:         keyfile,
+			Type:            c.String("type"),
+			Stripes:         c.Uint64("stripes"),
+			StripeSize:      c.String("stripesize"),
+			Mirrors:         c.Uint64("mirrors"),
+			PhysicalVolumes: c.StringSlice("pv"),
+		}
+
 		lvm, err := lib.NewLvm(lib.LvmConfig{})
 		utils.Abort(err)
 
@@ -58,29 +118,146 @@ var Create = cli.Command{
 			utils.Abort(errors.Errorf("Name parameter not set."))
 		}
 
-		if volumegroup == "" {
-			vgs, err := lvm.ListVolumeGroups()
+		err = lib.ValidateLayoutOptions(cfg)
+		utils.Abort(err)
+
+		mountOpts, err := lib.ParseMountOptions(fstype, c.String("mountopts"))
+		utils.Abort(err)
+
+		formatOpts, err := lib.ParseFormatOptions(c.StringSlice("mkfs"))
+		utils.Abort(err)
+
+		formatter, err := lib.GetFormatter(mountOpts.FsType)
+		utils.Abort(err)
+
+		err = formatter.Validate(formatOpts)
+		utils.Abort(err)
+
+		if snapshot != "" && (fstype != "" || len(formatOpts) > 0) {
+			utils.Abort(errors.Errorf(
+				"snapshots keep the filesystem of their origin"))
+		}
+
+		if snapshot == "" {
+			cfg.FsType = mountOpts.FsType
+			cfg.Tags = append(mountOpts.Tags(), formatOpts.Tags()...)
+		}
+
+		caps := lvm.ProbeCapabilities()
+		err = caps.CheckCreationConfig(cfg)
+		utils.Abort(err)
+
+		inv, err := lvm.GetInventory()
+		utils.Abort(err)
+
+		if avoid != "" {
+			if len(cfg.PhysicalVolumes) > 0 {
+				utils.Abort(errors.Errorf(
+					"avoid and pv flags can't be used together"))
+			}
+
+			avoided, err = inv.LogicalVolume(avoid)
+			utils.Abort(err)
+
+			if avoided == nil {
+				utils.Abort(errors.Errorf(
+					"volume %s to avoid not found", avoid))
+			}
+
+			if volumegroup == "" {
+				volumegroup = avoided.VgName
+			}
+		}
+
+		if snapshot != "" {
+			var originName = snapshot
+			if volumegroup != "" {
+				originName = volumegroup + "/" + snapshot
+			}
+
+			origin, err = inv.LogicalVolume(originName)
 			utils.Abort(err)
 
-			vg, err := lib.PickBestVolumeGroup(0, vgs)
+			if origin == nil {
+				utils.Abort(errors.Errorf(
+					"snapshot origin %s not found", originName))
+			}
+
+			volumegroup = origin.VgName
+			cfg.ThinSnapshot = origin.PoolLv != ""
+		}
+
+		var needed lib.ByteSize
+		if size != "" && thinpool == "" {
+			needed, err = lib.ParseByteSize(size)
+			utils.Abort(err)
+		}
+
+		if volumegroup == "" {
+			var candidates = make([]*lib.VolumeGroup, 0)
+			for _, candidate := range inv.VolumeGroups {
+				if uint64(candidate.PvCount) >= lib.RequiredPhysicalVolumes(cfg) {
+					candidates = append(candidates, candidate)
+				}
+			}
+
+			vg, err = lib.PickBestVolumeGroup(needed, candidates)
 			utils.Abort(err)
 
 			if vg == nil {
 				utils.Abort(errors.Errorf(
 					"didn't find suitable vg for specified size"))
 			}
+		} else {
+			vg = inv.VolumeGroup(volumegroup)
+			if vg == nil {
+				utils.Abort(errors.Errorf(
+					"volume group %s not found", volumegroup))
+			}
+		}
+
+		if avoided != nil {
+			if avoided.VgName != vg.Name {
+				utils.Abort(errors.Errorf(
+					"volume %s to avoid is not in volume group %s",
+					avoid, vg.Name))
+			}
+
+			cfg.PhysicalVolumes, err = inv.PhysicalVolumesAvoiding(avoided)
+			utils.Abort(err)
+
+			if len(cfg.PhysicalVolumes) == 0 {
+				utils.Abort(errors.Errorf(
+					"no physical volumes left in %s outside of %s",
+					vg.Name, avoid))
+			}
+		}
+
+		err = lib.ValidateLogicalVolumeLayout(cfg, vg, inv.PhysicalVolumes)
+		utils.Abort(err)
+
+		cfg.VolumeGroup = vg.Name
+		if origin != nil {
+			err = lvm.CreateSnapshot(cfg, origin, c.Duration("freeze-timeout"))
+		} else {
+			err = lvm.CreateLv(cfg)
+		}
+		utils.Abort(err)
+
+		// mkfs options alone format with the default filesystem
+		if fstype == "" && len(formatOpts) == 0 {
+			return
+		}
+
+		created, err = lvm.GetLogicalVolume(vg.Name + "/" + name)
+		utils.Abort(err)
 
-			volumegroup = vg.Name
+		if created == nil || created.LvDmPath == "" {
+			utils.Abort(errors.Errorf(
+				"can't find the device of the created volume %s", name))
 		}
 
-		err = lvm.CreateLv(lib.LvCreationConfig{
-			Name:        name,
-			Size:        size,
-			VolumeGroup: volumegroup,
-			Snapshot:    snapshot,
-			ThinPool:    thinpool,
-			KeyFile:     keyfile,
-		})
+		err = lvm.FormatDevice(created.LvDmPath, mountOpts.FsType, formatOpts)
 		utils.Abort(err)
 
 		return
@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"io"
+	"os"
+
+	"github.com/cirocosta/golvm/lib"
+	"github.com/cirocosta/golvm/lvmctl/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var Export = cli.Command{
+	Name:  "export",
+	Usage: "streams an archive of a volume to stdout or a file",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Volume (lv or vg/lv) to export",
+		},
+		&cli.StringFlag{
+			Name:  "output, o",
+			Usage: "File to write the archive to (defaults to stdout)",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "Archive format: raw (block image) or fs (files)",
+			Value: string(lib.ArchiveRaw),
+		},
+		&cli.BoolFlag{
+			Name:  "compress",
+			Usage: "Compress the archive with gzip",
+		},
+		&cli.StringFlag{
+			Name:  "snapshot-size",
+			Usage: "Size of the temporary snapshot of thick volumes (defaults to the size of the volume)",
+		},
+		&cli.DurationFlag{
+			Name:  "freeze-timeout",
+			Usage: "Maximum time to freeze the filesystem of a mounted volume (0 disables freezing)",
+			Value: lib.DefaultFreezeTimeout,
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		var (
+			name   = c.String("name")
+			output = c.String("output")
+			w      io.Writer
+			vol    *lib.LogicalVolume
+		)
+
+		if name == "" {
+			cli.ShowCommandHelp(c, "export")
+			utils.Abort(errors.Errorf("Name parameter not set."))
+		}
+
+		kind, err := lib.ParseArchiveKind(c.String("format"))
+		utils.Abort(err)
+
+		lvm, err := lib.NewLvm(lib.LvmConfig{})
+		utils.Abort(err)
+
+		vol, err = lvm.GetLogicalVolume(name)
+		utils.Abort(err)
+
+		if vol == nil {
+			utils.Abort(errors.Errorf("volume %s not found", name))
+		}
+
+		w = os.Stdout
+		if output != "" {
+			file, err := os.Create(output)
+			utils.Abort(err)
+			defer file.Close()
+
+			w = file
+		}
+
+		err = lvm.ExportVolume(vol, w, lib.ExportConfig{
+			Kind:          kind,
+			Compress:      c.Bool("compress"),
+			SnapshotSize:  c.String("snapshot-size"),
+			FreezeTimeout: c.Duration("freeze-timeout"),
+		})
+		if err != nil && output != "" {
+			os.Remove(output)
+		}
+		utils.Abort(err)
+
+		return
+	},
+}
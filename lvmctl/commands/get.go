@@ -2,6 +2,9 @@ package commands
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/cirocosta/golvm/lib"
 	"github.com/cirocosta/golvm/lvmctl/utils"
@@ -15,7 +18,7 @@ var Get = cli.Command{
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "name",
-			Usage: "Name of the volume to inspect",
+			Usage: "Name of the volume to inspect (lv or vg/lv)",
 		},
 	},
 	Action: func(c *cli.Context) (err error) {
@@ -34,17 +37,11 @@ var Get = cli.Command{
 		lvm, err := lib.NewLvm(lib.LvmConfig{})
 		utils.Abort(err)
 
-		lvs, err := lvm.ListLogicalVolumes()
+		inv, err := lvm.GetInventory()
 		utils.Abort(err)
 
-		for _, lv := range lvs {
-			if lv.LvName != name {
-				continue
-			}
-
-			desiredVolume = lv
-			break
-		}
+		desiredVolume, err = inv.LogicalVolume(name)
+		utils.Abort(err)
 
 		if desiredVolume == nil {
 			utils.Abort(errors.Errorf(
@@ -53,8 +50,9 @@ var Get = cli.Command{
 
 		fmt.Printf("NAME\t\t%s\n", desiredVolume.LvFullName)
 		fmt.Printf("POOL\t\t%s\n", desiredVolume.PoolLv)
-		fmt.Printf("SIZE\t\t%f\n", desiredVolume.LvSize)
+		fmt.Printf("SIZE\t\t%s\n", desiredVolume.LvSize)
 		fmt.Printf("ATTR\t\t%s\n", desiredVolume.LvAttr)
+		fmt.Printf("LAYOUT\t\t%s\n", desiredVolume.LvLayout)
 
 		attr, err = lib.ParseLvAttr(desiredVolume.LvAttr)
 		utils.Abort(err)
@@ -65,6 +63,51 @@ var Get = cli.Command{
 		fmt.Printf("VOL_TYPE\t\t%s\n", attr.VolumeType)
 		fmt.Printf("VOL_HEALTH\t\t%s\n", attr.VolumeHealth)
 		fmt.Printf("TARGET_TYPE\t\t%s\n", attr.TargetType)
+		fmt.Printf("ACTIVE\t\t%t\n", attr.IsActive())
+		fmt.Printf("OPEN\t\t%t\n", attr.IsOpen())
+
+		pvs, err := inv.PhysicalVolumesOf(desiredVolume)
+		utils.Abort(err)
+
+		fmt.Printf("PVS\t\t%s\n", strings.Join(pvs, ","))
+
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+
+		fmt.Println("")
+		fmt.Println("SEGMENTS")
+		fmt.Fprintln(w, "START\tEXTENTS\tTYPE\tSTRIPES\tRANGES\t")
+		for _, seg := range inv.SegmentsOf(desiredVolume) {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%d\t%s\n",
+				seg.SegStartPe,
+				seg.SegSizePe,
+				seg.SegType,
+				seg.Stripes,
+				seg.SegPeRanges)
+		}
+		w.Flush()
+
+		if !attr.IsActive() || desiredVolume.LvDmPath == "" {
+			return
+		}
+
+		devices, err := lvm.VolumeDeviceNumbers(desiredVolume)
+		utils.Abort(err)
+
+		table, err := lvm.GetMountTable()
+		utils.Abort(err)
+
+		fmt.Println("")
+		fmt.Println("MOUNTS")
+		fmt.Fprintln(w, "DEVICE\tLOCATION\tFORMAT\tOPTIONS\t")
+		for _, mount := range table.OfDevices(devices) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+				mount.Device,
+				mount.Location,
+				mount.Format,
+				mount.Options)
+		}
+		w.Flush()
 
 		return
 	},
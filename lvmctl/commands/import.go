@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cirocosta/golvm/lib"
+	"github.com/cirocosta/golvm/lvmctl/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var Import = cli.Command{
+	Name:  "import",
+	Usage: "creates a volume out of an archive read from stdin or a file",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Name of the volume to create",
+		},
+		&cli.StringFlag{
+			Name:  "input, i",
+			Usage: "File to read the archive from (defaults to stdin)",
+		},
+		&cli.StringFlag{
+			Name:  "size",
+			Usage: "Size of the volume (defaults to the size of the archived one)",
+		},
+		&cli.StringFlag{
+			Name:  "volumegroup",
+			Usage: "Volume group to use",
+		},
+		&cli.StringFlag{
+			Name:  "thinpool",
+			Usage: "Name of the thinpool to base the volume",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		var (
+			name        = c.String("name")
+			input       = c.String("input")
+			volumegroup = c.String("volumegroup")
+			r           io.Reader
+			vg          *lib.VolumeGroup
+			pool        *lib.LogicalVolume
+			needed      lib.ByteSize
+		)
+
+		if name == "" {
+			cli.ShowCommandHelp(c, "import")
+			utils.Abort(errors.Errorf("Name parameter not set."))
+		}
+
+		r = os.Stdin
+		if input != "" {
+			file, err := os.Open(input)
+			utils.Abort(err)
+			defer file.Close()
+
+			r = file
+		}
+
+		ar, err := lib.NewArchiveReader(r)
+		utils.Abort(err)
+
+		cfg, err := lib.BuildImportConfig(lib.LvCreationConfig{
+			Name:     name,
+			Size:     c.String("size"),
+			ThinPool: c.String("thinpool"),
+		}, ar.Manifest)
+		utils.Abort(err)
+
+		lvm, err := lib.NewLvm(lib.LvmConfig{})
+		utils.Abort(err)
+
+		inv, err := lvm.GetInventory()
+		utils.Abort(err)
+
+		switch {
+		case volumegroup != "":
+			vg = inv.VolumeGroup(volumegroup)
+			if vg == nil {
+				utils.Abort(errors.Errorf(
+					"volume group %s not found", volumegroup))
+			}
+		case cfg.ThinPool != "":
+			// the volume goes in the volume group of its pool
+			pool, err = inv.ThinPool(cfg.ThinPool)
+			utils.Abort(err)
+
+			vg = inv.VolumeGroup(pool.VgName)
+			cfg.ThinPool = pool.LvName
+		default:
+			needed, err = lib.ParseByteSize(cfg.Size)
+			utils.Abort(err)
+
+			vg, err = lib.PickBestVolumeGroup(needed, inv.VolumeGroups)
+			utils.Abort(err)
+
+			if vg == nil {
+				utils.Abort(errors.Errorf(
+					"didn't find suitable vg for specified size"))
+			}
+		}
+
+		cfg.VolumeGroup = vg.Name
+		err = lvm.ImportVolume(ar, cfg)
+		utils.Abort(err)
+
+		fmt.Printf("imported %s as %s/%s\n", ar.Manifest, vg.Name, name)
+		return
+	},
+}
@@ -42,17 +42,24 @@ var Ls = cli.Command{
 
 		fmt.Println("")
 		fmt.Println("LOGICAL VOLUMES")
-		fmt.Fprintln(w, "NAME\tVG\tSIZE\tPOOL\t")
+		fmt.Fprintln(w, "NAME\tVG\tSIZE\tPOOL\tTYPE\t")
 		for _, lv := range lvs {
 			if lv.VgName != volumegroup {
 				continue
 			}
 
-			fmt.Fprintf(w, "%s\t%s\t%.2f\t%s\n",
+			var volumeType = "unknown"
+			attr, err := lib.ParseLvAttr(lv.LvAttr)
+			if err == nil {
+				volumeType = attr.VolumeType.String()
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
 				lv.LvName,
 				lv.VgName,
 				lv.LvSize,
-				lv.PoolLv)
+				lv.PoolLv,
+				volumeType)
 		}
 		w.Flush()
 
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/cirocosta/golvm/lib"
+	"github.com/cirocosta/golvm/lvmctl/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var Restore = cli.Command{
+	Name:  "restore",
+	Usage: "creates a volume out of a backup taken with 'backup'",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Name of the volume to create",
+		},
+		&cli.StringFlag{
+			Name:  "dir",
+			Usage: "Directory that holds the backups",
+		},
+		&cli.IntFlag{
+			Name:  "sequence",
+			Usage: "Backup to restore (defaults to the latest)",
+		},
+		&cli.StringFlag{
+			Name:  "size",
+			Usage: "Size of the volume (defaults to the size of the backed up one)",
+		},
+		&cli.StringFlag{
+			Name:  "volumegroup",
+			Usage: "Volume group to use",
+		},
+		&cli.StringFlag{
+			Name:  "thinpool",
+			Usage: "Name of the thinpool to base the volume",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		var (
+			name        = c.String("name")
+			dir         = c.String("dir")
+			volumegroup = c.String("volumegroup")
+			vg          *lib.VolumeGroup
+			pool        *lib.LogicalVolume
+			needed      lib.ByteSize
+		)
+
+		if name == "" || dir == "" {
+			cli.ShowCommandHelp(c, "restore")
+			utils.Abort(errors.Errorf("Name and dir parameters must be set."))
+		}
+
+		cfg := lib.LvCreationConfig{
+			Name:     name,
+			Size:     c.String("size"),
+			ThinPool: c.String("thinpool"),
+		}
+
+		lvm, err := lib.NewLvm(lib.LvmConfig{})
+		utils.Abort(err)
+
+		inv, err := lvm.GetInventory()
+		utils.Abort(err)
+
+		switch {
+		case volumegroup != "":
+			vg = inv.VolumeGroup(volumegroup)
+			if vg == nil {
+				utils.Abort(errors.Errorf(
+					"volume group %s not found", volumegroup))
+			}
+		case cfg.ThinPool != "":
+			// the volume goes in the volume group of its pool
+			pool, err = inv.ThinPool(cfg.ThinPool)
+			utils.Abort(err)
+
+			vg = inv.VolumeGroup(pool.VgName)
+			cfg.ThinPool = pool.LvName
+		default:
+			needed, err = backupSize(dir, c.Int("sequence"), cfg.Size)
+			utils.Abort(err)
+
+			vg, err = lib.PickBestVolumeGroup(needed, inv.VolumeGroups)
+			utils.Abort(err)
+
+			if vg == nil {
+				utils.Abort(errors.Errorf(
+					"didn't find suitable vg for specified size"))
+			}
+		}
+
+		cfg.VolumeGroup = vg.Name
+		err = lvm.RestoreBackup(dir, c.Int("sequence"), cfg)
+		utils.Abort(err)
+
+		fmt.Printf("restored %s as %s/%s\n", dir, vg.Name, name)
+		return
+	},
+}
+
+// backupSize determines the size of the volume that a backup
+// gets restored to.
+func backupSize(dir string, seq int, size string) (needed lib.ByteSize, err error) {
+	var backups []*lib.BackupManifest
+
+	if size != "" {
+		needed, err = lib.ParseByteSize(size)
+		return
+	}
+
+	backups, err = lib.ListBackups(dir)
+	if err != nil {
+		return
+	}
+
+	for _, backup := range backups {
+		if seq == 0 || backup.Sequence == seq {
+			needed = backup.Size
+		}
+	}
+
+	return
+}
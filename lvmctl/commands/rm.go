@@ -34,6 +34,21 @@ var Rm = cli.Command{
 			utils.Abort(errors.Errorf("All parameters must be set."))
 		}
 
+		vol, err := lvm.GetLogicalVolume(volumegroup + "/" + name)
+		utils.Abort(err)
+
+		if vol == nil {
+			utils.Abort(errors.Errorf(
+				"volume %s/%s not found", volumegroup, name))
+		}
+
+		if group, found := lib.VolumeSnapshotGroup(vol); found {
+			utils.Abort(errors.Errorf(
+				"volume %s is part of the snapshot group %s - "+
+					"remove the whole group with 'snapshot rm'",
+				name, group))
+		}
+
 		err = lvm.RemoveLv(lib.LvRemovalConfig{
 			LvName: name,
 			VgName: volumegroup,
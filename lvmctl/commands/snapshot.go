@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/cirocosta/golvm/lib"
+	"github.com/cirocosta/golvm/lvmctl/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var groupFlag = &cli.StringFlag{
+	Name:  "group",
+	Usage: "Name of the consistency group",
+}
+
+var Snapshot = cli.Command{
+	Name:  "snapshot",
+	Usage: "manages consistency groups of snapshots",
+	Subcommands: []*cli.Command{
+		&snapshotCreate,
+		&snapshotLs,
+		&snapshotRm,
+		&snapshotRollback,
+	},
+}
+
+var snapshotCreate = cli.Command{
+	Name:  "create",
+	Usage: "snapshots a set of volumes at the same point in time",
+	Flags: []cli.Flag{
+		groupFlag,
+		&cli.StringSliceFlag{
+			Name:  "volume",
+			Usage: "Volume (lv or vg/lv) to snapshot (can be repeated)",
+		},
+		&cli.StringFlag{
+			Name:  "size",
+			Usage: "Maximum size of each snapshot",
+		},
+		&cli.DurationFlag{
+			Name:  "freeze-timeout",
+			Usage: "Maximum time to freeze the filesystems of the volumes (0 disables freezing)",
+			Value: lib.DefaultFreezeTimeout,
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		var (
+			group   = c.String("group")
+			names   = c.StringSlice("volume")
+			origins = make([]*lib.LogicalVolume, 0, len(names))
+			origin  *lib.LogicalVolume
+		)
+
+		if group == "" || len(names) == 0 {
+			cli.ShowCommandHelp(c, "create")
+			utils.Abort(errors.Errorf(
+				"a group and at least one volume must be specified"))
+		}
+
+		lvm, err := lib.NewLvm(lib.LvmConfig{})
+		utils.Abort(err)
+
+		inv, err := lvm.GetInventory()
+		utils.Abort(err)
+
+		for _, name := range names {
+			origin, err = inv.LogicalVolume(name)
+			utils.Abort(err)
+
+			if origin == nil {
+				utils.Abort(errors.Errorf(
+					"volume %s not found", name))
+			}
+
+			origins = append(origins, origin)
+		}
+
+		err = lvm.CreateSnapshotGroup(lib.SnapshotGroupConfig{
+			Name:          group,
+			Size:          c.String("size"),
+			FreezeTimeout: c.Duration("freeze-timeout"),
+		}, origins)
+		utils.Abort(err)
+
+		return
+	},
+}
+
+var snapshotLs = cli.Command{
+	Name:  "ls",
+	Usage: "lists the consistency groups",
+	Action: func(c *cli.Context) (err error) {
+		lvm, err := lib.NewLvm(lib.LvmConfig{})
+		utils.Abort(err)
+
+		lvs, err := lvm.ListLogicalVolumes()
+		utils.Abort(err)
+
+		var (
+			groups = lib.SnapshotGroups(lvs)
+			names  = make([]string, 0, len(groups))
+		)
+
+		for name := range groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+
+		fmt.Fprintln(w, "GROUP\tSNAPSHOT\tVG\tORIGIN\tSIZE\t")
+		for _, name := range names {
+			for _, lv := range groups[name] {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					name,
+					lv.LvName,
+					lv.VgName,
+					lv.Origin,
+					lv.LvSize)
+			}
+		}
+		w.Flush()
+
+		return
+	},
+}
+
+var snapshotRm = cli.Command{
+	Name:  "rm",
+	Usage: "removes all the snapshots of a consistency group",
+	Flags: []cli.Flag{
+		groupFlag,
+	},
+	Action: func(c *cli.Context) (err error) {
+		var group = c.String("group")
+
+		if group == "" {
+			cli.ShowCommandHelp(c, "rm")
+			utils.Abort(errors.Errorf("a group must be specified"))
+		}
+
+		lvm, err := lib.NewLvm(lib.LvmConfig{})
+		utils.Abort(err)
+
+		err = lvm.RemoveSnapshotGroup(group)
+		utils.Abort(err)
+
+		return
+	},
+}
+
+var snapshotRollback = cli.Command{
+	Name:  "rollback",
+	Usage: "reverts the volumes of a consistency group to its snapshots",
+	Flags: []cli.Flag{
+		groupFlag,
+	},
+	Action: func(c *cli.Context) (err error) {
+		var group = c.String("group")
+
+		if group == "" {
+			cli.ShowCommandHelp(c, "rollback")
+			utils.Abort(errors.Errorf("a group must be specified"))
+		}
+
+		lvm, err := lib.NewLvm(lib.LvmConfig{})
+		utils.Abort(err)
+
+		err = lvm.RollbackSnapshotGroup(group)
+		utils.Abort(err)
+
+		return
+	},
+}
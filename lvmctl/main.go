@@ -17,12 +17,17 @@ func main() {
 		Version: version,
 		Usage:   "Controls the 'golvm' volume plugin",
 		Commands: []*cli.Command{
+			&commands.Backup,
 			&commands.Check,
 			&commands.Create,
+			&commands.Export,
 			&commands.Get,
+			&commands.Import,
 			&commands.Ls,
 			&commands.Resize,
+			&commands.Restore,
 			&commands.Rm,
+			&commands.Snapshot,
 		},
 	}
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/cirocosta/golvm/driver"
 	"github.com/cirocosta/golvm/lib"
@@ -15,7 +16,11 @@ const (
 	socketAddress   = "/run/docker/plugins/golvm.sock"
 	volumeMountRoot = "/mnt/lvmvol/volumes"
 	vgWhitelistFile = "/mnt/lvmvol/whitelist.txt"
-	mountsFile      = "/host/proc/mounts"
+	mountsFile      = "/proc/self/mountinfo"
+	inventoryTTL    = 5 * time.Second
+	unmountPolicy   = "normal"
+	fsckPolicy      = "never"
+	populateRoot    = "/mnt/lvmvol/populate"
 )
 
 var (
@@ -28,9 +33,21 @@ var (
 )
 
 func main() {
-	l, err := lib.NewLvm(lib.LvmConfig{})
+	l, err := lib.NewLvm(lib.LvmConfig{
+		ReportFormat:  lib.ReportFormatAuto,
+		InventoryTTL:  inventoryTTL,
+		MountInfoFile: mountsFile,
+	})
 	utils.Abort(err)
 
+	caps := l.ProbeCapabilities()
+	for _, tool := range caps.Tools() {
+		logger.Info().
+			Str("tool", tool.Tool).
+			Str("version", tool.String()).
+			Msg("tool probed")
+	}
+
 	dm, err := driver.NewDirManager(driver.DirManagerConfig{
 		Root: volumeMountRoot,
 	})
@@ -40,11 +57,14 @@ func main() {
 		Lvm:             &l,
 		DirManager:      &dm,
 		VgWhitelistFile: vgWhitelistFile,
-		MountsFile:      mountsFile,
+		Capabilities:    &caps,
+		UnmountPolicy:   unmountPolicy,
+		FsckPolicy:      fsckPolicy,
+		PopulateRoot:    populateRoot,
 	})
 	utils.Abort(err)
 
-	handler := v.NewHandler(d)
+	handler := v.NewHandler(&d)
 
 	logger.Info().
 		Str("address", socketAddress).